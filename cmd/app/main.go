@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"db5/config"
 	"db5/internal/db"
+	"db5/internal/fiscal"
+	"db5/internal/jobs"
+	"db5/internal/pdf"
+	"db5/internal/printer"
 	"db5/internal/server"
 	"log"
 )
@@ -17,7 +22,28 @@ func main() {
 		log.Fatalf("failed to connect to DB: %v", err)
 	}
 
-	mux := server.CreateNewServerMux(&Database)
+	go jobs.RunLoyaltyTierRecalculation(context.Background(), &Database, conf.Loyalty.TierRecalcHour)
+
+	var fiscalTransport fiscal.Transport
+	if conf.Fiscal.DropDir != "" {
+		fiscalTransport, err = fiscal.NewFileDropTransport(conf.Fiscal.DropDir)
+		if err != nil {
+			log.Fatalf("failed to prepare fiscal drop dir: %v", err)
+		}
+	}
+	go jobs.RunFiscalExport(context.Background(), &Database, fiscalTransport, conf.Fiscal.ExportInterval)
+
+	receiptRenderer, err := printer.NewRenderer(conf.Store, conf.Printer)
+	if err != nil {
+		log.Fatalf("failed to load receipt templates: %v", err)
+	}
+
+	pdfGenerator, err := pdf.NewGenerator(conf.Store, conf.PDF, conf.BaseCurrency)
+	if err != nil {
+		log.Fatalf("failed to load PDF fonts: %v", err)
+	}
+
+	mux := server.CreateNewServerMux(&Database, receiptRenderer, pdfGenerator)
 
 	s := server.CreateNewServer(*mux)
 
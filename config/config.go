@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +18,98 @@ type Config struct {
 	DBHost string
 	DBPort string
 	DBName string
+
+	// NegativeStockCategories категории товаров, которые можно продавать в минус (например, весовые)
+	NegativeStockCategories []string
+	// SupervisorPositions должности, которым разрешено аннулировать чеки и утверждать инвентаризации
+	SupervisorPositions []string
+	// VatDefaultRate ставка НДС для товаров без своей ставки и без ставки категории
+	VatDefaultRate float64
+	// BaseCurrency валюта учета, в нее пересчитываются закупки в иностранной валюте
+	BaseCurrency string
+
+	Loyalty          LoyaltyConfig
+	ReceiptNumbering ReceiptNumberingConfig
+	Store            StoreConfig
+	Printer          PrinterConfig
+	PDF              PDFConfig
+	Fiscal           FiscalConfig
+}
+
+// FiscalConfig выгрузка фискальных документов
+type FiscalConfig struct {
+	// Format формат документа: "json" или "xml"
+	Format string
+	// DropDir каталог, куда складываются документы. Без каталога документы только копятся в очереди.
+	DropDir string
+	// ExportInterval пауза между проходами выгрузки
+	ExportInterval time.Duration
+}
+
+// StoreConfig реквизиты магазина для шапки чеков и документов
+type StoreConfig struct {
+	Name        string
+	Address     string
+	Phone       string
+	INN         string
+	KPP         string
+	OGRN        string
+	BankName    string
+	BankBIK     string
+	BankAccount string
+	CorrAccount string
+}
+
+// PDFConfig шрифты TrueType для PDF. Без путей используются встроенные шрифты Go с кириллицей.
+type PDFConfig struct {
+	FontPath     string
+	BoldFontPath string
+}
+
+// PrinterConfig печать чеков
+type PrinterConfig struct {
+	// TemplateDir каталог с собственными шаблонами, файлы в нем заменяют встроенные с тем же именем
+	TemplateDir string
+	// PaperWidth ширина ленты по умолчанию в миллиметрах: 58 или 80
+	PaperWidth int
+	// Footer текст в конце чека
+	Footer string
+}
+
+// ReceiptNumberingConfig правила печатного номера чека
+type ReceiptNumberingConfig struct {
+	// Scope "day" — сквозная нумерация по кассе за календарный день, "shift" — в пределах смены
+	Scope string
+	// Format шаблон номера: {register}, {shift}, {date} (ГГГГММДД), {counter} или {counter:N} с нулями до N знаков
+	Format string
+	// DefaultRegister касса для смен, открытых без указания кассы
+	DefaultRegister string
+}
+
+// LoyaltyConfig правила начисления баллов. Один балл равен одному рублю при списании.
+type LoyaltyConfig struct {
+	// AccrualPercent процент от суммы покупки, начисляемый баллами
+	AccrualPercent float64
+	// CategoryMultipliers множители начисления для отдельных категорий
+	CategoryMultipliers map[string]float64
+	// ExcludedCategories категории, за которые баллы не начисляются
+	ExcludedCategories []string
+	// Tiers уровни карт по возрастанию порога годовых покупок
+	Tiers []LoyaltyTier
+	// TierRecalcHour час, в который ночная задача пересчитывает уровни карт
+	TierRecalcHour int
+}
+
+const (
+	ReceiptNumberScopeDay   = "day"
+	ReceiptNumberScopeShift = "shift"
+)
+
+// LoyaltyTier MinSpend — порог годовых покупок в рублях, в деньги переводится в db
+type LoyaltyTier struct {
+	Name            string
+	MinSpend        float64
+	DiscountPercent float64
 }
 
 func LoadConfig() Config {
@@ -28,6 +124,86 @@ func LoadConfig() Config {
 		DBHost: os.Getenv("DB_HOST"),
 		DBPort: os.Getenv("DB_PORT"),
 		DBName: os.Getenv("DB_NAME"),
+
+		NegativeStockCategories: getEnvList("NEGATIVE_STOCK_CATEGORIES"),
+		SupervisorPositions:     getEnvList("SUPERVISOR_POSITIONS"),
+		VatDefaultRate:          getEnvFloat("VAT_DEFAULT_RATE", 20),
+		BaseCurrency:            strings.ToUpper(strings.TrimSpace(os.Getenv("BASE_CURRENCY"))),
+
+		Loyalty: LoyaltyConfig{
+			AccrualPercent:      getEnvFloat("LOYALTY_ACCRUAL_PERCENT", 1),
+			CategoryMultipliers: getEnvFloatMap("LOYALTY_CATEGORY_MULTIPLIERS"),
+			ExcludedCategories:  getEnvList("LOYALTY_EXCLUDED_CATEGORIES"),
+			Tiers:               getLoyaltyTiers("LOYALTY_TIERS"),
+			TierRecalcHour:      int(getEnvFloat("LOYALTY_TIER_RECALC_HOUR", 3)),
+		},
+
+		Store: StoreConfig{
+			Name:        os.Getenv("STORE_NAME"),
+			Address:     os.Getenv("STORE_ADDRESS"),
+			Phone:       os.Getenv("STORE_PHONE"),
+			INN:         os.Getenv("STORE_INN"),
+			KPP:         os.Getenv("STORE_KPP"),
+			OGRN:        os.Getenv("STORE_OGRN"),
+			BankName:    os.Getenv("STORE_BANK_NAME"),
+			BankBIK:     os.Getenv("STORE_BANK_BIK"),
+			BankAccount: os.Getenv("STORE_BANK_ACCOUNT"),
+			CorrAccount: os.Getenv("STORE_CORR_ACCOUNT"),
+		},
+
+		PDF: PDFConfig{
+			FontPath:     os.Getenv("PDF_FONT_PATH"),
+			BoldFontPath: os.Getenv("PDF_BOLD_FONT_PATH"),
+		},
+
+		Printer: PrinterConfig{
+			TemplateDir: os.Getenv("RECEIPT_TEMPLATE_DIR"),
+			PaperWidth:  int(getEnvFloat("RECEIPT_PAPER_WIDTH", 80)),
+			Footer:      getEnvString("RECEIPT_FOOTER", "Спасибо за покупку!"),
+		},
+
+		Fiscal: FiscalConfig{
+			Format:         strings.ToLower(getEnvString("FISCAL_FORMAT", "json")),
+			DropDir:        os.Getenv("FISCAL_DROP_DIR"),
+			ExportInterval: time.Duration(getEnvFloat("FISCAL_EXPORT_INTERVAL", 30) * float64(time.Second)),
+		},
+
+		ReceiptNumbering: ReceiptNumberingConfig{
+			Scope:           getEnvString("RECEIPT_NUMBER_SCOPE", ReceiptNumberScopeDay),
+			Format:          getEnvString("RECEIPT_NUMBER_FORMAT", "{register}-{date}-{counter:4}"),
+			DefaultRegister: getEnvString("DEFAULT_REGISTER", "1"),
+		},
+	}
+
+	if len(cfg.SupervisorPositions) == 0 {
+		cfg.SupervisorPositions = []string{"Старший кассир", "Администратор", "Директор"}
+	}
+
+	if cfg.VatDefaultRate < 0 || cfg.VatDefaultRate >= 100 {
+		log.Fatalf("VAT_DEFAULT_RATE: ожидается ставка от 0 до 100, получено %v", cfg.VatDefaultRate)
+	}
+
+	if cfg.BaseCurrency == "" {
+		cfg.BaseCurrency = "RUB"
+	}
+
+	if cfg.Loyalty.TierRecalcHour < 0 || cfg.Loyalty.TierRecalcHour > 23 {
+		log.Fatalf("LOYALTY_TIER_RECALC_HOUR: ожидается час от 0 до 23, получено %d", cfg.Loyalty.TierRecalcHour)
+	}
+
+	if cfg.ReceiptNumbering.Scope != ReceiptNumberScopeDay && cfg.ReceiptNumbering.Scope != ReceiptNumberScopeShift {
+		log.Fatalf("RECEIPT_NUMBER_SCOPE: ожидается %q или %q, получено %q", ReceiptNumberScopeDay, ReceiptNumberScopeShift, cfg.ReceiptNumbering.Scope)
+	}
+
+	if cfg.Printer.PaperWidth != 58 && cfg.Printer.PaperWidth != 80 {
+		log.Fatalf("RECEIPT_PAPER_WIDTH: ожидается 58 или 80, получено %d", cfg.Printer.PaperWidth)
+	}
+
+	if cfg.Fiscal.Format != "json" && cfg.Fiscal.Format != "xml" {
+		log.Fatalf("FISCAL_FORMAT: ожидается json или xml, получено %q", cfg.Fiscal.Format)
+	}
+	if cfg.Fiscal.ExportInterval < time.Second {
+		log.Fatalf("FISCAL_EXPORT_INTERVAL: ожидается не меньше 1 секунды, получено %v", cfg.Fiscal.ExportInterval)
 	}
 
 	if cfg.DBUser == "" || cfg.DBPass == "" {
@@ -40,3 +216,86 @@ func LoadConfig() Config {
 func (c Config) GetDSN() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", c.DBUser, c.DBPass, c.DBHost, c.DBPort, c.DBName)
 }
+
+// getEnvList читает список значений через запятую
+func getEnvList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func getEnvString(key, defaultValue string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("%s: ожидается число, получено %q", key, value)
+	}
+	return result
+}
+
+// getEnvFloatMap читает пары вида "ключ:число" через запятую
+func getEnvFloatMap(key string) map[string]float64 {
+	result := make(map[string]float64)
+	for _, item := range getEnvList(key) {
+		name, value, ok := strings.Cut(item, ":")
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil {
+			log.Fatalf("%s: ожидается \"название:число\", получено %q", key, item)
+		}
+		result[strings.TrimSpace(name)] = number
+	}
+	return result
+}
+
+// getLoyaltyTiers читает уровни вида "название:порог:скидка%" через запятую
+func getLoyaltyTiers(key string) []LoyaltyTier {
+	items := getEnvList(key)
+	if len(items) == 0 {
+		items = []string{"bronze:0:0", "silver:20000:3", "gold:50000:5"}
+	}
+
+	tiers := make([]LoyaltyTier, 0, len(items))
+	for _, item := range items {
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			log.Fatalf("%s: ожидается \"название:порог:скидка\", получено %q", key, item)
+		}
+		minSpend, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || minSpend < 0 {
+			log.Fatalf("%s: неверный порог в %q", key, item)
+		}
+		discount, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil {
+			log.Fatalf("%s: неверная скидка в %q", key, item)
+		}
+		if discount < 0 || discount >= 100 {
+			log.Fatalf("%s: ожидается скидка от 0 до 100, получено %v в %q", key, discount, item)
+		}
+		tiers = append(tiers, LoyaltyTier{Name: strings.TrimSpace(parts[0]), MinSpend: minSpend, DiscountPercent: discount})
+	}
+
+	slices.SortFunc(tiers, func(a, b LoyaltyTier) int {
+		switch {
+		case a.MinSpend < b.MinSpend:
+			return -1
+		case a.MinSpend > b.MinSpend:
+			return 1
+		}
+		return 0
+	})
+	return tiers
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestGetLoyaltyTiers(t *testing.T) {
+	t.Setenv("LOYALTY_TIERS", "gold:50000:5, bronze:0:0 ,silver:20000:2.5")
+	want := []LoyaltyTier{
+		{Name: "bronze", MinSpend: 0, DiscountPercent: 0},
+		{Name: "silver", MinSpend: 20000, DiscountPercent: 2.5},
+		{Name: "gold", MinSpend: 50000, DiscountPercent: 5},
+	}
+	if got := getLoyaltyTiers("LOYALTY_TIERS"); !reflect.DeepEqual(got, want) {
+		t.Errorf("getLoyaltyTiers() = %+v, want %+v", got, want)
+	}
+
+	t.Setenv("LOYALTY_TIERS", "")
+	if got := getLoyaltyTiers("LOYALTY_TIERS"); len(got) != 3 || got[0].Name != "bronze" {
+		t.Errorf("default tiers = %+v", got)
+	}
+}
+
+// TestGetLoyaltyTiersDiscountRange скидка вне [0, 100) останавливает запуск, проверяется в дочернем процессе
+func TestGetLoyaltyTiersDiscountRange(t *testing.T) {
+	if tiers := os.Getenv("TEST_LOYALTY_TIERS"); tiers != "" {
+		t.Setenv("LOYALTY_TIERS", tiers)
+		getLoyaltyTiers("LOYALTY_TIERS")
+		return
+	}
+
+	for _, tiers := range []string{"bronze:0:-1", "gold:50000:100", "gold:50000:150"} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestGetLoyaltyTiersDiscountRange$")
+		cmd.Env = append(os.Environ(), "TEST_LOYALTY_TIERS="+tiers)
+		if err := cmd.Run(); err == nil {
+			t.Errorf("getLoyaltyTiers(%q) did not exit", tiers)
+		}
+	}
+}
@@ -5,7 +5,10 @@ go 1.24
 require (
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
+	golang.org/x/image v0.25.0
 	golang.org/x/text v0.24.0
 )
 
 require github.com/rs/cors v1.11.1
+
+require github.com/DATA-DOG/go-sqlmock v1.5.2
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (db *DB) orderCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return db.baseCurrency, nil
+	}
+	if !types.IsCurrencyCode(currency) {
+		return "", newValidationError("invalid currency code %q", currency)
+	}
+	return currency, nil
+}
+
+// exchangeRateAt последний известный курс на дату date включительно
+func (db *DB) exchangeRateAt(q queryer, currency string, date time.Time) (float64, error) {
+	if currency == db.baseCurrency {
+		return 1, nil
+	}
+
+	var rate float64
+	err := q.QueryRow("select rate from Exchange_Rate where currency = $1 and rate_date <= $2 order by rate_date desc limit 1",
+		currency, date.Format(time.DateOnly)).Scan(&rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, newValidationError("no exchange rate for %s on %s", currency, date.Format(time.DateOnly))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("exchangeRateAt: %v", err)
+	}
+	return rate, nil
+}
+
+func supplierOrderBaseTotal(items []types.SupplierOrderItemResponse) types.Money {
+	var total types.Money
+	for _, item := range items {
+		total += item.BaseAmount
+	}
+	return total
+}
+
+func (db *DB) SetExchangeRate(rateInfo types.ExchangeRateRequest) (types.ExchangeRateResponse, error) {
+	currency := strings.ToUpper(strings.TrimSpace(rateInfo.Currency))
+	if !types.IsCurrencyCode(currency) {
+		return types.ExchangeRateResponse{}, newValidationError("invalid currency code %q", rateInfo.Currency)
+	}
+	if currency == db.baseCurrency {
+		return types.ExchangeRateResponse{}, newValidationError("%s is the base currency", currency)
+	}
+	if rateInfo.Rate <= 0 {
+		return types.ExchangeRateResponse{}, newValidationError("rate must be positive")
+	}
+
+	date := time.Now()
+	if rateInfo.Date != "" {
+		var err error
+		date, err = time.ParseInLocation(time.DateOnly, rateInfo.Date, time.Local)
+		if err != nil {
+			return types.ExchangeRateResponse{}, newValidationError("date must be in YYYY-MM-DD format")
+		}
+	}
+
+	_, err := db.db.Exec("insert into Exchange_Rate (currency, rate_date, rate) values ($1, $2, $3) on conflict (currency, rate_date) do update set rate = excluded.rate",
+		currency, date.Format(time.DateOnly), rateInfo.Rate)
+	if err != nil {
+		return types.ExchangeRateResponse{}, fmt.Errorf("SetExchangeRate: %v", err)
+	}
+	return types.ExchangeRateResponse{Currency: currency, Date: date.Format(time.DateOnly), Rate: rateInfo.Rate}, nil
+}
+
+func (db *DB) GetExchangeRates(currency string) ([]types.ExchangeRateResponse, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency != "" && !types.IsCurrencyCode(currency) {
+		return nil, newValidationError("invalid currency code %q", currency)
+	}
+
+	rows, err := db.db.Query(`
+	select currency, rate_date, rate
+	from Exchange_Rate
+	where $1 = '' or currency = $1
+	order by rate_date desc, currency`, currency)
+	if err != nil {
+		return nil, fmt.Errorf("GetExchangeRates: %v", err)
+	}
+	defer rows.Close()
+
+	rates := []types.ExchangeRateResponse{}
+	for rows.Next() {
+		var rate types.ExchangeRateResponse
+		var date time.Time
+		if err := rows.Scan(&rate.Currency, &date, &rate.Rate); err != nil {
+			return nil, fmt.Errorf("GetExchangeRates: %v", err)
+		}
+		rate.Date = date.Format(time.DateOnly)
+		rates = append(rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetExchangeRates: %v", err)
+	}
+	return rates, nil
+}
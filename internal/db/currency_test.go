@@ -0,0 +1,119 @@
+package db
+
+import (
+	"db5/internal/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCreateNewSupplierOrderConvertsPrices(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.baseCurrency = "RUB"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`select rate from Exchange_Rate where currency = \$1 and rate_date <= \$2`).
+		WithArgs("USD", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"rate"}).AddRow(92.5))
+	mock.ExpectQuery(`insert into Supplier_Order \(total_amount, supplier_id, status, currency, exchange_rate\)`).
+		WithArgs(0, int64(2), types.SupplierOrderStatusDraft, "USD", 92.5).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(`insert into Supplier_Order_Items \(purchase_price, base_purchase_price, quantity, product_id, order_id\)`).
+		WithArgs(types.Money(1099), types.Money(101658), int64(10), int64(1), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := db.CreateNewSupplierOrder(types.SupplierOrderInfoRequest{
+		SupplierID:         2,
+		Currency:           " usd ",
+		SupplierOrderItems: []types.SupplierOrderItemInfoRequest{{Price: 1099, ProductID: 1, Quantity: 10}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateNewSupplierOrderInBaseCurrency(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.baseCurrency = "RUB"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`insert into Supplier_Order`).
+		WithArgs(0, int64(2), types.SupplierOrderStatusDraft, "RUB", 1.0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(`insert into Supplier_Order_Items`).
+		WithArgs(types.Money(1099), types.Money(1099), int64(10), int64(1), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := db.CreateNewSupplierOrder(types.SupplierOrderInfoRequest{
+		SupplierID:         2,
+		SupplierOrderItems: []types.SupplierOrderItemInfoRequest{{Price: 1099, ProductID: 1, Quantity: 10}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateNewSupplierOrderRejectsCurrency(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.baseCurrency = "RUB"
+
+	if err := db.CreateNewSupplierOrder(types.SupplierOrderInfoRequest{Currency: "US$"}); !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("CreateNewSupplierOrder() with bad code error = %v, want ValidationError", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`from Exchange_Rate`).WillReturnRows(sqlmock.NewRows([]string{"rate"}))
+	mock.ExpectRollback()
+	if err := db.CreateNewSupplierOrder(types.SupplierOrderInfoRequest{Currency: "EUR"}); !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("CreateNewSupplierOrder() without rate error = %v, want ValidationError", err)
+	}
+}
+
+func TestSetExchangeRateValidation(t *testing.T) {
+	db, _ := newMockDB(t)
+	db.baseCurrency = "RUB"
+	tests := []struct {
+		name string
+		rate types.ExchangeRateRequest
+	}{
+		{name: "bad code", rate: types.ExchangeRateRequest{Currency: "dollar", Rate: 90}},
+		{name: "base currency", rate: types.ExchangeRateRequest{Currency: "rub", Rate: 1}},
+		{name: "zero rate", rate: types.ExchangeRateRequest{Currency: "USD"}},
+		{name: "bad date", rate: types.ExchangeRateRequest{Currency: "USD", Rate: 90, Date: "14.03.2026"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.SetExchangeRate(tt.rate); !hasErrorType(err, &ValidationError{}) {
+				t.Errorf("SetExchangeRate() error = %v, want ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestGetMarginReport(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.baseCurrency = "RUB"
+	mock.ExpectQuery(`with sales as`).
+		WithArgs(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity", "revenue", "unit_cost"}).
+			AddRow(1, "Milk", 10, "899.00", "61.25").
+			AddRow(2, "Bread", 4, "182.00", nil))
+
+	got, err := db.GetMarginReport(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 3, 14, 20, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Revenue != 108100 || got.Cost != 61250 || got.Margin != 28650 || got.Currency != "RUB" {
+		t.Errorf("GetMarginReport() = %+v, want revenue 1081.00, cost 612.50, margin 286.50 in RUB", got)
+	}
+	if got.Products[1].UnitCost != nil || got.Products[1].Margin != 0 {
+		t.Errorf("product without purchases = %+v, want no cost", got.Products[1])
+	}
+
+	if _, err := db.GetMarginReport(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)); !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("GetMarginReport() with from after to error = %v, want ValidationError", err)
+	}
+}
@@ -0,0 +1,406 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const birthDateLayout = "2006-01-02"
+
+const customerColumns = "id, name, coalesce(phone, ''), coalesce(email, ''), birth_date, sms_consent, email_consent, created_at, updated_at"
+
+// queryer общий интерфейс *sql.DB и *sql.Tx для чтения
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// normalizePhone приводит российский номер к виду +7XXXXXXXXXX.
+// Номера других форматов сохраняются как цифры с плюсом.
+func normalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	result := digits.String()
+	switch {
+	case result == "":
+		return ""
+	case len(result) == 10:
+		result = "7" + result
+	case len(result) == 11 && result[0] == '8':
+		result = "7" + result[1:]
+	}
+	return "+" + result
+}
+
+// customerFields проверенные поля покупателя для записи в базу
+type customerFields struct {
+	name      string
+	phone     sql.NullString
+	email     sql.NullString
+	birthDate sql.NullTime
+}
+
+func validateCustomer(customerInfo types.CustomerRequest) (customerFields, error) {
+	fields := customerFields{name: strings.TrimSpace(customerInfo.Name)}
+	if fields.name == "" {
+		return customerFields{}, newValidationError("name is required")
+	}
+
+	if phone := normalizePhone(customerInfo.Phone); phone != "" {
+		if len(phone) < 8 || len(phone) > 16 {
+			return customerFields{}, newValidationError("invalid phone %q", customerInfo.Phone)
+		}
+		fields.phone = sql.NullString{String: phone, Valid: true}
+	}
+
+	if email := strings.TrimSpace(customerInfo.Email); email != "" {
+		address, err := mail.ParseAddress(email)
+		if err != nil || address.Address != email {
+			return customerFields{}, newValidationError("invalid email %q", customerInfo.Email)
+		}
+		fields.email = sql.NullString{String: email, Valid: true}
+	}
+
+	if customerInfo.BirthDate != "" {
+		birthDate, err := time.Parse(birthDateLayout, customerInfo.BirthDate)
+		if err != nil {
+			return customerFields{}, newValidationError("birth_date must be in YYYY-MM-DD format")
+		}
+		if birthDate.After(time.Now()) {
+			return customerFields{}, newValidationError("birth_date must not be in the future")
+		}
+		fields.birthDate = sql.NullTime{Time: birthDate, Valid: true}
+	}
+	return fields, nil
+}
+
+// CreateCustomer заводит покупателя. Телефон приводится к единому формату для поиска.
+func (db *DB) CreateCustomer(customerInfo types.CustomerRequest) (types.CustomerResponse, error) {
+	fields, err := validateCustomer(customerInfo)
+	if err != nil {
+		return types.CustomerResponse{}, err
+	}
+
+	var customerID int64
+	err = db.db.QueryRow("insert into Customer (name, phone, email, birth_date, sms_consent, email_consent) values ($1, $2, $3, $4, $5, $6) returning id",
+		fields.name, fields.phone, fields.email, fields.birthDate, customerInfo.SmsConsent, customerInfo.EmailConsent).Scan(&customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("CreateCustomer: %v", err)
+	}
+
+	customer, err := db.getCustomer(db.db, customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("CreateCustomer: %v", err)
+	}
+	return customer, nil
+}
+
+func (db *DB) GetCustomer(customerID int64) (types.CustomerResponse, error) {
+	customer, err := db.getCustomer(db.db, customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("GetCustomer: %w", err)
+	}
+	return customer, nil
+}
+
+// FindCustomersByPhone ищет по полному номеру или по его окончанию не короче 4 цифр
+func (db *DB) FindCustomersByPhone(phone string) ([]types.CustomerResponse, error) {
+	normalized := normalizePhone(phone)
+	if len(normalized) < 5 {
+		return nil, newValidationError("phone must contain at least 4 digits")
+	}
+
+	pattern := "%" + strings.TrimPrefix(normalized, "+")
+	if len(normalized) == 12 {
+		pattern = normalized
+	}
+
+	rows, err := db.db.Query("select "+customerColumns+" from Customer where phone like $1 order by id", pattern)
+	if err != nil {
+		return nil, fmt.Errorf("FindCustomersByPhone: %v", err)
+	}
+	defer rows.Close()
+
+	customers := []types.CustomerResponse{}
+	ids := []int64{}
+	byID := make(map[int64]int)
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("FindCustomersByPhone: %v", err)
+		}
+		byID[customer.ID] = len(customers)
+		ids = append(ids, customer.ID)
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("FindCustomersByPhone: %v", err)
+	}
+	if len(customers) == 0 {
+		return customers, nil
+	}
+
+	cardRows, err := db.db.Query("select "+loyaltyCardColumns+" from Loyalty_Card where customer_id = any($1) order by id", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("FindCustomersByPhone: %v", err)
+	}
+	defer cardRows.Close()
+
+	for cardRows.Next() {
+		card, err := db.scanLoyaltyCard(cardRows)
+		if err != nil {
+			return nil, fmt.Errorf("FindCustomersByPhone: %v", err)
+		}
+		customer := &customers[byID[*card.CustomerID]]
+		customer.Cards = append(customer.Cards, card)
+	}
+	if err := cardRows.Err(); err != nil {
+		return nil, fmt.Errorf("FindCustomersByPhone: %v", err)
+	}
+	return customers, nil
+}
+
+// UpdateCustomer полностью заменяет данные покупателя, привязанные карты не меняются
+func (db *DB) UpdateCustomer(customerID int64, customerInfo types.CustomerRequest) (types.CustomerResponse, error) {
+	fields, err := validateCustomer(customerInfo)
+	if err != nil {
+		return types.CustomerResponse{}, err
+	}
+
+	result, err := db.db.Exec("update Customer set name = $1, phone = $2, email = $3, birth_date = $4, sms_consent = $5, email_consent = $6, updated_at = now() where id = $7",
+		fields.name, fields.phone, fields.email, fields.birthDate, customerInfo.SmsConsent, customerInfo.EmailConsent, customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("UpdateCustomer: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("UpdateCustomer: %v", err)
+	} else if affected == 0 {
+		return types.CustomerResponse{}, newNotFoundError("customer %d not found", customerID)
+	}
+
+	customer, err := db.getCustomer(db.db, customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("UpdateCustomer: %v", err)
+	}
+	return customer, nil
+}
+
+// DeleteCustomer удаляет персональные данные покупателя. Карты остаются и отвязываются.
+func (db *DB) DeleteCustomer(customerID int64) error {
+	result, err := db.db.Exec("delete from Customer where id = $1", customerID)
+	if err != nil {
+		return fmt.Errorf("DeleteCustomer: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("DeleteCustomer: %v", err)
+	} else if affected == 0 {
+		return newNotFoundError("customer %d not found", customerID)
+	}
+	return nil
+}
+
+// AttachLoyaltyCard привязывает карту к покупателю. Карту другого покупателя
+// перепривязать нельзя, дубликаты объединяются через MergeCustomers.
+func (db *DB) AttachLoyaltyCard(customerID, number int64) (types.CustomerResponse, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("AttachLoyaltyCard: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomers(tx, customerID); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("AttachLoyaltyCard: %w", err)
+	}
+
+	var owner sql.NullInt64
+	err = tx.QueryRow("select customer_id from Loyalty_Card where number = $1 for update", number).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.CustomerResponse{}, newNotFoundError("loyalty card %d not found", number)
+	}
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("AttachLoyaltyCard: %v", err)
+	}
+	if owner.Valid && owner.Int64 != customerID {
+		return types.CustomerResponse{}, newConflictError("loyalty card %d belongs to customer %d", number, owner.Int64)
+	}
+
+	if _, err := tx.Exec("update Loyalty_Card set customer_id = $1 where number = $2", customerID, number); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("AttachLoyaltyCard: %v", err)
+	}
+
+	customer, err := db.getCustomer(tx, customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("AttachLoyaltyCard: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("AttachLoyaltyCard: %v", err)
+	}
+	return customer, nil
+}
+
+func (db *DB) DetachLoyaltyCard(customerID, number int64) (types.CustomerResponse, error) {
+	result, err := db.db.Exec("update Loyalty_Card set customer_id = null where number = $1 and customer_id = $2", number, customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("DetachLoyaltyCard: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("DetachLoyaltyCard: %v", err)
+	} else if affected == 0 {
+		return types.CustomerResponse{}, newNotFoundError("loyalty card %d is not attached to customer %d", number, customerID)
+	}
+
+	customer, err := db.getCustomer(db.db, customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("DetachLoyaltyCard: %w", err)
+	}
+	return customer, nil
+}
+
+// MergeCustomers переносит карты дубликата на покупателя customerID и удаляет дубликат.
+// Пустые контактные поля заполняются из дубликата, согласия на рассылки остаются прежними.
+func (db *DB) MergeCustomers(customerID int64, mergeInfo types.CustomerMergeRequest) (types.CustomerResponse, error) {
+	if mergeInfo.SourceID == 0 {
+		return types.CustomerResponse{}, newValidationError("source_id is required")
+	}
+	if mergeInfo.SourceID == customerID {
+		return types.CustomerResponse{}, newValidationError("customer cannot be merged into itself")
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("MergeCustomers: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomers(tx, customerID, mergeInfo.SourceID); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("MergeCustomers: %w", err)
+	}
+
+	_, err = tx.Exec(`
+	update Customer as c set
+	phone = coalesce(c.phone, s.phone),
+	email = coalesce(c.email, s.email),
+	birth_date = coalesce(c.birth_date, s.birth_date),
+	updated_at = now()
+	from Customer as s
+	where c.id = $1 and s.id = $2`, customerID, mergeInfo.SourceID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("MergeCustomers: %v", err)
+	}
+
+	if _, err := tx.Exec("update Loyalty_Card set customer_id = $1 where customer_id = $2", customerID, mergeInfo.SourceID); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("MergeCustomers: %v", err)
+	}
+	if _, err := tx.Exec("delete from Customer where id = $1", mergeInfo.SourceID); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("MergeCustomers: %v", err)
+	}
+
+	customer, err := db.getCustomer(tx, customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("MergeCustomers: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("MergeCustomers: %v", err)
+	}
+	return customer, nil
+}
+
+// GetCustomerReceipts история покупок по всем картам покупателя
+func (db *DB) GetCustomerReceipts(customerID int64, filter types.ReceiptFilter) ([]types.FullReceiptInfoResponse, error) {
+	where, args, err := receiptStatusCondition(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.getCustomer(db.db, customerID); err != nil {
+		return nil, fmt.Errorf("GetCustomerReceipts: %w", err)
+	}
+
+	args = append(args, customerID)
+	receipts, err := db.queryFullReceipts(fmt.Sprintf("%s and lc.customer_id = $%d", where, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetCustomerReceipts: %v", err)
+	}
+	return receipts, nil
+}
+
+// lockCustomers блокирует строки покупателей в порядке id, чтобы встречные слияния не взаимоблокировались
+func lockCustomers(tx *sql.Tx, ids ...int64) error {
+	rows, err := tx.Query("select id from Customer where id = any($1) order by id for update", pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("lockCustomers: %v", err)
+	}
+	defer rows.Close()
+
+	found := make(map[int64]bool, len(ids))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("lockCustomers: %v", err)
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("lockCustomers: %v", err)
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			return newNotFoundError("customer %d not found", id)
+		}
+	}
+	return nil
+}
+
+// scanCustomer читает строку customerColumns, карты не заполняются
+func scanCustomer(row rowScanner) (types.CustomerResponse, error) {
+	customer := types.CustomerResponse{Cards: []types.LoyaltyCardResponse{}}
+	var birthDate sql.NullTime
+	err := row.Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Email, &birthDate, &customer.SmsConsent, &customer.EmailConsent, &customer.CreatedAt, &customer.UpdatedAt)
+	if err != nil {
+		return types.CustomerResponse{}, err
+	}
+	if birthDate.Valid {
+		customer.BirthDate = birthDate.Time.Format(birthDateLayout)
+	}
+	return customer, nil
+}
+
+func (db *DB) getCustomer(q queryer, customerID int64) (types.CustomerResponse, error) {
+	customer, err := scanCustomer(q.QueryRow("select "+customerColumns+" from Customer where id = $1", customerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.CustomerResponse{}, newNotFoundError("customer %d not found", customerID)
+	}
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("getCustomer: %v", err)
+	}
+
+	rows, err := q.Query("select "+loyaltyCardColumns+" from Loyalty_Card where customer_id = $1 order by id", customerID)
+	if err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("getCustomer: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		card, err := db.scanLoyaltyCard(rows)
+		if err != nil {
+			return types.CustomerResponse{}, fmt.Errorf("getCustomer: %v", err)
+		}
+		customer.Cards = append(customer.Cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return types.CustomerResponse{}, fmt.Errorf("getCustomer: %v", err)
+	}
+	return customer, nil
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"db5/internal/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{phone: "+7 (912) 345-67-89", want: "+79123456789"},
+		{phone: "8 912 345 67 89", want: "+79123456789"},
+		{phone: "9123456789", want: "+79123456789"},
+		{phone: "79123456789", want: "+79123456789"},
+		{phone: "+375 29 123-45-67", want: "+375291234567"},
+		{phone: "12345", want: "+12345"},
+		{phone: "", want: ""},
+		{phone: "нет", want: ""},
+	}
+	for _, tt := range tests {
+		if got := normalizePhone(tt.phone); got != tt.want {
+			t.Errorf("normalizePhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCustomer(t *testing.T) {
+	tests := []struct {
+		name      string
+		info      types.CustomerRequest
+		wantPhone string
+		wantErr   bool
+	}{
+		{name: "name only", info: types.CustomerRequest{Name: " Anna "}},
+		{name: "full profile", info: types.CustomerRequest{Name: "Anna", Phone: "8 (912) 345-67-89", Email: "anna@example.com", BirthDate: "1990-05-01"}, wantPhone: "+79123456789"},
+		{name: "no name", info: types.CustomerRequest{Name: " "}, wantErr: true},
+		{name: "short phone", info: types.CustomerRequest{Name: "Anna", Phone: "123"}, wantErr: true},
+		{name: "bad email", info: types.CustomerRequest{Name: "Anna", Email: "Anna <anna@example.com>"}, wantErr: true},
+		{name: "bad birth date", info: types.CustomerRequest{Name: "Anna", BirthDate: "01.05.1990"}, wantErr: true},
+		{name: "birth date in the future", info: types.CustomerRequest{Name: "Anna", BirthDate: time.Now().AddDate(1, 0, 0).Format(birthDateLayout)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := validateCustomer(tt.info)
+			if tt.wantErr {
+				if !hasErrorType(err, &ValidationError{}) {
+					t.Errorf("validateCustomer() error = %v, want ValidationError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fields.phone.String != tt.wantPhone {
+				t.Errorf("phone = %q, want %q", fields.phone.String, tt.wantPhone)
+			}
+		})
+	}
+}
+
+func expectGetCustomer(mock sqlmock.Sqlmock, customerID int64, cardNumbers ...int64) {
+	mock.ExpectQuery(`from Customer where id = \$1`).WithArgs(customerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "phone", "email", "birth_date", "sms_consent", "email_consent", "created_at", "updated_at"}).
+			AddRow(customerID, "Anna", "+79123456789", "", nil, false, false, time.Now(), time.Now()))
+	cards := sqlmock.NewRows([]string{"id", "number", "blocked", "issued_at", "tier", "customer_id"})
+	for i, number := range cardNumbers {
+		cards.AddRow(i+1, number, false, time.Now(), nil, customerID)
+	}
+	mock.ExpectQuery(`from Loyalty_Card where customer_id = \$1`).WithArgs(customerID).WillReturnRows(cards)
+}
+
+func TestFindCustomersByPhone(t *testing.T) {
+	tests := []struct {
+		phone   string
+		pattern string
+	}{
+		{phone: "8 912 345-67-89", pattern: "+79123456789"},
+		{phone: "67-89", pattern: "%6789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phone, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectQuery(`from Customer where phone like \$1 order by id`).WithArgs(tt.pattern).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "phone", "email", "birth_date", "sms_consent", "email_consent", "created_at", "updated_at"}).
+					AddRow(1, "Anna", "+79123456789", "", nil, false, false, time.Now(), time.Now()).
+					AddRow(2, "Boris", "+79003456789", "", nil, false, false, time.Now(), time.Now()))
+			// Карты всех найденных покупателей одним запросом
+			mock.ExpectQuery(`from Loyalty_Card where customer_id = any\(\$1\) order by id`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "number", "blocked", "issued_at", "tier", "customer_id"}).
+					AddRow(1, 2000000000015, false, time.Now(), nil, 1).
+					AddRow(2, 2000000000022, false, time.Now(), nil, 1))
+
+			got, err := db.FindCustomersByPhone(tt.phone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || len(got[0].Cards) != 2 || got[1].Cards == nil || len(got[1].Cards) != 0 {
+				t.Errorf("FindCustomersByPhone() = %+v, want Anna with two cards and Boris with none", got)
+			}
+		})
+	}
+
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`from Customer where phone like \$1`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if got, err := db.FindCustomersByPhone("0000"); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("no match: FindCustomersByPhone() = %v, %v, want empty list", got, err)
+	}
+
+	db, _ = newMockDB(t)
+	if _, err := db.FindCustomersByPhone("789"); !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("three digits: error = %v, want ValidationError", err)
+	}
+}
+
+func expectLockCustomers(mock sqlmock.Sqlmock, ids ...int64) {
+	rows := sqlmock.NewRows([]string{"id"})
+	for _, id := range ids {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery(`select id from Customer where id = any\(\$1\) order by id for update`).WillReturnRows(rows)
+}
+
+func TestAttachLoyaltyCard(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   any
+		wantErr error
+	}{
+		{name: "free card", owner: nil},
+		{name: "own card", owner: 1},
+		{name: "card of another customer", owner: 2, wantErr: &ConflictError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			expectLockCustomers(mock, 1)
+			mock.ExpectQuery(`select customer_id from Loyalty_Card where number = \$1 for update`).
+				WillReturnRows(sqlmock.NewRows([]string{"customer_id"}).AddRow(tt.owner))
+			if tt.wantErr == nil {
+				mock.ExpectExec(`update Loyalty_Card set customer_id = \$1 where number = \$2`).
+					WithArgs(int64(1), int64(2000000000015)).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectGetCustomer(mock, 1, 2000000000015)
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			_, err := db.AttachLoyaltyCard(1, 2000000000015)
+			if tt.wantErr == nil && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != nil && !hasErrorType(err, tt.wantErr) {
+				t.Errorf("AttachLoyaltyCard() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMergeCustomers(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectLockCustomers(mock, 1, 2)
+	mock.ExpectExec(`update Customer as c set`).WithArgs(int64(1), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`update Loyalty_Card set customer_id = \$1 where customer_id = \$2`).WithArgs(int64(1), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`delete from Customer where id = \$1`).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectGetCustomer(mock, 1, 2000000000015, 2000000000022)
+	mock.ExpectCommit()
+
+	got, err := db.MergeCustomers(1, types.CustomerMergeRequest{SourceID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Cards) != 2 {
+		t.Errorf("cards after merge = %d, want 2", len(got.Cards))
+	}
+
+	if _, err := db.MergeCustomers(1, types.CustomerMergeRequest{SourceID: 1}); !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("merge into itself: error = %v, want ValidationError", err)
+	}
+}
+
+func TestMergeCustomersMissing(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectLockCustomers(mock, 1)
+	mock.ExpectRollback()
+
+	if _, err := db.MergeCustomers(1, types.CustomerMergeRequest{SourceID: 2}); !hasErrorType(err, &NotFoundError{}) {
+		t.Errorf("MergeCustomers() error = %v, want NotFoundError", err)
+	}
+}
@@ -6,8 +6,9 @@ import (
 	"db5/internal/types"
 	"fmt"
 	"sync"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // Store подумать над интерфейсом для настроек
@@ -16,7 +17,9 @@ type Store interface {
 	Close()
 	GetProductInfo() ([]types.ProductInfoResponse, error)
 	GetTellerInfo() ([]types.TellerInfoResponse, error)
-	CreateNewReceipt(receiptInfo types.ReceiptInfoRequest) error
+	CreateNewReceipt(receiptInfo types.ReceiptInfoRequest) (types.ReceiptResponse, error)
+	CreateOfflineReceipt(receiptInfo types.OfflineReceiptRequest) (types.ReceiptResponse, bool, error)
+	PreviewReceipt(receiptInfo types.ReceiptInfoRequest) (types.ReceiptResponse, error)
 	GetDepartmentInfo() ([]types.DepartmentInfoResponse, error)
 	CreateNewEmployee(employeeInfo types.EmployeeInfoCreateRequest) error
 	GetEmployeeInfo() ([]types.EmployeeInfoResponse, error)
@@ -25,15 +28,82 @@ type Store interface {
 	GetProductInfoBySupplier(supplierID int64) ([]types.ProductInfoBySupplierResponse, error)
 	CreateNewSupplierOrder(supplierOrderInfo types.SupplierOrderInfoRequest) error
 	GetFullProductInfo() ([]types.FullProductInfoResponse, error)
-	GetFullReceiptInfo() ([]types.FullReceiptInfoResponse, error)
-	GetFullSupplierOrderInfo() ([]types.FullSupplierOrderInfoResponse, error)
+	GetFullReceiptInfo(filter types.ReceiptFilter) ([]types.FullReceiptInfoResponse, error)
+	GetReceipt(receiptID int64) (types.FullReceiptInfoResponse, error)
+	VoidReceipt(receiptID int64, voidInfo types.ReceiptVoidRequest) (types.FullReceiptInfoResponse, error)
+	CreateReceiptReturn(receiptID int64, returnInfo types.ReceiptReturnRequest) (types.ReceiptReturnResponse, error)
+	GetDailyReport(date time.Time) (types.DailyReportResponse, error)
+	IssueLoyaltyCard() (types.LoyaltyCardResponse, error)
+	GetLoyaltyCard(number int64) (types.LoyaltyCardResponse, error)
+	SetLoyaltyCardBlocked(number int64, blocked bool) (types.LoyaltyCardResponse, error)
+	GetLoyaltyBalance(number int64) (types.LoyaltyBalanceResponse, error)
+	RecalculateLoyaltyTiers() (int, error)
+	CreateCustomer(customerInfo types.CustomerRequest) (types.CustomerResponse, error)
+	GetCustomer(customerID int64) (types.CustomerResponse, error)
+	FindCustomersByPhone(phone string) ([]types.CustomerResponse, error)
+	UpdateCustomer(customerID int64, customerInfo types.CustomerRequest) (types.CustomerResponse, error)
+	DeleteCustomer(customerID int64) error
+	AttachLoyaltyCard(customerID, number int64) (types.CustomerResponse, error)
+	DetachLoyaltyCard(customerID, number int64) (types.CustomerResponse, error)
+	MergeCustomers(customerID int64, mergeInfo types.CustomerMergeRequest) (types.CustomerResponse, error)
+	GetCustomerReceipts(customerID int64, filter types.ReceiptFilter) ([]types.FullReceiptInfoResponse, error)
+	CreatePromotion(promotionInfo types.PromotionRequest) (types.PromotionResponse, error)
+	GetPromotions(activeOnly bool) ([]types.PromotionResponse, error)
+	DeactivatePromotion(promotionID int64) (types.PromotionResponse, error)
+	GetTaxRates() (types.TaxRatesResponse, error)
+	SetCategoryTaxRate(category string, rateInfo types.TaxRateRequest) error
+	SetProductTaxRate(productID int64, rateInfo types.TaxRateRequest) error
+	OpenShift(shiftInfo types.ShiftOpenRequest) (types.ShiftResponse, error)
+	CloseShift(shiftID int64, closeInfo types.ShiftCloseRequest) (types.ShiftReportResponse, error)
+	GetShiftReport(shiftID int64) (types.ShiftReportResponse, error)
+	GetFullSupplierOrderInfo(statuses []string) ([]types.FullSupplierOrderInfoResponse, error)
+	GetSupplierOrder(orderID int64) (types.FullSupplierOrderInfoResponse, error)
+	ReceiveSupplierOrder(orderID int64, receiveInfo types.SupplierOrderReceiveRequest) (types.FullSupplierOrderInfoResponse, error)
+	ChangeSupplierOrderStatus(orderID int64, statusInfo types.SupplierOrderStatusRequest) (types.FullSupplierOrderInfoResponse, error)
+	SetExchangeRate(rateInfo types.ExchangeRateRequest) (types.ExchangeRateResponse, error)
+	GetExchangeRates(currency string) ([]types.ExchangeRateResponse, error)
+	GetMarginReport(from, to time.Time) (types.MarginReportResponse, error)
+	EnqueueFiscalDocuments(limit int) (int, error)
+	GetFiscalQueue(limit int) ([]types.FiscalDocumentResponse, error)
+	MarkFiscalDocumentSent(documentID int64) error
+	MarkFiscalDocumentFailed(documentID int64, sendErr string) error
+	GetFiscalDocuments(status string) ([]types.FiscalDocumentResponse, error)
+	GetReceiptFiscalDocuments(receiptID int64) ([]types.FiscalDocumentResponse, error)
+	VerifyFiscalChain(register string) (types.FiscalChainResponse, error)
+	BeginIdempotentRequest(scope, key, requestHash string) (*types.StoredResponse, error)
+	CompleteIdempotentRequest(scope, key string, response types.StoredResponse) error
+	CreateStockMovement(productID int64, movementInfo types.StockMovementRequest) (types.StockMovementResponse, error)
+	GetProductMovements(productID int64) (types.ProductMovementsResponse, error)
+	CheckStockLedger() (types.StockCheckResponse, error)
+	OpenStocktake(openInfo types.StocktakeOpenRequest) (types.StocktakeResponse, error)
+	GetStocktakes(status string) ([]types.StocktakeResponse, error)
+	GetStocktake(stocktakeID int64) (types.StocktakeResponse, error)
+	CountStocktake(stocktakeID int64, countInfo types.StocktakeCountRequest) (types.StocktakeResponse, error)
+	ApproveStocktake(stocktakeID int64, closeInfo types.StocktakeCloseRequest) (types.StocktakeResponse, error)
+	CancelStocktake(stocktakeID int64, closeInfo types.StocktakeCloseRequest) (types.StocktakeResponse, error)
 }
 
 type DB struct {
-	db *sql.DB
+	db                      *sql.DB
+	negativeStockCategories []string
+	supervisorPositions     []string
+	vatDefaultRate          float64
+	baseCurrency            string
+	receiptNumbering        config.ReceiptNumberingConfig
+	loyalty                 config.LoyaltyConfig
+	loyaltyTiers            []loyaltyTier
+	store                   config.StoreConfig
+	fiscalFormat            string
 }
 
 func (db *DB) Connect(c config.Config) error {
+	if err := validateReceiptNumbering(c.ReceiptNumbering); err != nil {
+		return fmt.Errorf("receipt numbering: %w", err)
+	}
+	if !types.IsCurrencyCode(c.BaseCurrency) {
+		return fmt.Errorf("base currency %q is not a three-letter currency code", c.BaseCurrency)
+	}
+
 	database, err := sql.Open("postgres", c.GetDSN())
 	if err != nil {
 		return fmt.Errorf("sql open error: %w", err)
@@ -45,6 +115,15 @@ func (db *DB) Connect(c config.Config) error {
 	}
 
 	db.db = database
+	db.negativeStockCategories = c.NegativeStockCategories
+	db.supervisorPositions = c.SupervisorPositions
+	db.vatDefaultRate = c.VatDefaultRate
+	db.baseCurrency = c.BaseCurrency
+	db.receiptNumbering = c.ReceiptNumbering
+	db.loyalty = c.Loyalty
+	db.loyaltyTiers = newLoyaltyTiers(c.Loyalty.Tiers)
+	db.store = c.Store
+	db.fiscalFormat = c.Fiscal.Format
 
 	db.db.SetMaxOpenConns(10)
 	db.db.SetMaxIdleConns(5)
@@ -99,24 +178,109 @@ func (db *DB) GetTellerInfo() ([]types.TellerInfoResponse, error) {
 	return tellers, nil
 }
 
-// CreateNewReceipt добавить работу с номером карты
-func (db *DB) CreateNewReceipt(receiptInfo types.ReceiptInfoRequest) error {
+func (db *DB) CreateNewReceipt(receiptInfo types.ReceiptInfoRequest) (types.ReceiptResponse, error) {
 	tx, err := db.db.Begin()
 	if err != nil {
-		return fmt.Errorf("CreateNewReceipt: %v", err)
+		return types.ReceiptResponse{}, fmt.Errorf("CreateNewReceipt: %v", err)
 	}
 	defer tx.Rollback()
 
-	receiptID, err := db.insertReceipt(tx, receiptInfo)
+	shiftID, err := db.requireOpenShift(tx, receiptInfo.TellerID)
+	if err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("CreateNewReceipt: %w", err)
+	}
+
+	response, err := db.createReceipt(tx, receiptInfo, shiftID, nil)
 	if err != nil {
-		return fmt.Errorf("CreateNewReceipt: %v", err)
+		return types.ReceiptResponse{}, fmt.Errorf("CreateNewReceipt: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("CreateNewReceipt: %v", err)
+	}
+	return response, nil
+}
+
+// offlineSale чек, пробитый кассой без связи: идентификатор кассы и время продажи
+type offlineSale struct {
+	clientUUID string
+	createdAt  time.Time
+}
+
+// createReceipt проводит чек в смене shiftID внутри транзакции tx. offline пустой для чека,
+// пробитого сейчас, иначе чек получает время продажи и идентификатор с кассы.
+func (db *DB) createReceipt(tx *sql.Tx, receiptInfo types.ReceiptInfoRequest, shiftID int64, offline *offlineSale) (types.ReceiptResponse, error) {
+	saleTime := time.Now()
+	var saleDate sql.NullTime
+	var clientUUID sql.NullString
+	if offline != nil {
+		saleTime = offline.createdAt
+		saleDate = sql.NullTime{Time: offline.createdAt, Valid: true}
+		clientUUID = sql.NullString{String: offline.clientUUID, Valid: true}
+	}
+
+	sale, err := db.prepareReceipt(tx, receiptInfo, shiftID, saleTime, offline != nil)
+	if err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("createReceipt: %w", err)
+	}
+
+	number, printedNumber, err := db.nextReceiptNumber(tx, sale.shiftID, saleDate)
+	if err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("createReceipt: %v", err)
+	}
+
+	receiptID, date, err := db.insertReceipt(tx, receiptInfo.TellerID, sale.card.id, sale.shiftID, sale.draft.total, number, printedNumber, saleDate, clientUUID)
+	if err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("createReceipt: %v", err)
+	}
+	for _, line := range sale.draft.lines {
+		if err := db.insertReceiptProduct(tx, line, receiptID); err != nil {
+			return types.ReceiptResponse{}, fmt.Errorf("CreateNewReceiptProduct: %v", err)
+		}
+		movement := stockMovement{
+			kind: types.StockMovementSale, documentType: types.StockDocumentReceipt, documentID: receiptID, employeeID: receiptInfo.TellerID,
+		}
+		if shortage, ok := sale.draft.shortages[line.productID]; ok {
+			movement.comment = fmt.Sprintf("offline receipt sold %d with %d in stock", shortage.Requested, shortage.Available)
+		}
+		if _, err := db.updateProductStock(tx, line.productID, -line.quantity, movement); err != nil {
+			return types.ReceiptResponse{}, fmt.Errorf("createReceipt: %v", err)
+		}
 	}
-	for _, item := range receiptInfo.Products {
-		if err := db.insertReceiptProduct(tx, item, receiptID); err != nil {
-			return fmt.Errorf("CreateNewReceiptProduct: %v", err)
+	if err := db.insertReceiptPayments(tx, receiptID, sale.payments); err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("createReceipt: %v", err)
+	}
+	if err := db.recordReceiptPoints(tx, sale.card.id, receiptID, sale.pointsRedeemed, sale.pointsAccrued); err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("createReceipt: %v", err)
+	}
+	if sale.card.id.Valid {
+		if err := db.upgradeCardTier(tx, sale.card.id.Int64); err != nil {
+			return types.ReceiptResponse{}, fmt.Errorf("createReceipt: %v", err)
 		}
 	}
-	return tx.Commit()
+	response := sale.toReceiptResponse(receiptID, number, date)
+	response.PrintedNumber = printedNumber
+	return response, nil
+}
+
+// PreviewReceipt рассчитывает чек так же, как CreateNewReceipt, но ничего не записывает.
+// Транзакция всегда откатывается.
+func (db *DB) PreviewReceipt(receiptInfo types.ReceiptInfoRequest) (types.ReceiptResponse, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("PreviewReceipt: %v", err)
+	}
+	defer tx.Rollback()
+
+	shiftID, err := db.requireOpenShift(tx, receiptInfo.TellerID)
+	if err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("PreviewReceipt: %w", err)
+	}
+
+	sale, err := db.prepareReceipt(tx, receiptInfo, shiftID, time.Now(), false)
+	if err != nil {
+		return types.ReceiptResponse{}, fmt.Errorf("PreviewReceipt: %w", err)
+	}
+	return sale.toReceiptResponse(0, 0, time.Now()), nil
 }
 
 func (db *DB) GetDepartmentInfo() ([]types.DepartmentInfoResponse, error) {
@@ -228,19 +392,30 @@ func (db *DB) GetProductInfoBySupplier(supplierID int64) ([]types.ProductInfoByS
 	return products, nil
 }
 
+// CreateNewSupplierOrder курс валюты фиксируется на дату оформления заказа
 func (db *DB) CreateNewSupplierOrder(supplierOrderInfo types.SupplierOrderInfoRequest) error {
+	currency, err := db.orderCurrency(supplierOrderInfo.Currency)
+	if err != nil {
+		return err
+	}
+
 	tx, err := db.db.Begin()
 	if err != nil {
 		return fmt.Errorf("CreateNewSupplierOrder: %v", err)
 	}
 	defer tx.Rollback()
 
-	supplierOrderID, err := db.insertSupplierOrder(tx, supplierOrderInfo)
+	rate, err := db.exchangeRateAt(tx, currency, time.Now())
+	if err != nil {
+		return fmt.Errorf("CreateNewSupplierOrder: %w", err)
+	}
+
+	supplierOrderID, err := db.insertSupplierOrder(tx, supplierOrderInfo, currency, rate)
 	if err != nil {
 		return fmt.Errorf("CreateNewSupplierOrder: %v", err)
 	}
 	for _, item := range supplierOrderInfo.SupplierOrderItems {
-		if err := db.insertSupplierOrderItem(tx, item, supplierOrderID); err != nil {
+		if err := db.insertSupplierOrderItem(tx, item, supplierOrderID, rate); err != nil {
 			return fmt.Errorf("CreateNewSupplierOrderItem: %v", err)
 		}
 	}
@@ -276,39 +451,81 @@ func (db *DB) GetFullProductInfo() ([]types.FullProductInfoResponse, error) {
 	return Products, nil
 }
 
-func (db *DB) GetFullReceiptInfo() ([]types.FullReceiptInfoResponse, error) {
+// GetFullReceiptInfo с номером чека без явного статуса ищутся чеки в любом статусе
+func (db *DB) GetFullReceiptInfo(filter types.ReceiptFilter) ([]types.FullReceiptInfoResponse, error) {
+	if filter.Number != "" && filter.Status == "" {
+		filter.Status = "all"
+	}
+	where, args, err := receiptStatusCondition(filter)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Number != "" {
+		args = append(args, filter.Number)
+		where = fmt.Sprintf("%s and r.printed_number = $%d", where, len(args))
+	}
+
+	receipts, err := db.queryFullReceipts(where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetFullReceiptInfo: %v", err)
+	}
+	return receipts, nil
+}
+
+// receiptStatusCondition условие на статус чека для queryFullReceipts, параметр статуса всегда $1
+func receiptStatusCondition(filter types.ReceiptFilter) (string, []any, error) {
+	switch filter.Status {
+	case "":
+		return "r.status = $1", []any{types.ReceiptStatusActive}, nil
+	case "all":
+		return "true", nil, nil
+	case types.ReceiptStatusActive, types.ReceiptStatusVoided:
+		return "r.status = $1", []any{filter.Status}, nil
+	}
+	return "", nil, newValidationError("unknown receipt status %q", filter.Status)
+}
+
+// queryFullReceipts собирает чеки со строками и возвратами по условию where на таблицу Receipt as r
+func (db *DB) queryFullReceipts(where string, args ...any) ([]types.FullReceiptInfoResponse, error) {
 	query := `
 	select
 	e.first_name,
 	e.last_name,
 	e.middle_name,
 	r.id,
-	r.number,
+	r.status,
+	coalesce(r.void_reason, ''),
+	coalesce(r.number, 0),
+	coalesce(r.printed_number, ''),
 	r.date_time,
 	r.total_amount,
-	lc.number
+	coalesce(lc.number, 0),
+	coalesce(r.shift_id, 0),
+	coalesce(sh.register, '')
 	from Receipt as r
 	join Employee as e on e.id = r.employee_id
-	join Loyalty_Card as lc on lc.id = r.loyalty_card_id
+	left join Loyalty_Card as lc on lc.id = r.loyalty_card_id
+	left join Shift as sh on sh.id = r.shift_id
+	where ` + where + `
 	order by r.id
 	`
 	var receipts []types.FullReceiptInfoResponse
 
-	rows, err := db.db.Query(query)
+	rows, err := db.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("GetFullReceiptInfo: %v", err)
+		return nil, fmt.Errorf("queryFullReceipts: %v", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var receipt types.FullReceiptInfoResponse
-		if err := rows.Scan(&receipt.TellerFirstName, &receipt.TellerLastName, &receipt.TellerMiddleName, &receipt.ID, &receipt.Number, &receipt.Date, &receipt.Total, &receipt.LoyaltyCardNumber); err != nil {
-			return nil, fmt.Errorf("GetFullReceiptInfo: %v", err)
+		if err := rows.Scan(&receipt.TellerFirstName, &receipt.TellerLastName, &receipt.TellerMiddleName, &receipt.ID, &receipt.Status, &receipt.VoidReason, &receipt.Number, &receipt.PrintedNumber, &receipt.Date, &receipt.Total, &receipt.LoyaltyCardNumber, &receipt.ShiftID, &receipt.Register); err != nil {
+			return nil, fmt.Errorf("queryFullReceipts: %v", err)
 		}
 		receipts = append(receipts, receipt)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("GetFullReceiptInfo: %v", err)
+		return nil, fmt.Errorf("queryFullReceipts: %v", err)
 	}
 
 	var wg sync.WaitGroup
@@ -323,11 +540,28 @@ func (db *DB) GetFullReceiptInfo() ([]types.FullReceiptInfoResponse, error) {
 
 			products, err := db.getReceiptProductByProductID(receipts[i].ID)
 			if err != nil {
-				errChan <- fmt.Errorf("GetFullReceiptInfo: %v", err)
+				errChan <- fmt.Errorf("queryFullReceipts: %v", err)
+				return
+			}
+			payments, err := db.getReceiptPayments(receipts[i].ID)
+			if err != nil {
+				errChan <- fmt.Errorf("queryFullReceipts: %v", err)
+				return
+			}
+			returns, err := db.getReceiptReturnsByReceiptID(receipts[i].ID)
+			if err != nil {
+				errChan <- fmt.Errorf("queryFullReceipts: %v", err)
 				return
 			}
 			mu.Lock()
 			receipts[i].Products = products
+			receipts[i].Taxes = receiptProductTaxes(products)
+			receipts[i].Payments = payments
+			receipts[i].Returns = returns
+			for _, receiptReturn := range returns {
+				receipts[i].RefundedTotal += receiptReturn.Total
+			}
+			receipts[i].NetTotal = receipts[i].Total + receipts[i].RefundedTotal
 			mu.Unlock()
 		}(i)
 	}
@@ -342,28 +576,59 @@ func (db *DB) GetFullReceiptInfo() ([]types.FullReceiptInfoResponse, error) {
 	return receipts, nil
 }
 
-func (db *DB) GetFullSupplierOrderInfo() ([]types.FullSupplierOrderInfoResponse, error) {
+// GetReceipt чек со строками, оплатами и возвратами в любом статусе
+func (db *DB) GetReceipt(receiptID int64) (types.FullReceiptInfoResponse, error) {
+	receipt, err := db.getFullReceipt(receiptID)
+	if err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("GetReceipt: %w", err)
+	}
+	return receipt, nil
+}
+
+func (db *DB) getFullReceipt(receiptID int64) (types.FullReceiptInfoResponse, error) {
+	receipts, err := db.queryFullReceipts("r.id = $1", receiptID)
+	if err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("getFullReceipt: %v", err)
+	}
+	if len(receipts) == 0 {
+		return types.FullReceiptInfoResponse{}, newNotFoundError("receipt %d not found", receiptID)
+	}
+	return receipts[0], nil
+}
+
+// GetFullSupplierOrderInfo пустой statuses возвращает заказы во всех статусах
+func (db *DB) GetFullSupplierOrderInfo(statuses []string) ([]types.FullSupplierOrderInfoResponse, error) {
 	query := `
 	select
 	so.order_date,
 	so.date_of_receipt,
 	so.id,
+	so.status,
+	so.currency,
+	so.exchange_rate,
 	so.total_amount,
 	s.name
  	from Supplier_Order as so
  	join Supplier as s on so.supplier_id = s.id
+ 	where $1::text[] is null or so.status = any($1)
  	order by so.id`
 	var supplierOrders []types.FullSupplierOrderInfoResponse
 	var nt sql.NullTime
 
-	rows, err := db.db.Query(query)
+	for _, status := range statuses {
+		if !isSupplierOrderStatus(status) {
+			return nil, newValidationError("unknown supplier order status %q", status)
+		}
+	}
+
+	rows, err := db.db.Query(query, pq.Array(statuses))
 	if err != nil {
 		return nil, fmt.Errorf("GetFullSupplierOrderInfo: %v", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var supplier types.FullSupplierOrderInfoResponse
-		if err := rows.Scan(&supplier.OrderDate, &nt, &supplier.ID, &supplier.Total, &supplier.SupplierName); err != nil {
+		if err := rows.Scan(&supplier.OrderDate, &nt, &supplier.ID, &supplier.Status, &supplier.Currency, &supplier.ExchangeRate, &supplier.Total, &supplier.SupplierName); err != nil {
 			return nil, fmt.Errorf("GetFullSupplierOrderInfo: %v", err)
 		}
 		if nt.Valid {
@@ -392,6 +657,7 @@ func (db *DB) GetFullSupplierOrderInfo() ([]types.FullSupplierOrderInfoResponse,
 			}
 			mu.Lock()
 			supplierOrders[i].SupplierOrderItems = items
+			supplierOrders[i].BaseTotal = supplierOrderBaseTotal(items)
 			mu.Unlock()
 		}(i)
 	}
@@ -409,10 +675,11 @@ func (db *DB) GetFullSupplierOrderInfo() ([]types.FullSupplierOrderInfoResponse,
 func (db *DB) getSupplierOrderItemByOrderID(orderID int64) ([]types.SupplierOrderItemResponse, error) {
 	var supplierOrderItems []types.SupplierOrderItemResponse
 	query := `
-		SELECT p.name, soi.quantity, soi.purchase_price
+		SELECT soi.id, p.name, soi.quantity, soi.received_quantity, soi.purchase_price, soi.base_purchase_price
 		FROM Supplier_Order_Items as soi
 		JOIN Product as p ON soi.product_id = p.id
 		WHERE soi.order_id = $1
+		ORDER BY soi.id
 	`
 
 	rows, err := db.db.Query(query, orderID)
@@ -423,10 +690,11 @@ func (db *DB) getSupplierOrderItemByOrderID(orderID int64) ([]types.SupplierOrde
 
 	for rows.Next() {
 		var supplierOrderItem types.SupplierOrderItemResponse
-		if err := rows.Scan(&supplierOrderItem.ProductName, &supplierOrderItem.Quantity, &supplierOrderItem.Price); err != nil {
+		if err := rows.Scan(&supplierOrderItem.ID, &supplierOrderItem.ProductName, &supplierOrderItem.Quantity, &supplierOrderItem.ReceivedQuantity, &supplierOrderItem.Price, &supplierOrderItem.BasePrice); err != nil {
 			return nil, err
 		}
-		supplierOrderItem.Amount = supplierOrderItem.Price * float64(supplierOrderItem.Quantity)
+		supplierOrderItem.Amount = supplierOrderItem.Price.Mul(int64(supplierOrderItem.Quantity))
+		supplierOrderItem.BaseAmount = supplierOrderItem.BasePrice.Mul(int64(supplierOrderItem.Quantity))
 		supplierOrderItems = append(supplierOrderItems, supplierOrderItem)
 	}
 
@@ -436,10 +704,12 @@ func (db *DB) getSupplierOrderItemByOrderID(orderID int64) ([]types.SupplierOrde
 func (db *DB) getReceiptProductByProductID(receiptID int64) ([]types.ReceiptProductResponse, error) {
 	var products []types.ReceiptProductResponse
 	query := `
-		SELECT p.name, rp.quantity, rp.amount, rp.price_at_purchase
+		SELECT rp.id, p.name, rp.quantity, rp.amount, rp.price_at_purchase, rp.discount_amount, rp.promotion_id, rp.promotion_discount, rp.vat_rate, rp.vat_amount,
+		       coalesce((SELECT sum(rrp.quantity) FROM Receipt_Return_Product as rrp WHERE rrp.receipt_product_id = rp.id), 0)
 		FROM Receipt_Product as rp
 		JOIN Product as p ON rp.product_id = p.id
 		WHERE rp.receipt_id = $1
+		ORDER BY rp.id
 	`
 
 	rows, err := db.db.Query(query, receiptID)
@@ -450,19 +720,27 @@ func (db *DB) getReceiptProductByProductID(receiptID int64) ([]types.ReceiptProd
 
 	for rows.Next() {
 		var receiptProduct types.ReceiptProductResponse
-		if err := rows.Scan(&receiptProduct.Name, &receiptProduct.Quantity, &receiptProduct.Amount, &receiptProduct.Price); err != nil {
+		var promotionID sql.NullInt64
+		var vatRate sql.NullFloat64
+		if err := rows.Scan(&receiptProduct.ID, &receiptProduct.Name, &receiptProduct.Quantity, &receiptProduct.Amount, &receiptProduct.Price, &receiptProduct.Discount, &promotionID, &receiptProduct.PromotionDiscount, &vatRate, &receiptProduct.VatAmount, &receiptProduct.ReturnedQuantity); err != nil {
 			return nil, err
 		}
+		if vatRate.Valid {
+			receiptProduct.VatRate = &vatRate.Float64
+		}
+		if promotionID.Valid {
+			receiptProduct.PromotionID = &promotionID.Int64
+		}
 		products = append(products, receiptProduct)
 	}
 
 	return products, nil
 }
 
-func (db *DB) insertSupplierOrder(tx *sql.Tx, supplierOrderInfo types.SupplierOrderInfoRequest) (int64, error) {
+func (db *DB) insertSupplierOrder(tx *sql.Tx, supplierOrderInfo types.SupplierOrderInfoRequest, currency string, rate float64) (int64, error) {
 	var supplierOrderID int64
-	err := tx.QueryRow("insert into Supplier_Order (total_amount, supplier_id) values ($1, $2) returning id",
-		0, supplierOrderInfo.SupplierID,
+	err := tx.QueryRow("insert into Supplier_Order (total_amount, supplier_id, status, currency, exchange_rate) values ($1, $2, $3, $4, $5) returning id",
+		0, supplierOrderInfo.SupplierID, types.SupplierOrderStatusDraft, currency, rate,
 	).Scan(&supplierOrderID)
 	if err != nil {
 		return 0, fmt.Errorf("insertSupplierOrder: %v", err)
@@ -470,9 +748,9 @@ func (db *DB) insertSupplierOrder(tx *sql.Tx, supplierOrderInfo types.SupplierOr
 	return supplierOrderID, nil
 }
 
-func (db *DB) insertSupplierOrderItem(tx *sql.Tx, supplierOrderItem types.SupplierOrderItemInfoRequest, orderID int64) error {
-	_, err := tx.Exec("insert into Supplier_Order_Items (purchase_price, quantity, product_id, order_id) values ($1, $2, $3, $4)",
-		supplierOrderItem.Price, supplierOrderItem.Quantity, supplierOrderItem.ProductID, orderID)
+func (db *DB) insertSupplierOrderItem(tx *sql.Tx, supplierOrderItem types.SupplierOrderItemInfoRequest, orderID int64, rate float64) error {
+	_, err := tx.Exec("insert into Supplier_Order_Items (purchase_price, base_purchase_price, quantity, product_id, order_id) values ($1, $2, $3, $4, $5)",
+		supplierOrderItem.Price, supplierOrderItem.Price.Convert(rate), supplierOrderItem.Quantity, supplierOrderItem.ProductID, orderID)
 	return err
 }
 
@@ -519,25 +797,33 @@ func (db *DB) getEmployeeByPosition(position string) ([]types.Employee, error) {
 	return employees, nil
 }
 
-func (db *DB) insertReceipt(tx *sql.Tx, receipt types.ReceiptInfoRequest) (int64, error) {
+// insertReceipt пустой date означает время сервера
+func (db *DB) insertReceipt(tx *sql.Tx, tellerID int64, loyaltyCardID sql.NullInt64, shiftID int64, total types.Money, number int, printedNumber string,
+	date sql.NullTime, clientUUID sql.NullString) (int64, time.Time, error) {
 	var receiptID int64
-	var loyaltyCardId any
-
-	if receipt.LoyaltyCardNumber == 0 {
-		loyaltyCardId = nil
-	} else {
-		loyaltyCardId = receipt.LoyaltyCardNumber
-	}
+	var dateTime time.Time
 
 	err := tx.QueryRow(
-		"insert into Receipt (total_amount, employee_id, loyalty_card_id) values ($1, $2, $3) returning id",
-		0, receipt.TellerID, loyaltyCardId,
-	).Scan(&receiptID)
-	return receiptID, err
+		`insert into Receipt (total_amount, employee_id, loyalty_card_id, shift_id, number, printed_number, date_time, client_uuid)
+		values ($1, $2, $3, $4, $5, $6, coalesce($7::timestamp, now()), $8) returning id, date_time`,
+		total, tellerID, loyaltyCardID, shiftID, number, printedNumber, date, clientUUID,
+	).Scan(&receiptID, &dateTime)
+	return receiptID, dateTime, err
 }
 
-func (db *DB) insertReceiptProduct(tx *sql.Tx, receiptProduct types.ReceiptProductInfoRequest, receiptID int64) error {
-	_, err := tx.Exec("insert into Receipt_Product (receipt_id, product_id, quantity, amount, price_at_purchase) values ($1, $2, $3, $4, $5)",
-		receiptID, receiptProduct.ProductID, receiptProduct.Quantity, receiptProduct.Amount, receiptProduct.Price)
+func (db *DB) insertReceiptProduct(tx *sql.Tx, line receiptLine, receiptID int64) error {
+	var promotionID int64
+	if line.promotion != nil {
+		promotionID = line.promotion.id
+	}
+	var expectedPrice, expectedAmount *types.Money
+	if line.expected != nil {
+		expectedPrice, expectedAmount = &line.expected.price, &line.expected.amount
+	}
+	_, err := tx.Exec(`insert into Receipt_Product (receipt_id, product_id, quantity, amount, price_at_purchase, discount_amount, promotion_id, promotion_discount,
+	vat_rate, vat_amount, expected_price, expected_amount)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		receiptID, line.productID, line.quantity, line.amount, line.price, line.discount, nullID(promotionID), line.promotionDiscount,
+		line.vatRate, line.vatAmount, expectedPrice, expectedAmount)
 	return err
 }
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"db5/config"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMockDB(t *testing.T) (*DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	return &DB{db: conn, receiptNumbering: config.ReceiptNumberingConfig{
+		Scope:           config.ReceiptNumberScopeDay,
+		Format:          "{register}-{date}-{counter:4}",
+		DefaultRegister: "1",
+	}}, mock
+}
+
+// hasErrorType есть ли в цепочке err ошибка того же типа, что и target
+func hasErrorType(err, target error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if reflect.TypeOf(err) == reflect.TypeOf(target) {
+			return true
+		}
+	}
+	return false
+}
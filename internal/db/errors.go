@@ -0,0 +1,78 @@
+package db
+
+import (
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ValidationError ошибка в данных запроса, которую клиент может исправить сам
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func newValidationError(format string, args ...any) *ValidationError {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+// PriceMismatchError цены или суммы, присланные кассой, не совпадают с рассчитанными на сервере
+type PriceMismatchError struct {
+	Items []types.PriceMismatchResponse
+}
+
+func (e *PriceMismatchError) Error() string {
+	return fmt.Sprintf("price mismatch for %d product(s)", len(e.Items))
+}
+
+// InsufficientStockError продажа уводит остаток товаров в минус
+type InsufficientStockError struct {
+	Items []types.InsufficientStockResponse
+}
+
+func (e *InsufficientStockError) Error() string {
+	ids := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		ids[i] = strconv.FormatInt(item.ProductID, 10)
+	}
+	return fmt.Sprintf("insufficient stock for products: %s", strings.Join(ids, ", "))
+}
+
+type NotFoundError struct {
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
+
+func newNotFoundError(format string, args ...any) *NotFoundError {
+	return &NotFoundError{Message: fmt.Sprintf(format, args...)}
+}
+
+// ConflictError операция противоречит текущему состоянию документа
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+func newConflictError(format string, args ...any) *ConflictError {
+	return &ConflictError{Message: fmt.Sprintf(format, args...)}
+}
+
+// isUniqueViolation ошибка нарушения уникального индекса. Проверка перед вставкой не спасает
+// от параллельного запроса, поэтому такую ошибку тоже нужно переводить в ConflictError.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,355 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/fiscal"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const fiscalDocumentColumns = `
+	id, receipt_id, document_type, document_id, register, number, format, payload, prev_hash, hash,
+	status, attempts, coalesce(last_error, ''), created_at, sent_at`
+
+func scanFiscalDocument(row rowScanner) (types.FiscalDocumentResponse, error) {
+	var doc types.FiscalDocumentResponse
+	var sentAt sql.NullTime
+	err := row.Scan(&doc.ID, &doc.ReceiptID, &doc.DocumentType, &doc.DocumentID, &doc.Register, &doc.Number, &doc.Format, &doc.Payload, &doc.PrevHash, &doc.Hash,
+		&doc.Status, &doc.Attempts, &doc.LastError, &doc.CreatedAt, &sentAt)
+	if sentAt.Valid {
+		doc.SentAt = &sentAt.Time
+	}
+	return doc, err
+}
+
+func (db *DB) queryFiscalDocuments(where string, args ...any) ([]types.FiscalDocumentResponse, error) {
+	rows, err := db.db.Query("select"+fiscalDocumentColumns+" from Fiscal_Document where "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []types.FiscalDocumentResponse{}
+	for rows.Next() {
+		doc, err := scanFiscalDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+type fiscalOperation struct {
+	documentType string
+	documentID   int64
+	receiptID    int64
+}
+
+// EnqueueFiscalDocuments чек, аннулированный до выгрузки продажи, не выгружается вовсе,
+// аннулирование выгружается только после документа продажи
+func (db *DB) EnqueueFiscalDocuments(limit int) (int, error) {
+	rows, err := db.db.Query(`
+	select e.document_type, e.document_id, e.receipt_id from (
+		select $1::varchar as document_type, r.id as document_id, r.id as receipt_id, r.date_time as happened_at
+		from Receipt as r where r.status = $4
+		union all
+		select $2::varchar, rr.id, rr.receipt_id, rr.date_time from Receipt_Return as rr
+		union all
+		select $3::varchar, r.id, r.id, r.voided_at from Receipt as r
+		where r.status = $5
+		and exists (select 1 from Fiscal_Document as fd where fd.document_type = $1 and fd.document_id = r.id)
+	) as e
+	where not exists (select 1 from Fiscal_Document as fd where fd.document_type = e.document_type and fd.document_id = e.document_id)
+	order by e.happened_at, e.document_id
+	limit $6`,
+		types.FiscalDocumentReceipt, types.FiscalDocumentReturn, types.FiscalDocumentVoid,
+		types.ReceiptStatusActive, types.ReceiptStatusVoided, limit)
+	if err != nil {
+		return 0, fmt.Errorf("EnqueueFiscalDocuments: %v", err)
+	}
+	var operations []fiscalOperation
+	for rows.Next() {
+		var op fiscalOperation
+		if err := rows.Scan(&op.documentType, &op.documentID, &op.receiptID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("EnqueueFiscalDocuments: %v", err)
+		}
+		operations = append(operations, op)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("EnqueueFiscalDocuments: %v", err)
+	}
+
+	added := 0
+	for _, op := range operations {
+		ok, err := db.enqueueFiscalDocument(op)
+		if err != nil {
+			return added, fmt.Errorf("EnqueueFiscalDocuments: %v", err)
+		}
+		if ok {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// fiscalOperationHeader аннулирование идет в смене чека, возврат — в смене возвращающего кассира
+func (db *DB) fiscalOperationHeader(op fiscalOperation, receipt types.FullReceiptInfoResponse) (fiscal.Header, error) {
+	switch op.documentType {
+	case types.FiscalDocumentReceipt:
+		return db.fiscalHeader(receipt.ShiftID, receipt.Register,
+			fiscal.OperatorName(receipt.TellerLastName, receipt.TellerFirstName, receipt.TellerMiddleName))
+
+	case types.FiscalDocumentVoid:
+		var supervisorID int64
+		if err := db.db.QueryRow("select voided_by from Receipt where id = $1", receipt.ID).Scan(&supervisorID); err != nil {
+			return fiscal.Header{}, err
+		}
+		operator, err := db.employeeName(supervisorID)
+		if err != nil {
+			return fiscal.Header{}, err
+		}
+		return db.fiscalHeader(receipt.ShiftID, receipt.Register, operator)
+
+	case types.FiscalDocumentReturn:
+		var tellerID int64
+		var shiftID sql.NullInt64
+		var register string
+		err := db.db.QueryRow(`
+		select rr.employee_id, rr.shift_id, coalesce(sh.register, '') from Receipt_Return as rr
+		left join Shift as sh on sh.id = rr.shift_id
+		where rr.id = $1`, op.documentID).Scan(&tellerID, &shiftID, &register)
+		if err != nil {
+			return fiscal.Header{}, err
+		}
+		operator, err := db.employeeName(tellerID)
+		if err != nil {
+			return fiscal.Header{}, err
+		}
+		return db.fiscalHeader(shiftID.Int64, register, operator)
+	}
+	return fiscal.Header{}, fmt.Errorf("unknown fiscal document type %q", op.documentType)
+}
+
+func (db *DB) buildFiscalDocument(op fiscalOperation, receipt types.FullReceiptInfoResponse, header fiscal.Header, number int64) (fiscal.Document, error) {
+	switch op.documentType {
+	case types.FiscalDocumentReceipt:
+		return fiscal.Build(receipt, db.store, header, number)
+
+	case types.FiscalDocumentVoid:
+		var voidedAt time.Time
+		if err := db.db.QueryRow("select voided_at from Receipt where id = $1", receipt.ID).Scan(&voidedAt); err != nil {
+			return fiscal.Document{}, err
+		}
+		return fiscal.BuildVoid(receipt, voidedAt, db.store, header, number)
+
+	case types.FiscalDocumentReturn:
+		for _, ret := range receipt.Returns {
+			if ret.ID == op.documentID {
+				return fiscal.BuildReturn(receipt, ret, db.store, header, number)
+			}
+		}
+		return fiscal.Document{}, fmt.Errorf("return %d not found in receipt %d", op.documentID, receipt.ID)
+	}
+	return fiscal.Document{}, fmt.Errorf("unknown fiscal document type %q", op.documentType)
+}
+
+// fiscalHeader номер смены — порядковый среди смен кассы, а не id смены
+func (db *DB) fiscalHeader(shiftID int64, register, operator string) (fiscal.Header, error) {
+	if register == "" {
+		register = db.receiptNumbering.DefaultRegister
+	}
+	header := fiscal.Header{Register: register, Operator: operator}
+	if shiftID == 0 {
+		return header, nil
+	}
+	err := db.db.QueryRow("select count(*) from Shift where register = $1 and id <= $2", register, shiftID).Scan(&header.ShiftNumber)
+	if err != nil {
+		return fiscal.Header{}, err
+	}
+	return header, nil
+}
+
+func (db *DB) employeeName(employeeID int64) (string, error) {
+	var lastName, firstName, middleName string
+	err := db.db.QueryRow("select last_name, first_name, coalesce(middle_name, '') from Employee where id = $1", employeeID).
+		Scan(&lastName, &firstName, &middleName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", newNotFoundError("employee %d not found", employeeID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fiscal.OperatorName(lastName, firstName, middleName), nil
+}
+
+// enqueueFiscalDocument добавляет документ операции в конец цепочки ее кассы.
+// Строка Fiscal_Chain держится заблокированной до коммита, поэтому номера и хеши кассы
+// идут подряд даже при нескольких экземплярах приложения. false — документ уже добавлен другим.
+func (db *DB) enqueueFiscalDocument(op fiscalOperation) (bool, error) {
+	receipt, err := db.getFullReceipt(op.receiptID)
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %w", err)
+	}
+	header, err := db.fiscalOperationHeader(op, receipt)
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %s %d: %w", op.documentType, op.documentID, err)
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %v", err)
+	}
+	defer tx.Rollback()
+
+	var lastNumber int64
+	var lastHash string
+	err = tx.QueryRow(`
+	insert into Fiscal_Chain (register, last_number, last_hash) values ($1, 0, $2)
+	on conflict (register) do update set register = excluded.register
+	returning last_number, last_hash`, header.Register, fiscal.GenesisHash).Scan(&lastNumber, &lastHash)
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %v", err)
+	}
+
+	var exists bool
+	err = tx.QueryRow("select exists (select 1 from Fiscal_Document where document_type = $1 and document_id = $2)",
+		op.documentType, op.documentID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %v", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	number := lastNumber + 1
+	doc, err := db.buildFiscalDocument(op, receipt, header, number)
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %v", err)
+	}
+	payload, err := fiscal.Encode(doc, db.fiscalFormat)
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %v", err)
+	}
+	hash := fiscal.ChainHash(lastHash, payload)
+
+	_, err = tx.Exec(`
+	insert into Fiscal_Document (receipt_id, document_type, document_id, register, number, format, payload, prev_hash, hash, status)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		op.receiptID, op.documentType, op.documentID, header.Register, number, db.fiscalFormat, string(payload), lastHash, hash, types.FiscalStatusQueued)
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %v", err)
+	}
+
+	_, err = tx.Exec("update Fiscal_Chain set last_number = $1, last_hash = $2 where register = $3", number, hash, header.Register)
+	if err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("enqueueFiscalDocument: %v", err)
+	}
+	return true, nil
+}
+
+func (db *DB) GetFiscalQueue(limit int) ([]types.FiscalDocumentResponse, error) {
+	docs, err := db.queryFiscalDocuments("status in ($1, $2) order by id limit $3",
+		types.FiscalStatusQueued, types.FiscalStatusFailed, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetFiscalQueue: %v", err)
+	}
+	return docs, nil
+}
+
+func (db *DB) MarkFiscalDocumentSent(documentID int64) error {
+	_, err := db.db.Exec("update Fiscal_Document set status = $1, attempts = attempts + 1, last_error = null, sent_at = now() where id = $2",
+		types.FiscalStatusSent, documentID)
+	if err != nil {
+		return fmt.Errorf("MarkFiscalDocumentSent: %v", err)
+	}
+	return nil
+}
+
+func (db *DB) MarkFiscalDocumentFailed(documentID int64, sendErr string) error {
+	_, err := db.db.Exec("update Fiscal_Document set status = $1, attempts = attempts + 1, last_error = $2 where id = $3",
+		types.FiscalStatusFailed, sendErr, documentID)
+	if err != nil {
+		return fmt.Errorf("MarkFiscalDocumentFailed: %v", err)
+	}
+	return nil
+}
+
+func (db *DB) GetFiscalDocuments(status string) ([]types.FiscalDocumentResponse, error) {
+	switch status {
+	case "", types.FiscalStatusQueued, types.FiscalStatusSent, types.FiscalStatusFailed:
+	default:
+		return nil, newValidationError("unknown fiscal document status %q", status)
+	}
+
+	docs, err := db.queryFiscalDocuments("$1 = '' or status = $1 order by id", status)
+	if err != nil {
+		return nil, fmt.Errorf("GetFiscalDocuments: %v", err)
+	}
+	return docs, nil
+}
+
+func (db *DB) GetReceiptFiscalDocuments(receiptID int64) ([]types.FiscalDocumentResponse, error) {
+	docs, err := db.queryFiscalDocuments("receipt_id = $1 order by id", receiptID)
+	if err != nil {
+		return nil, fmt.Errorf("GetReceiptFiscalDocuments: %v", err)
+	}
+	if len(docs) == 0 {
+		return nil, newNotFoundError("fiscal documents for receipt %d not found", receiptID)
+	}
+	return docs, nil
+}
+
+func (db *DB) VerifyFiscalChain(register string) (types.FiscalChainResponse, error) {
+	register = strings.TrimSpace(register)
+	if register == "" {
+		register = db.receiptNumbering.DefaultRegister
+	}
+
+	docs, err := db.queryFiscalDocuments("register = $1 order by number", register)
+	if err != nil {
+		return types.FiscalChainResponse{}, fmt.Errorf("VerifyFiscalChain: %v", err)
+	}
+
+	result := types.FiscalChainResponse{Register: register, Documents: len(docs), Valid: true}
+	if err := fiscal.VerifyChain(docs); err != nil {
+		var chainErr *fiscal.ChainError
+		if !errors.As(err, &chainErr) {
+			return types.FiscalChainResponse{}, fmt.Errorf("VerifyFiscalChain: %v", err)
+		}
+		result.Valid = false
+		result.BrokenAt = &chainErr.Number
+		result.Error = chainErr.Reason
+		return result, nil
+	}
+
+	// Удаление документов с конца цепочки видно только по последнему хешу кассы
+	var lastNumber int64
+	var lastHash string
+	err = db.db.QueryRow("select last_number, last_hash from Fiscal_Chain where register = $1", register).Scan(&lastNumber, &lastHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		lastHash = fiscal.GenesisHash
+	} else if err != nil {
+		return types.FiscalChainResponse{}, fmt.Errorf("VerifyFiscalChain: %v", err)
+	}
+	tailHash := fiscal.GenesisHash
+	if len(docs) > 0 {
+		tailHash = docs[len(docs)-1].Hash
+	}
+	if int64(len(docs)) != lastNumber || tailHash != lastHash {
+		broken := int64(len(docs)) + 1
+		result.Valid = false
+		result.BrokenAt = &broken
+		result.Error = "documents at the end of the chain are missing or altered"
+	}
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"db5/internal/fiscal"
+	"db5/internal/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// fiscalChainRows документы кассы 1 с телами payloads, подписанные цепочкой
+func fiscalChainRows(payloads ...string) (*sqlmock.Rows, string) {
+	rows := sqlmock.NewRows([]string{"id", "receipt_id", "document_type", "document_id", "register", "number", "format", "payload", "prev_hash", "hash",
+		"status", "attempts", "last_error", "created_at", "sent_at"})
+	prevHash := fiscal.GenesisHash
+	for i, payload := range payloads {
+		hash := fiscal.ChainHash(prevHash, []byte(payload))
+		rows.AddRow(i+1, i+1, "receipt", i+1, "1", i+1, fiscal.FormatJSON, payload, prevHash, hash, "queued", 0, "", time.Now(), nil)
+		prevHash = hash
+	}
+	return rows, prevHash
+}
+
+func TestVerifyFiscalChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		lastNumber int64
+		lastHash   func(tail string) string
+		wantValid  bool
+	}{
+		{name: "intact", lastNumber: 2, lastHash: func(tail string) string { return tail }, wantValid: true},
+		{name: "tail removed", lastNumber: 3, lastHash: func(string) string { return "f00d" }, wantValid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			rows, tail := fiscalChainRows(`{"n":1}`, `{"n":2}`)
+			mock.ExpectQuery(`from Fiscal_Document where register = \$1`).WithArgs("1").WillReturnRows(rows)
+			mock.ExpectQuery(`select last_number, last_hash from Fiscal_Chain`).WithArgs("1").
+				WillReturnRows(sqlmock.NewRows([]string{"last_number", "last_hash"}).AddRow(tt.lastNumber, tt.lastHash(tail)))
+
+			got, err := db.VerifyFiscalChain(" ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Register != "1" || got.Documents != 2 || got.Valid != tt.wantValid {
+				t.Errorf("VerifyFiscalChain() = %+v, want register 1, 2 documents, valid %v", got, tt.wantValid)
+			}
+			if !tt.wantValid && (got.BrokenAt == nil || *got.BrokenAt != 3) {
+				t.Errorf("BrokenAt = %v, want 3", got.BrokenAt)
+			}
+		})
+	}
+}
+
+func TestVerifyFiscalChainAlteredPayload(t *testing.T) {
+	db, mock := newMockDB(t)
+	altered := sqlmock.NewRows([]string{"id", "receipt_id", "document_type", "document_id", "register", "number", "format", "payload", "prev_hash", "hash",
+		"status", "attempts", "last_error", "created_at", "sent_at"})
+	hash1 := fiscal.ChainHash(fiscal.GenesisHash, []byte(`{"n":1}`))
+	altered.AddRow(1, 1, "receipt", 1, "1", 1, fiscal.FormatJSON, `{"n":1,"x":1}`, fiscal.GenesisHash, hash1, "queued", 0, "", time.Now(), nil)
+	mock.ExpectQuery(`from Fiscal_Document where register = \$1`).WithArgs("K2").WillReturnRows(altered)
+
+	got, err := db.VerifyFiscalChain("K2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Valid || got.BrokenAt == nil || *got.BrokenAt != 1 {
+		t.Errorf("VerifyFiscalChain() = %+v, want broken at 1", got)
+	}
+}
+
+func TestGetFiscalDocumentsUnknownStatus(t *testing.T) {
+	db, _ := newMockDB(t)
+	_, err := db.GetFiscalDocuments("lost")
+	if !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("GetFiscalDocuments() error = %v, want ValidationError", err)
+	}
+}
+
+func TestFiscalOperationHeaderReturn(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`from Receipt_Return as rr\s+left join Shift as sh on sh.id = rr.shift_id\s+where rr.id = \$1`).WithArgs(int64(40)).
+		WillReturnRows(sqlmock.NewRows([]string{"employee_id", "shift_id", "register"}).AddRow(4, 9, "K2"))
+	mock.ExpectQuery(`select last_name, first_name, coalesce\(middle_name, ''\) from Employee where id = \$1`).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"last_name", "first_name", "middle_name"}).AddRow("Петрова", "Анна", ""))
+	mock.ExpectQuery(`select count\(\*\) from Shift where register = \$1 and id <= \$2`).WithArgs("K2", int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	// Возврат пробит на другой кассе, чем продажа
+	receipt := types.FullReceiptInfoResponse{ID: 5, ShiftID: 8, Register: "1"}
+	got, err := db.fiscalOperationHeader(fiscalOperation{documentType: types.FiscalDocumentReturn, documentID: 40, receiptID: 5}, receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fiscal.Header{Register: "K2", ShiftNumber: 3, Operator: "Петрова Анна"}
+	if got != want {
+		t.Errorf("fiscalOperationHeader() = %+v, want %+v", got, want)
+	}
+}
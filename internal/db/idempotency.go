@@ -0,0 +1,69 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// idempotencyKeyRetention сколько хранится ответ. Старый ключ можно использовать заново.
+const idempotencyKeyRetention = 24 * time.Hour
+
+// idempotencyKeyLease сколько первый запрос может выполняться. Ключ без ответа дольше этого срока
+// брошен упавшим процессом, и результат операции неизвестен.
+const idempotencyKeyLease = time.Minute
+
+// BeginIdempotentRequest занимает ключ за запросом. nil без ошибки — ключ новый и запрос надо выполнить,
+// иначе возвращается сохраненный ответ. ConflictError — ключ уже занят запросом с другим телом,
+// первый запрос с этим ключом еще выполняется или брошен без ответа после idempotencyKeyLease.
+func (db *DB) BeginIdempotentRequest(scope, key, requestHash string) (*types.StoredResponse, error) {
+	var inserted string
+	err := db.db.QueryRow(`
+	insert into Idempotency_Key (scope, key, request_hash) values ($1, $2, $3)
+	on conflict (scope, key) do update
+	set request_hash = excluded.request_hash, status_code = null, content_type = '', response = null, created_at = now(), started_at = now()
+	where Idempotency_Key.created_at < now() - $4 * interval '1 second'
+	returning key`, scope, key, requestHash, idempotencyKeyRetention.Seconds()).Scan(&inserted)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("BeginIdempotentRequest: %v", err)
+	}
+
+	var storedHash string
+	var statusCode sql.NullInt64
+	var response types.StoredResponse
+	var abandoned bool
+	err = db.db.QueryRow(`
+	select request_hash, status_code, content_type, response, started_at < now() - $3 * interval '1 second'
+	from Idempotency_Key where scope = $1 and key = $2`,
+		scope, key, idempotencyKeyLease.Seconds()).Scan(&storedHash, &statusCode, &response.ContentType, &response.Body, &abandoned)
+	if err != nil {
+		return nil, fmt.Errorf("BeginIdempotentRequest: %v", err)
+	}
+
+	if storedHash != requestHash {
+		return nil, newConflictError("idempotency key %q was already used with a different request body", key)
+	}
+	if !statusCode.Valid && abandoned {
+		return nil, newConflictError("outcome of request with idempotency key %q is unknown, check the result before retrying with a new key", key)
+	}
+	if !statusCode.Valid {
+		return nil, newConflictError("request with idempotency key %q is still in progress", key)
+	}
+	response.StatusCode = int(statusCode.Int64)
+	return &response, nil
+}
+
+// CompleteIdempotentRequest сохраняет ответ для повторов с тем же ключом
+func (db *DB) CompleteIdempotentRequest(scope, key string, response types.StoredResponse) error {
+	_, err := db.db.Exec("update Idempotency_Key set status_code = $1, content_type = $2, response = $3 where scope = $4 and key = $5",
+		response.StatusCode, response.ContentType, response.Body, scope, key)
+	if err != nil {
+		return fmt.Errorf("CompleteIdempotentRequest: %v", err)
+	}
+	return nil
+}
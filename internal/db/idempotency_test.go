@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBeginIdempotentRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		storedHash string
+		statusCode any
+		abandoned  bool
+		wantErr    error
+		wantMsg    string
+	}{
+		{name: "replay", storedHash: "h1", statusCode: http.StatusCreated},
+		{name: "replay after lease", storedHash: "h1", statusCode: http.StatusCreated, abandoned: true},
+		{name: "different body", storedHash: "h2", statusCode: http.StatusCreated, wantErr: &ConflictError{}, wantMsg: "different request body"},
+		{name: "in progress", storedHash: "h1", statusCode: nil, wantErr: &ConflictError{}, wantMsg: "in progress"},
+		{name: "abandoned", storedHash: "h1", statusCode: nil, abandoned: true, wantErr: &ConflictError{}, wantMsg: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectQuery(`insert into Idempotency_Key`).WithArgs("receipt", "k1", "h1", sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+			mock.ExpectQuery(`select request_hash, status_code, content_type, response, started_at < now\(\) - \$3 \* interval '1 second'\s+from Idempotency_Key`).
+				WithArgs("receipt", "k1", idempotencyKeyLease.Seconds()).
+				WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "content_type", "response", "abandoned"}).
+					AddRow(tt.storedHash, tt.statusCode, "application/json", []byte(`{"id":1}`), tt.abandoned))
+
+			got, err := db.BeginIdempotentRequest("receipt", "k1", "h1")
+			if tt.wantErr != nil {
+				if !hasErrorType(err, tt.wantErr) || !strings.Contains(err.Error(), tt.wantMsg) {
+					t.Fatalf("BeginIdempotentRequest() error = %v, want %T with %q", err, tt.wantErr, tt.wantMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || got.StatusCode != http.StatusCreated || string(got.Body) != `{"id":1}` {
+				t.Errorf("BeginIdempotentRequest() = %+v, want stored 201", got)
+			}
+		})
+	}
+}
+
+func TestBeginIdempotentRequestNewKey(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`insert into Idempotency_Key`).WithArgs("receipt", "k1", "h1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("k1"))
+
+	got, err := db.BeginIdempotentRequest("receipt", "k1", "h1")
+	if err != nil || got != nil {
+		t.Errorf("BeginIdempotentRequest() = %v, %v, want nil, nil", got, err)
+	}
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// номера карт — EAN-13 с префиксом 2, который зарезервирован под внутренние коды магазина
+	loyaltyCardPrefix      = 2
+	loyaltyCardIssueTries  = 5
+	loyaltyCardBodyDigits  = 11
+	loyaltyCardNumberRange = 100_000_000_000 // 10^loyaltyCardBodyDigits
+)
+
+// IssueLoyaltyCard выпускает карту со сгенерированным номером
+func (db *DB) IssueLoyaltyCard() (types.LoyaltyCardResponse, error) {
+	for range loyaltyCardIssueTries {
+		number, err := generateLoyaltyCardNumber()
+		if err != nil {
+			return types.LoyaltyCardResponse{}, fmt.Errorf("IssueLoyaltyCard: %v", err)
+		}
+
+		card, err := db.scanLoyaltyCard(db.db.QueryRow("insert into Loyalty_Card (number) values ($1) on conflict (number) do nothing returning "+loyaltyCardColumns, number))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return types.LoyaltyCardResponse{}, fmt.Errorf("IssueLoyaltyCard: %v", err)
+		}
+		return card, nil
+	}
+	return types.LoyaltyCardResponse{}, fmt.Errorf("IssueLoyaltyCard: could not generate a unique card number")
+}
+
+// GetLoyaltyCard поиск карты по напечатанному на ней номеру
+func (db *DB) GetLoyaltyCard(number int64) (types.LoyaltyCardResponse, error) {
+	card, err := db.scanLoyaltyCard(db.db.QueryRow("select "+loyaltyCardColumns+" from Loyalty_Card where number = $1", number))
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.LoyaltyCardResponse{}, newNotFoundError("loyalty card %d not found", number)
+	}
+	if err != nil {
+		return types.LoyaltyCardResponse{}, fmt.Errorf("GetLoyaltyCard: %v", err)
+	}
+	return card, nil
+}
+
+func (db *DB) SetLoyaltyCardBlocked(number int64, blocked bool) (types.LoyaltyCardResponse, error) {
+	card, err := db.scanLoyaltyCard(db.db.QueryRow("update Loyalty_Card set blocked = $1 where number = $2 returning "+loyaltyCardColumns, blocked, number))
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.LoyaltyCardResponse{}, newNotFoundError("loyalty card %d not found", number)
+	}
+	if err != nil {
+		return types.LoyaltyCardResponse{}, fmt.Errorf("SetLoyaltyCardBlocked: %v", err)
+	}
+	return card, nil
+}
+
+const loyaltyCardColumns = "id, number, blocked, issued_at, tier, customer_id"
+
+// rowScanner общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (db *DB) scanLoyaltyCard(row rowScanner) (types.LoyaltyCardResponse, error) {
+	var card types.LoyaltyCardResponse
+	var tier sql.NullString
+	var customerID sql.NullInt64
+	if err := row.Scan(&card.ID, &card.Number, &card.Blocked, &card.IssuedAt, &tier, &customerID); err != nil {
+		return types.LoyaltyCardResponse{}, err
+	}
+	cardTier := db.tierByName(tier.String)
+	card.Tier = cardTier.name
+	card.DiscountPercent = cardTier.discountPercent
+	if customerID.Valid {
+		card.CustomerID = &customerID.Int64
+	}
+	return card, nil
+}
+
+type receiptCard struct {
+	id   sql.NullInt64
+	tier loyaltyTier
+}
+
+// resolveLoyaltyCard блокирует строку карты, чтобы параллельные чеки не списали одни и те же баллы
+func (db *DB) resolveLoyaltyCard(tx *sql.Tx, number int64) (receiptCard, error) {
+	if number == 0 {
+		return receiptCard{}, nil
+	}
+
+	var cardID int64
+	var blocked bool
+	var tier sql.NullString
+	err := tx.QueryRow("select id, blocked, tier from Loyalty_Card where number = $1 for update", number).Scan(&cardID, &blocked, &tier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return receiptCard{}, newValidationError("loyalty card %d not found", number)
+	}
+	if err != nil {
+		return receiptCard{}, fmt.Errorf("resolveLoyaltyCard: %v", err)
+	}
+	if blocked {
+		return receiptCard{}, newConflictError("loyalty card %d is blocked", number)
+	}
+	return receiptCard{
+		id:   sql.NullInt64{Int64: cardID, Valid: true},
+		tier: db.tierByName(tier.String),
+	}, nil
+}
+
+func generateLoyaltyCardNumber() (int64, error) {
+	body, err := rand.Int(rand.Reader, big.NewInt(loyaltyCardNumberRange))
+	if err != nil {
+		return 0, err
+	}
+	number := int64(loyaltyCardPrefix)*loyaltyCardNumberRange + body.Int64()
+	return number*10 + ean13CheckDigit(number), nil
+}
+
+// ean13CheckDigit контрольная цифра для первых 12 цифр кода
+func ean13CheckDigit(number int64) int64 {
+	var sum int64
+	for i := 0; i < 12; i++ {
+		digit := number % 10
+		number /= 10
+		if i%2 == 0 {
+			sum += digit * 3
+		} else {
+			sum += digit
+		}
+	}
+	return (10 - sum%10) % 10
+}
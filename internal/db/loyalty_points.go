@@ -0,0 +1,230 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"fmt"
+	"slices"
+)
+
+const (
+	pointsKindAccrual    = "accrual"
+	pointsKindRedemption = "redemption"
+	pointsKindReversal   = "reversal"
+	pointsKindRefund     = "refund"
+)
+
+// accruePoints часть чека, оплаченная баллами, в начисление не входит
+func (db *DB) accruePoints(lines []receiptLine, total, paidByPoints types.Money) int64 {
+	if total <= 0 {
+		return 0
+	}
+
+	var accrual types.Money
+	for _, line := range lines {
+		if slices.Contains(db.loyalty.ExcludedCategories, line.category) {
+			continue
+		}
+		multiplier, ok := db.loyalty.CategoryMultipliers[line.category]
+		if !ok {
+			multiplier = 1
+		}
+		accrual += line.amount.Percent(db.loyalty.AccrualPercent * multiplier)
+	}
+	return moneyToPoints(accrual.MulDiv(int64(total-paidByPoints), int64(total)))
+}
+
+// moneyToPoints один балл — один рубль, неполный рубль баллом не становится
+func moneyToPoints(m types.Money) int64 {
+	return int64(m / 100)
+}
+
+// calculateReceiptPoints проверяет оплату баллами и считает баллы за покупку.
+// Возвращает списываемую сумму и количество начисляемых баллов.
+func (db *DB) calculateReceiptPoints(tx *sql.Tx, cardID sql.NullInt64, draft receiptDraft, payments []types.PaymentResponse) (types.Money, int64, error) {
+	var redeemed types.Money
+	for _, payment := range payments {
+		if payment.Method == types.PaymentMethodLoyaltyPoints {
+			redeemed += payment.Amount
+		}
+	}
+
+	if redeemed > 0 {
+		if !cardID.Valid {
+			return 0, 0, newValidationError("loyalty points payment requires a loyalty card")
+		}
+		if redeemed%100 != 0 {
+			return 0, 0, newValidationError("loyalty points can be redeemed only in whole rubles")
+		}
+		balance, err := db.getPointsBalance(tx, cardID.Int64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("calculateReceiptPoints: %v", err)
+		}
+		if balance < int64(redeemed/100) {
+			return 0, 0, newConflictError("not enough loyalty points: balance %d, requested %d", balance, redeemed/100)
+		}
+	}
+
+	if !cardID.Valid {
+		return 0, 0, nil
+	}
+	return redeemed, db.accruePoints(draft.lines, draft.total, redeemed), nil
+}
+
+// recordReceiptPoints записывает в журнал списание и начисление, посчитанные calculateReceiptPoints
+func (db *DB) recordReceiptPoints(tx *sql.Tx, cardID sql.NullInt64, receiptID int64, redeemed types.Money, accrued int64) error {
+	if !cardID.Valid {
+		return nil
+	}
+	if redeemed > 0 {
+		if err := db.insertPointsEntry(tx, cardID.Int64, receiptID, 0, pointsKindRedemption, -int64(redeemed/100)); err != nil {
+			return fmt.Errorf("recordReceiptPoints: %v", err)
+		}
+	}
+	if accrued > 0 {
+		if err := db.insertPointsEntry(tx, cardID.Int64, receiptID, 0, pointsKindAccrual, accrued); err != nil {
+			return fmt.Errorf("recordReceiptPoints: %v", err)
+		}
+	}
+	return nil
+}
+
+// applyReturnPoints баланс может уйти в минус, если покупатель успел потратить начисленные баллы
+func (db *DB) applyReturnPoints(tx *sql.Tx, receiptID, returnID int64, refund types.Money, paymentMethod string) (int64, error) {
+	var cardID sql.NullInt64
+	var total types.Money
+	if err := tx.QueryRow("select loyalty_card_id, total_amount from Receipt where id = $1", receiptID).Scan(&cardID, &total); err != nil {
+		return 0, fmt.Errorf("applyReturnPoints: %v", err)
+	}
+
+	if !cardID.Valid {
+		if paymentMethod == types.PaymentMethodLoyaltyPoints {
+			return 0, newValidationError("receipt %d has no loyalty card to refund points to", receiptID)
+		}
+		return 0, nil
+	}
+
+	var accrued, reversed, redeemed, refunded int64
+	err := tx.QueryRow(`
+	select
+	coalesce(sum(points) filter (where kind = 'accrual'), 0),
+	coalesce(-sum(points) filter (where kind = 'reversal'), 0),
+	coalesce(-sum(points) filter (where kind = 'redemption'), 0),
+	coalesce(sum(points) filter (where kind = 'refund'), 0)
+	from Loyalty_Points_Ledger
+	where receipt_id = $1`, receiptID).Scan(&accrued, &reversed, &redeemed, &refunded)
+	if err != nil {
+		return 0, fmt.Errorf("applyReturnPoints: %v", err)
+	}
+
+	// Возврат уже записан, поэтому refundedTotal включает и его
+	var refundedTotal types.Money
+	if err := tx.QueryRow("select coalesce(sum(total_amount), 0) from Receipt_Return where receipt_id = $1", receiptID).Scan(&refundedTotal); err != nil {
+		return 0, fmt.Errorf("applyReturnPoints: %v", err)
+	}
+
+	var change int64
+
+	if total > 0 && accrued > reversed {
+		// Округление как при начислении, последний возврат снимает весь остаток
+		reversal := moneyToPoints(types.Money(accrued*100).MulDiv(int64(refund), int64(total)))
+		if refundedTotal >= total {
+			reversal = accrued - reversed
+		}
+		reversal = min(reversal, accrued-reversed)
+		if reversal > 0 {
+			if err := db.insertPointsEntry(tx, cardID.Int64, receiptID, returnID, pointsKindReversal, -reversal); err != nil {
+				return 0, fmt.Errorf("applyReturnPoints: %v", err)
+			}
+			change -= reversal
+		}
+	}
+
+	if paymentMethod == types.PaymentMethodLoyaltyPoints {
+		points := int64(refund.MulDiv(1, 100))
+		if points > redeemed-refunded {
+			return 0, newConflictError("only %d points were paid for receipt %d and not yet refunded", redeemed-refunded, receiptID)
+		}
+		if err := db.insertPointsEntry(tx, cardID.Int64, receiptID, returnID, pointsKindRefund, points); err != nil {
+			return 0, fmt.Errorf("applyReturnPoints: %v", err)
+		}
+		change += points
+	}
+	return change, nil
+}
+
+func (db *DB) reverseReceiptPoints(tx *sql.Tx, receiptID int64) error {
+	_, err := tx.Exec(`
+	insert into Loyalty_Points_Ledger (card_id, receipt_id, kind, points)
+	select card_id, receipt_id, $2, -sum(points)
+	from Loyalty_Points_Ledger
+	where receipt_id = $1
+	group by card_id, receipt_id
+	having sum(points) <> 0`, receiptID, pointsKindReversal)
+	if err != nil {
+		return fmt.Errorf("reverseReceiptPoints: %v", err)
+	}
+	return nil
+}
+
+func (db *DB) insertPointsEntry(tx *sql.Tx, cardID, receiptID, returnID int64, kind string, points int64) error {
+	_, err := tx.Exec("insert into Loyalty_Points_Ledger (card_id, receipt_id, return_id, kind, points) values ($1, $2, $3, $4, $5)",
+		cardID, nullID(receiptID), nullID(returnID), kind, points)
+	if err != nil {
+		return fmt.Errorf("insertPointsEntry: %v", err)
+	}
+	return nil
+}
+
+func (db *DB) getPointsBalance(tx *sql.Tx, cardID int64) (int64, error) {
+	var balance int64
+	err := tx.QueryRow("select coalesce(sum(points), 0) from Loyalty_Points_Ledger where card_id = $1", cardID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("getPointsBalance: %v", err)
+	}
+	return balance, nil
+}
+
+func (db *DB) GetLoyaltyBalance(number int64) (types.LoyaltyBalanceResponse, error) {
+	card, err := db.GetLoyaltyCard(number)
+	if err != nil {
+		return types.LoyaltyBalanceResponse{}, fmt.Errorf("GetLoyaltyBalance: %w", err)
+	}
+
+	query := `
+	select id, kind, points, receipt_id, return_id, created_at
+	from Loyalty_Points_Ledger
+	where card_id = $1
+	order by id desc`
+
+	response := types.LoyaltyBalanceResponse{Number: card.Number}
+	rows, err := db.db.Query(query, card.ID)
+	if err != nil {
+		return types.LoyaltyBalanceResponse{}, fmt.Errorf("GetLoyaltyBalance: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry types.LoyaltyPointsEntryResponse
+		var receiptID, returnID sql.NullInt64
+		if err := rows.Scan(&entry.ID, &entry.Kind, &entry.Points, &receiptID, &returnID, &entry.CreatedAt); err != nil {
+			return types.LoyaltyBalanceResponse{}, fmt.Errorf("GetLoyaltyBalance: %v", err)
+		}
+		if receiptID.Valid {
+			entry.ReceiptID = &receiptID.Int64
+		}
+		if returnID.Valid {
+			entry.ReturnID = &returnID.Int64
+		}
+		response.Balance += entry.Points
+		response.History = append(response.History, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return types.LoyaltyBalanceResponse{}, fmt.Errorf("GetLoyaltyBalance: %v", err)
+	}
+	return response, nil
+}
+
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"db5/config"
+	"db5/internal/types"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectReceiptCard(mock sqlmock.Sqlmock, cardID driver.Value, total types.Money) {
+	mock.ExpectQuery(`select loyalty_card_id, total_amount from Receipt where id = \$1`).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"loyalty_card_id", "total_amount"}).AddRow(cardID, total.String()))
+}
+
+func expectPointsEntry(mock sqlmock.Sqlmock, returnID driver.Value, kind string, points int64) {
+	mock.ExpectExec(`insert into Loyalty_Points_Ledger \(card_id, receipt_id, return_id, kind, points\)`).
+		WithArgs(int64(4), sqlmock.AnyArg(), returnID, kind, points).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func testLoyaltyDB(t *testing.T) (*DB, sqlmock.Sqlmock, *sql.Tx) {
+	db, mock := newMockDB(t)
+	db.loyalty = config.LoyaltyConfig{
+		AccrualPercent:      5,
+		CategoryMultipliers: map[string]float64{"coffee": 2},
+		ExcludedCategories:  []string{"tobacco"},
+	}
+	mock.ExpectBegin()
+	tx, err := db.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock, tx
+}
+
+func TestAccruePoints(t *testing.T) {
+	db := &DB{loyalty: config.LoyaltyConfig{
+		AccrualPercent:      5,
+		CategoryMultipliers: map[string]float64{"coffee": 2},
+		ExcludedCategories:  []string{"tobacco"},
+	}}
+	tests := []struct {
+		name         string
+		lines        []receiptLine
+		paidByPoints types.Money
+		want         int64
+	}{
+		{name: "percent of total", lines: []receiptLine{{category: "bread", amount: 19900}}, want: 9},
+		{name: "category multiplier", lines: []receiptLine{{category: "coffee", amount: 20000}}, want: 20},
+		{name: "excluded category", lines: []receiptLine{{category: "tobacco", amount: 30000}, {category: "bread", amount: 10000}}, want: 5},
+		{name: "part paid by points earns nothing", lines: []receiptLine{{category: "bread", amount: 40000}}, paidByPoints: 10000, want: 15},
+		{name: "fully paid by points", lines: []receiptLine{{category: "bread", amount: 40000}}, paidByPoints: 40000, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var total types.Money
+			for _, line := range tt.lines {
+				total += line.amount
+			}
+			if got := db.accruePoints(tt.lines, total, tt.paidByPoints); got != tt.want {
+				t.Errorf("accruePoints() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateReceiptPoints(t *testing.T) {
+	db, mock, tx := testLoyaltyDB(t)
+	card := sql.NullInt64{Int64: 4, Valid: true}
+	draft := receiptDraft{lines: []receiptLine{{category: "bread", amount: 40000}}, total: 40000}
+	payments := []types.PaymentResponse{
+		{Method: types.PaymentMethodLoyaltyPoints, Amount: 10000, Tendered: 10000},
+		{Method: types.PaymentMethodCash, Amount: 30000, Tendered: 30000},
+	}
+
+	mock.ExpectQuery(`select coalesce\(sum\(points\), 0\) from Loyalty_Points_Ledger where card_id = \$1`).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(150))
+
+	redeemed, accrued, err := db.calculateReceiptPoints(tx, card, draft, payments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redeemed != 10000 || accrued != 15 {
+		t.Errorf("redeemed = %v, accrued = %d, want 100.00, 15", redeemed, accrued)
+	}
+}
+
+func TestRecordReceiptPoints(t *testing.T) {
+	db, mock, tx := testLoyaltyDB(t)
+	expectPointsEntry(mock, nil, pointsKindRedemption, -100)
+	expectPointsEntry(mock, nil, pointsKindAccrual, 15)
+
+	if err := db.recordReceiptPoints(tx, sql.NullInt64{Int64: 4, Valid: true}, 10, 10000, 15); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.recordReceiptPoints(tx, sql.NullInt64{}, 10, 10000, 15); err != nil {
+		t.Errorf("recordReceiptPoints() without card: %v", err)
+	}
+}
+
+func TestCalculateReceiptPointsRejected(t *testing.T) {
+	card := sql.NullInt64{Int64: 4, Valid: true}
+	draft := receiptDraft{lines: []receiptLine{{category: "bread", amount: 40000}}, total: 40000}
+	tests := []struct {
+		name    string
+		card    sql.NullInt64
+		points  types.Money
+		balance int64
+		wantErr error
+	}{
+		{name: "no card", points: 10000, wantErr: &ValidationError{}},
+		{name: "kopecks", card: card, points: 10050, wantErr: &ValidationError{}},
+		{name: "not enough points", card: card, points: 10000, balance: 99, wantErr: &ConflictError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, tx := testLoyaltyDB(t)
+			if tt.balance > 0 {
+				mock.ExpectQuery(`from Loyalty_Points_Ledger where card_id = \$1`).
+					WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(tt.balance))
+			}
+			payments := []types.PaymentResponse{{Method: types.PaymentMethodLoyaltyPoints, Amount: tt.points}}
+
+			_, _, err := db.calculateReceiptPoints(tx, tt.card, draft, payments)
+			if !hasErrorType(err, tt.wantErr) {
+				t.Errorf("calculateReceiptPoints() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func expectReceiptPoints(mock sqlmock.Sqlmock, accrued, reversed, redeemed, refunded int64) {
+	mock.ExpectQuery(`from Loyalty_Points_Ledger\s+where receipt_id = \$1`).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"accrued", "reversed", "redeemed", "refunded"}).
+			AddRow(accrued, reversed, redeemed, refunded))
+}
+
+func expectRefundedTotal(mock sqlmock.Sqlmock, refunded types.Money) {
+	mock.ExpectQuery(`select coalesce\(sum\(total_amount\), 0\) from Receipt_Return where receipt_id = \$1`).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(refunded.String()))
+}
+
+func TestApplyReturnPoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		refund   types.Money
+		refunded types.Money
+		method   string
+		ledger   [4]int64
+		expect   func(mock sqlmock.Sqlmock)
+		want     int64
+	}{
+		{
+			name:     "reversal is proportional to the refund and rounded down",
+			refund:   10000,
+			refunded: 10000,
+			method:   types.PaymentMethodCash,
+			ledger:   [4]int64{21, 0, 0, 0},
+			expect:   func(mock sqlmock.Sqlmock) { expectPointsEntry(mock, int64(40), pointsKindReversal, -5) },
+			want:     -5,
+		},
+		{
+			name:     "last return takes the rest",
+			refund:   10000,
+			refunded: 40000,
+			method:   types.PaymentMethodCash,
+			ledger:   [4]int64{21, 15, 0, 0},
+			expect:   func(mock sqlmock.Sqlmock) { expectPointsEntry(mock, int64(40), pointsKindReversal, -6) },
+			want:     -6,
+		},
+		{
+			name:     "reversal never exceeds what is left",
+			refund:   30000,
+			refunded: 30000,
+			method:   types.PaymentMethodCash,
+			ledger:   [4]int64{20, 18, 0, 0},
+			expect:   func(mock sqlmock.Sqlmock) { expectPointsEntry(mock, int64(40), pointsKindReversal, -2) },
+			want:     -2,
+		},
+		{
+			name:     "refund to points returns them to the card",
+			refund:   10000,
+			refunded: 10000,
+			method:   types.PaymentMethodLoyaltyPoints,
+			ledger:   [4]int64{0, 0, 150, 0},
+			expect:   func(mock sqlmock.Sqlmock) { expectPointsEntry(mock, int64(40), pointsKindRefund, 100) },
+			want:     100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, tx := testLoyaltyDB(t)
+			expectReceiptCard(mock, 4, 40000)
+			expectReceiptPoints(mock, tt.ledger[0], tt.ledger[1], tt.ledger[2], tt.ledger[3])
+			expectRefundedTotal(mock, tt.refunded)
+			tt.expect(mock)
+
+			got, err := db.applyReturnPoints(tx, 5, 40, tt.refund, tt.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("applyReturnPoints() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyReturnPointsOverRefund(t *testing.T) {
+	db, mock, tx := testLoyaltyDB(t)
+	expectReceiptCard(mock, 4, 40000)
+	expectReceiptPoints(mock, 0, 0, 150, 100)
+	expectRefundedTotal(mock, 6000)
+
+	_, err := db.applyReturnPoints(tx, 5, 40, 6000, types.PaymentMethodLoyaltyPoints)
+	if !hasErrorType(err, &ConflictError{}) {
+		t.Errorf("applyReturnPoints() error = %v, want ConflictError", err)
+	}
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEAN13CheckDigit(t *testing.T) {
+	tests := []struct {
+		number int64
+		want   int64
+	}{
+		{number: 400638133393, want: 1},
+		{number: 590123412345, want: 7},
+		{number: 978020137962, want: 4},
+		{number: 460000000001, want: 5},
+		{number: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := ean13CheckDigit(tt.number); got != tt.want {
+			t.Errorf("ean13CheckDigit(%012d) = %d, want %d", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateLoyaltyCardNumber(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		number, err := generateLoyaltyCardNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if number < 1e12 || number >= 1e13 {
+			t.Fatalf("card number %d is not 13 digits", number)
+		}
+		if got := ean13CheckDigit(number / 10); got != number%10 {
+			t.Fatalf("card number %d has check digit %d, want %d", number, number%10, got)
+		}
+	}
+}
+
+func TestIssueLoyaltyCardRetriesTakenNumber(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`insert into Loyalty_Card \(number\)`).WillReturnRows(sqlmock.NewRows([]string{"id", "number", "blocked", "issued_at", "tier", "customer_id"}))
+	mock.ExpectQuery(`insert into Loyalty_Card \(number\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "number", "blocked", "issued_at", "tier", "customer_id"}).AddRow(4, 2000000000015, false, time.Now(), nil, nil))
+
+	card, err := db.IssueLoyaltyCard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.ID != 4 {
+		t.Errorf("card id = %d, want 4", card.ID)
+	}
+}
+
+func TestResolveLoyaltyCard(t *testing.T) {
+	tests := []struct {
+		name     string
+		number   int64
+		row      []driver.Value
+		want     int64
+		wantTier string
+		wantErr  error
+	}{
+		{name: "no card", number: 0},
+		{name: "active card", number: 2000000000015, row: []driver.Value{4, false, "silver"}, want: 4, wantTier: "silver"},
+		{name: "card without tier", number: 2000000000015, row: []driver.Value{4, false, nil}, want: 4, wantTier: "bronze"},
+		{name: "blocked card", number: 2000000000015, row: []driver.Value{4, true, nil}, wantErr: &ConflictError{}},
+		{name: "unknown card", number: 2000000000015, wantErr: &ValidationError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			db.loyaltyTiers = testTiers
+			mock.ExpectBegin()
+			if tt.number != 0 {
+				rows := sqlmock.NewRows([]string{"id", "blocked", "tier"})
+				if tt.row != nil {
+					rows.AddRow(tt.row...)
+				}
+				mock.ExpectQuery(`select id, blocked, tier from Loyalty_Card where number = \$1 for update`).WithArgs(tt.number).WillReturnRows(rows)
+			}
+			tx, err := db.db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := db.resolveLoyaltyCard(tx, tt.number)
+			if tt.wantErr != nil {
+				if !hasErrorType(err, tt.wantErr) {
+					t.Errorf("resolveLoyaltyCard() error = %v, want %T", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.id.Int64 != tt.want || got.id.Valid != (tt.want != 0) || got.tier.name != tt.wantTier {
+				t.Errorf("resolveLoyaltyCard() = %+v, want card %d with tier %q", got, tt.want, tt.wantTier)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"database/sql"
+	"db5/config"
+	"db5/internal/types"
+	"fmt"
+	"time"
+)
+
+// cardSpendQuery сумма покупок по карте за последние 12 месяцев за вычетом возвратов
+const cardSpendQuery = `
+	coalesce((select sum(r.total_amount) from Receipt as r
+		where r.loyalty_card_id = lc.id and r.status = 'active' and r.date_time >= $1), 0)
+	- coalesce((select sum(rr.total_amount) from Receipt_Return as rr
+		join Receipt as r on r.id = rr.receipt_id
+		where r.loyalty_card_id = lc.id and rr.date_time >= $1), 0)`
+
+type loyaltyTier struct {
+	name            string
+	minSpend        types.Money
+	discountPercent float64
+}
+
+func newLoyaltyTiers(tiers []config.LoyaltyTier) []loyaltyTier {
+	result := make([]loyaltyTier, len(tiers))
+	for i, tier := range tiers {
+		result[i] = loyaltyTier{name: tier.Name, minSpend: types.MoneyFromFloat(tier.MinSpend), discountPercent: tier.DiscountPercent}
+	}
+	return result
+}
+
+// tierByName карта без уровня относится к самому младшему
+func (db *DB) tierByName(name string) loyaltyTier {
+	for _, tier := range db.loyaltyTiers {
+		if tier.name == name {
+			return tier
+		}
+	}
+	if len(db.loyaltyTiers) > 0 {
+		return db.loyaltyTiers[0]
+	}
+	return loyaltyTier{name: name}
+}
+
+func (db *DB) tierForSpend(spend types.Money) loyaltyTier {
+	var result loyaltyTier
+	for _, tier := range db.loyaltyTiers {
+		if spend >= tier.minSpend {
+			result = tier
+		}
+	}
+	return result
+}
+
+func tierPeriodStart(now time.Time) time.Time {
+	return now.AddDate(-1, 0, 0)
+}
+
+// upgradeCardTier только повышает уровень, понижение делает ночной пересчет
+func (db *DB) upgradeCardTier(tx *sql.Tx, cardID int64) error {
+	var current sql.NullString
+	var spend types.Money
+	err := tx.QueryRow("select lc.tier, "+cardSpendQuery+" from Loyalty_Card as lc where lc.id = $2", tierPeriodStart(time.Now()), cardID).
+		Scan(&current, &spend)
+	if err != nil {
+		return fmt.Errorf("upgradeCardTier: %v", err)
+	}
+
+	tier := db.tierForSpend(spend)
+	if tier.minSpend <= db.tierByName(current.String).minSpend {
+		return nil
+	}
+
+	_, err = tx.Exec("update Loyalty_Card set tier = $1, tier_updated_at = now() where id = $2", tier.name, cardID)
+	if err != nil {
+		return fmt.Errorf("upgradeCardTier: %v", err)
+	}
+	return nil
+}
+
+// RecalculateLoyaltyTiers возвращает количество карт, у которых уровень изменился
+func (db *DB) RecalculateLoyaltyTiers() (int, error) {
+	rows, err := db.db.Query("select lc.id, lc.tier, "+cardSpendQuery+" from Loyalty_Card as lc", tierPeriodStart(time.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("RecalculateLoyaltyTiers: %v", err)
+	}
+	defer rows.Close()
+
+	changed := make(map[int64]string)
+	for rows.Next() {
+		var cardID int64
+		var current sql.NullString
+		var spend types.Money
+		if err := rows.Scan(&cardID, &current, &spend); err != nil {
+			return 0, fmt.Errorf("RecalculateLoyaltyTiers: %v", err)
+		}
+		if tier := db.tierForSpend(spend); !current.Valid || tier.name != current.String {
+			changed[cardID] = tier.name
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("RecalculateLoyaltyTiers: %v", err)
+	}
+
+	for cardID, tier := range changed {
+		if _, err := db.db.Exec("update Loyalty_Card set tier = $1, tier_updated_at = now() where id = $2", tier, cardID); err != nil {
+			return 0, fmt.Errorf("RecalculateLoyaltyTiers: %v", err)
+		}
+	}
+	return len(changed), nil
+}
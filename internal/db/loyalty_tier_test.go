@@ -0,0 +1,131 @@
+package db
+
+import (
+	"database/sql"
+	"db5/config"
+	"db5/internal/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testTiers = newLoyaltyTiers([]config.LoyaltyTier{
+	{Name: "bronze", MinSpend: 0},
+	{Name: "silver", MinSpend: 20000, DiscountPercent: 3},
+	{Name: "gold", MinSpend: 50000, DiscountPercent: 5},
+})
+
+func TestTierForSpend(t *testing.T) {
+	db := &DB{loyaltyTiers: testTiers}
+	tests := []struct {
+		spend types.Money
+		want  string
+	}{
+		{spend: 0, want: "bronze"},
+		{spend: 1999999, want: "bronze"},
+		{spend: 2000000, want: "silver"},
+		{spend: 5000000, want: "gold"},
+		{spend: 100000000, want: "gold"},
+	}
+	for _, tt := range tests {
+		if got := db.tierForSpend(tt.spend); got.name != tt.want {
+			t.Errorf("tierForSpend(%v) = %q, want %q", tt.spend, got.name, tt.want)
+		}
+	}
+	if got := db.tierByName(""); got.name != "bronze" {
+		t.Errorf("card without tier is %q, want bronze", got.name)
+	}
+}
+
+func expectCardSpend(mock sqlmock.Sqlmock, tier any, spend types.Money) {
+	mock.ExpectQuery(`select lc.tier,.* from Loyalty_Card as lc where lc.id = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"tier", "spend"}).AddRow(tier, spend.String()))
+}
+
+func TestUpgradeCardTier(t *testing.T) {
+	tests := []struct {
+		name    string
+		current any
+		spend   types.Money
+		want    string
+	}{
+		{name: "upgrade", current: "bronze", spend: 2000000, want: "silver"},
+		{name: "first tier for a new card", current: nil, spend: 6000000, want: "gold"},
+		{name: "same tier", current: "silver", spend: 3000000},
+		{name: "no downgrade after a purchase", current: "gold", spend: 10000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, tx := testLoyaltyDB(t)
+			db.loyaltyTiers = testTiers
+			expectCardSpend(mock, tt.current, tt.spend)
+			if tt.want != "" {
+				mock.ExpectExec(`update Loyalty_Card set tier = \$1`).WithArgs(tt.want, int64(4)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			if err := db.upgradeCardTier(tx, 4); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRecalculateLoyaltyTiers(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.loyaltyTiers = testTiers
+	mock.ExpectQuery(`select lc.id, lc.tier,.* from Loyalty_Card as lc`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tier", "spend"}).
+			AddRow(1, "gold", "60000.00").
+			AddRow(2, "gold", "25000.00").
+			AddRow(3, nil, "0.00"))
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectExec(`update Loyalty_Card set tier = \$1`).WithArgs("silver", int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`update Loyalty_Card set tier = \$1`).WithArgs("bronze", int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	changed, err := db.RecalculateLoyaltyTiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Errorf("changed = %d, want 2", changed)
+	}
+}
+
+func TestCreateNewReceiptAppliesTierDiscount(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.loyalty = config.LoyaltyConfig{AccrualPercent: 1}
+	db.loyaltyTiers = testTiers
+	date := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	mock.ExpectQuery(`select id, blocked, tier from Loyalty_Card`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "blocked", "tier"}).AddRow(4, false, "gold"))
+	expectLockProducts(mock, testMilk)
+	expectActivePromotions(mock)
+	expectNextReceiptNumber(mock, "day:1:2026-03-14", 5)
+	mock.ExpectQuery(`insert into Receipt \(`).
+		WithArgs(types.Money(17081), int64(3), int64(4), int64(8), 5, "1-20260314-0005", sql.NullTime{}, sql.NullString{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date_time"}).AddRow(10, date))
+	mock.ExpectExec(`insert into Receipt_Product`).
+		WithArgs(int64(10), int64(1), int64(2), types.Money(17081), types.Money(8990), types.Money(899), nil, types.Money(0), 0.0, types.Money(0), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectStockUpdate(mock, 1, -2, types.StockMovementSale)
+	mock.ExpectExec(`insert into Receipt_Payment`).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPointsEntry(mock, nil, pointsKindAccrual, 1)
+	expectCardSpend(mock, "gold", 6000000)
+	mock.ExpectCommit()
+
+	got, err := db.CreateNewReceipt(types.ReceiptInfoRequest{
+		TellerID:          3,
+		LoyaltyCardNumber: 2000000000015,
+		Products:          []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 2, Amount: moneyPtr(17081)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 17081 || got.Discount != 899 || got.PointsAccrued != 1 {
+		t.Errorf("total %v, discount %v, points %d; want 170.81, 8.99, 1", got.Total, got.Discount, got.PointsAccrued)
+	}
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// offlineClockSkew насколько время чека может опережать часы сервера
+const offlineClockSkew = 5 * time.Minute
+
+// CreateOfflineReceipt проводит чек, пробитый кассой без связи, со временем продажи с кассы
+// в смене, которая была открыта в этот момент. Если смена уже закрыта, чек проводится в нее
+// как корректировка после закрытия: в Z-отчет он не входит и показывается отдельно. Повторная выгрузка чека с тем же ClientUUID
+// ничего не меняет и возвращает уже проведенный чек с признаком duplicate, а выгрузка с другими строками — ConflictError.
+func (db *DB) CreateOfflineReceipt(receiptInfo types.OfflineReceiptRequest) (types.ReceiptResponse, bool, error) {
+	clientUUID := strings.ToLower(strings.TrimSpace(receiptInfo.ClientUUID))
+	if !isUUID(clientUUID) {
+		return types.ReceiptResponse{}, false, newValidationError("client_uuid must be a UUID")
+	}
+	if receiptInfo.CreatedAt.IsZero() {
+		return types.ReceiptResponse{}, false, newValidationError("created_at is required")
+	}
+	if receiptInfo.CreatedAt.After(time.Now().Add(offlineClockSkew)) {
+		return types.ReceiptResponse{}, false, newValidationError("created_at is in the future")
+	}
+	// В базе время хранится без зоны, в зоне сервера
+	createdAt := receiptInfo.CreatedAt.In(time.Local)
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.ReceiptResponse{}, false, fmt.Errorf("CreateOfflineReceipt: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Одновременная выгрузка одного чека из двух запросов ждет здесь, второй увидит дубль
+	if _, err := tx.Exec("select pg_advisory_xact_lock(hashtext($1))", clientUUID); err != nil {
+		return types.ReceiptResponse{}, false, fmt.Errorf("CreateOfflineReceipt: %v", err)
+	}
+
+	existing, err := findReceiptByClientUUID(tx, clientUUID)
+	if err == nil {
+		if err := checkOfflineResend(tx, existing, receiptInfo.ReceiptInfoRequest); err != nil {
+			return types.ReceiptResponse{}, false, fmt.Errorf("CreateOfflineReceipt: %w", err)
+		}
+		return existing, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return types.ReceiptResponse{}, false, fmt.Errorf("CreateOfflineReceipt: %v", err)
+	}
+
+	shiftID, afterClose, err := db.shiftAt(tx, receiptInfo.TellerID, createdAt)
+	if err != nil {
+		return types.ReceiptResponse{}, false, fmt.Errorf("CreateOfflineReceipt: %w", err)
+	}
+
+	response, err := db.createReceipt(tx, receiptInfo.ReceiptInfoRequest, shiftID, &offlineSale{clientUUID: clientUUID, createdAt: createdAt})
+	if err != nil {
+		return types.ReceiptResponse{}, false, fmt.Errorf("CreateOfflineReceipt: %w", err)
+	}
+	if afterClose {
+		if _, err := tx.Exec("update Receipt set after_close = true where id = $1", response.ID); err != nil {
+			return types.ReceiptResponse{}, false, fmt.Errorf("CreateOfflineReceipt: %v", err)
+		}
+		response.AfterClose = true
+	}
+	if err := tx.Commit(); err != nil {
+		return types.ReceiptResponse{}, false, fmt.Errorf("CreateOfflineReceipt: %v", err)
+	}
+	return response, false, nil
+}
+
+// findReceiptByClientUUID реквизиты ранее выгруженного чека без строк и оплат
+func findReceiptByClientUUID(q queryer, clientUUID string) (types.ReceiptResponse, error) {
+	var receipt types.ReceiptResponse
+	var shiftID sql.NullInt64
+	var number sql.NullInt64
+	err := q.QueryRow(`
+	select id, shift_id, number, coalesce(printed_number, ''), date_time, total_amount
+	from Receipt where client_uuid = $1`, clientUUID).Scan(&receipt.ID, &shiftID, &number, &receipt.PrintedNumber, &receipt.Date, &receipt.Total)
+	receipt.ShiftID = shiftID.Int64
+	receipt.Number = int(number.Int64)
+	return receipt, err
+}
+
+// checkOfflineResend повторная выгрузка должна совпадать с проведенным чеком по строкам и итогу,
+// иначе касса выдала один client_uuid двум разным чекам
+func checkOfflineResend(q queryer, existing types.ReceiptResponse, receiptInfo types.ReceiptInfoRequest) error {
+	rows, err := q.Query("select product_id, quantity, price_at_purchase, amount from Receipt_Product where receipt_id = $1 order by id", existing.ID)
+	if err != nil {
+		return fmt.Errorf("checkOfflineResend: %v", err)
+	}
+	defer rows.Close()
+
+	var stored []types.ReceiptProductInfoRequest
+	for rows.Next() {
+		var line types.ReceiptProductInfoRequest
+		var price, amount types.Money
+		if err := rows.Scan(&line.ProductID, &line.Quantity, &price, &amount); err != nil {
+			return fmt.Errorf("checkOfflineResend: %v", err)
+		}
+		line.Price, line.Amount = &price, &amount
+		stored = append(stored, line)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("checkOfflineResend: %v", err)
+	}
+
+	conflict := newConflictError("client_uuid already used by receipt %d with different lines or total", existing.ID)
+	if len(stored) != len(receiptInfo.Products) {
+		return conflict
+	}
+	var total types.Money
+	for i, item := range receiptInfo.Products {
+		line := stored[i]
+		if item.ProductID != line.ProductID || item.Quantity != line.Quantity ||
+			item.Price == nil || *item.Price != *line.Price || item.Amount == nil || *item.Amount != *line.Amount {
+			return conflict
+		}
+		total += *item.Amount
+	}
+	if total != existing.Total {
+		return conflict
+	}
+	return nil
+}
+
+// isUUID проверяет запись вида xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx в нижнем регистре
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, r := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+		default:
+			if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
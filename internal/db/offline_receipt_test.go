@@ -0,0 +1,200 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIsUUID(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{s: "123e4567-e89b-12d3-a456-426614174000", want: true},
+		{s: "00000000-0000-0000-0000-000000000000", want: true},
+		{s: "123E4567-E89B-12D3-A456-426614174000", want: false},
+		{s: "123e4567e89b12d3a456426614174000", want: false},
+		{s: "123e4567-e89b-12d3-a456-42661417400", want: false},
+		{s: "123e4567-e89b-12d3-a456-4266141740000", want: false},
+		{s: "123e4567-e89b-12d3-a456_426614174000", want: false},
+		{s: "g23e4567-e89b-12d3-a456-426614174000", want: false},
+		{s: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := isUUID(tt.s); got != tt.want {
+			t.Errorf("isUUID(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+const testClientUUID = "123e4567-e89b-12d3-a456-426614174000"
+
+func TestCreateOfflineReceiptValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		request types.OfflineReceiptRequest
+	}{
+		{name: "bad uuid", request: types.OfflineReceiptRequest{ClientUUID: "receipt-1", CreatedAt: time.Now()}},
+		{name: "no created_at", request: types.OfflineReceiptRequest{ClientUUID: testClientUUID}},
+		{name: "future created_at", request: types.OfflineReceiptRequest{ClientUUID: testClientUUID, CreatedAt: time.Now().Add(time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newMockDB(t)
+			_, _, err := db.CreateOfflineReceipt(tt.request)
+			if !hasErrorType(err, &ValidationError{}) {
+				t.Errorf("CreateOfflineReceipt() error = %v, want ValidationError", err)
+			}
+		})
+	}
+}
+
+// TestCreateOfflineReceiptDuplicate чек 42 уже выгружен: молоко 3 по 89.90 и хлеб 2 по 45.50
+func TestCreateOfflineReceiptDuplicate(t *testing.T) {
+	createdAt := time.Date(2026, 3, 14, 11, 0, 0, 0, time.UTC)
+	line := func(productID, quantity int64, price, amount types.Money) types.ReceiptProductInfoRequest {
+		return types.ReceiptProductInfoRequest{ProductID: productID, Quantity: quantity, Price: moneyPtr(price), Amount: moneyPtr(amount)}
+	}
+	milk, bread := line(1, 3, 8990, 26970), line(2, 2, 4550, 9100)
+	tests := []struct {
+		name     string
+		products []types.ReceiptProductInfoRequest
+		wantErr  bool
+	}{
+		{name: "same receipt", products: []types.ReceiptProductInfoRequest{milk, bread}},
+		{name: "different quantity", products: []types.ReceiptProductInfoRequest{line(1, 2, 8990, 17980), bread}, wantErr: true},
+		{name: "different amount", products: []types.ReceiptProductInfoRequest{line(1, 3, 8990, 25000), bread}, wantErr: true},
+		{name: "missing line", products: []types.ReceiptProductInfoRequest{milk}, wantErr: true},
+		{name: "no prices", products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 3}, bread}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectExec(`select pg_advisory_xact_lock\(hashtext\(\$1\)\)`).WithArgs(testClientUUID).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`from Receipt where client_uuid = \$1`).WithArgs(testClientUUID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "shift_id", "number", "printed_number", "date_time", "total_amount"}).
+					AddRow(42, 8, 5, "1-20260314-0005", createdAt, "360.70"))
+			mock.ExpectQuery(`select product_id, quantity, price_at_purchase, amount from Receipt_Product where receipt_id = \$1 order by id`).WithArgs(int64(42)).
+				WillReturnRows(sqlmock.NewRows([]string{"product_id", "quantity", "price_at_purchase", "amount"}).
+					AddRow(1, 3, "89.90", "269.70").
+					AddRow(2, 2, "45.50", "91.00"))
+			mock.ExpectRollback()
+
+			got, duplicate, err := db.CreateOfflineReceipt(types.OfflineReceiptRequest{
+				ClientUUID:         " 123E4567-E89B-12D3-A456-426614174000 ",
+				CreatedAt:          createdAt,
+				ReceiptInfoRequest: types.ReceiptInfoRequest{TellerID: 3, Products: tt.products},
+			})
+			if tt.wantErr {
+				if !hasErrorType(err, &ConflictError{}) {
+					t.Errorf("CreateOfflineReceipt() error = %v, want ConflictError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !duplicate || got.ID != 42 || got.ShiftID != 8 || got.PrintedNumber != "1-20260314-0005" || got.Total != 36070 {
+				t.Errorf("CreateOfflineReceipt() = %+v, %v, want receipt 42 as duplicate", got, duplicate)
+			}
+		})
+	}
+}
+
+func TestCreateOfflineReceipt(t *testing.T) {
+	for _, closed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("closed shift %v", closed), func(t *testing.T) {
+			testCreateOfflineReceipt(t, closed)
+		})
+	}
+}
+
+// testCreateOfflineReceipt касса продала молоко по своей цене и больше, чем есть на складе.
+// В уже закрытую смену чек попадает как корректировка после закрытия.
+func testCreateOfflineReceipt(t *testing.T, closed bool) {
+	db, mock := newMockDB(t)
+	createdAt := time.Date(2026, 3, 14, 11, 0, 0, 0, time.Local)
+	saleDate := sql.NullTime{Time: createdAt, Valid: true}
+	clientUUID := sql.NullString{String: testClientUUID, Valid: true}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`select pg_advisory_xact_lock`).WithArgs(testClientUUID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`from Receipt where client_uuid = \$1`).WithArgs(testClientUUID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "shift_id", "number", "printed_number", "date_time", "total_amount"}))
+	mock.ExpectQuery(`select id, closed_at is not null from Shift`).WithArgs(int64(3), createdAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "closed"}).AddRow(8, closed))
+	milk := testMilk
+	milk.stock = 2
+	expectLockProducts(mock, milk)
+	expectActivePromotions(mock)
+	mock.ExpectQuery(`select register, coalesce\(\$2::timestamp, now\(\)::timestamp\) from Shift`).WithArgs(int64(8), saleDate).
+		WillReturnRows(sqlmock.NewRows([]string{"register", "date"}).AddRow("1", createdAt))
+	mock.ExpectQuery(`insert into Receipt_Counter`).WithArgs("day:1:2026-03-14").
+		WillReturnRows(sqlmock.NewRows([]string{"last_number"}).AddRow(5))
+	mock.ExpectQuery(`insert into Receipt \(`).
+		WithArgs(types.Money(25500), int64(3), nil, int64(8), 5, "1-20260314-0005", saleDate, clientUUID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date_time"}).AddRow(10, createdAt))
+	// Касса продала по своей цене, расчет сервера сохраняется рядом
+	mock.ExpectExec(`insert into Receipt_Product`).
+		WithArgs(int64(10), int64(1), int64(3), types.Money(25500), types.Money(8500), types.Money(0), nil, types.Money(0), 0.0, types.Money(0),
+			types.Money(8990), types.Money(26970)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`update Product set quantity_in_stock = quantity_in_stock \+ \$1 where id = \$2 returning quantity_in_stock`).WithArgs(int64(-3), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity_in_stock"}).AddRow(-1))
+	mock.ExpectQuery(`insert into Stock_Movement`).
+		WithArgs(int64(1), types.StockMovementSale, int64(-3), sqlmock.AnyArg(), int64(10), int64(3), "offline receipt sold 3 with 2 in stock").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
+	mock.ExpectExec(`insert into Receipt_Payment`).WillReturnResult(sqlmock.NewResult(0, 1))
+	if closed {
+		mock.ExpectExec(`update Receipt set after_close = true where id = \$1`).WithArgs(int64(10)).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	got, duplicate, err := db.CreateOfflineReceipt(types.OfflineReceiptRequest{
+		ClientUUID: testClientUUID,
+		CreatedAt:  createdAt,
+		ReceiptInfoRequest: types.ReceiptInfoRequest{
+			TellerID: 3,
+			Products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 3, Price: moneyPtr(8500), Amount: moneyPtr(25500)}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := got.Products[0]
+	if duplicate || got.Total != 25500 || line.ExpectedPrice == nil || *line.ExpectedPrice != 8990 || line.ExpectedAmount == nil || *line.ExpectedAmount != 26970 {
+		t.Errorf("CreateOfflineReceipt() = %+v, %v; want total 255.00 with expected price 89.90 and amount 269.70", got, duplicate)
+	}
+	if got.AfterClose != closed {
+		t.Errorf("AfterClose = %v, want %v", got.AfterClose, closed)
+	}
+}
+
+func TestCreateOfflineReceiptRequiresRegisterPrices(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`select pg_advisory_xact_lock`).WithArgs(testClientUUID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`from Receipt where client_uuid = \$1`).WithArgs(testClientUUID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "shift_id", "number", "printed_number", "date_time", "total_amount"}))
+	mock.ExpectQuery(`select id, closed_at is not null from Shift`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "closed"}).AddRow(8, false))
+	mock.ExpectRollback()
+
+	_, _, err := db.CreateOfflineReceipt(types.OfflineReceiptRequest{
+		ClientUUID: testClientUUID,
+		CreatedAt:  time.Date(2026, 3, 14, 11, 0, 0, 0, time.Local),
+		ReceiptInfoRequest: types.ReceiptInfoRequest{
+			TellerID: 3,
+			Products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 3, Amount: moneyPtr(25500)}},
+		},
+	})
+	if !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("CreateOfflineReceipt() error = %v, want ValidationError", err)
+	}
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"fmt"
+	"strings"
+)
+
+func isPaymentMethod(method string) bool {
+	switch method {
+	case types.PaymentMethodCash,
+		types.PaymentMethodCard,
+		types.PaymentMethodLoyaltyPoints,
+		types.PaymentMethodGiftCertificate:
+		return true
+	}
+	return false
+}
+
+// allocatePayments сдача выдается только с наличных, без оплат чек оплачен наличными без сдачи
+func allocatePayments(total types.Money, payments []types.PaymentRequest) ([]types.PaymentResponse, error) {
+	if len(payments) == 0 {
+		if total == 0 {
+			return nil, nil
+		}
+		return []types.PaymentResponse{{
+			Method:   types.PaymentMethodCash,
+			Amount:   total,
+			Tendered: total,
+		}}, nil
+	}
+
+	var result []types.PaymentResponse
+	var nonCash, cash types.Money
+
+	for _, payment := range payments {
+		if !isPaymentMethod(payment.Method) {
+			return nil, newValidationError("unknown payment method %q", payment.Method)
+		}
+		if payment.Amount <= 0 {
+			return nil, newValidationError("%s payment amount must be positive", payment.Method)
+		}
+		if payment.Method == types.PaymentMethodGiftCertificate && strings.TrimSpace(payment.Reference) == "" {
+			return nil, newValidationError("gift certificate payment requires reference")
+		}
+
+		if payment.Method == types.PaymentMethodCash {
+			cash += payment.Amount
+			continue
+		}
+		nonCash += payment.Amount
+		result = append(result, types.PaymentResponse{
+			Method:    payment.Method,
+			Amount:    payment.Amount,
+			Tendered:  payment.Amount,
+			Reference: payment.Reference,
+		})
+	}
+
+	if nonCash > total {
+		return nil, newValidationError("non-cash payments %s exceed receipt total %s", nonCash, total)
+	}
+
+	due := total - nonCash
+	if cash < due {
+		return nil, newValidationError("payments %s do not cover receipt total %s", nonCash+cash, total)
+	}
+
+	if cash > 0 {
+		if due == 0 {
+			return nil, newValidationError("cash payment is not needed, receipt is fully paid by other methods")
+		}
+		result = append(result, types.PaymentResponse{
+			Method:   types.PaymentMethodCash,
+			Amount:   due,
+			Tendered: cash,
+			Change:   cash - due,
+		})
+	}
+	return result, nil
+}
+
+func paymentsChange(payments []types.PaymentResponse) types.Money {
+	var change types.Money
+	for _, payment := range payments {
+		change += payment.Change
+	}
+	return change
+}
+
+func (db *DB) insertReceiptPayments(tx *sql.Tx, receiptID int64, payments []types.PaymentResponse) error {
+	for _, payment := range payments {
+		var reference any
+		if payment.Reference != "" {
+			reference = payment.Reference
+		}
+		_, err := tx.Exec("insert into Receipt_Payment (receipt_id, method, amount, tendered, change_amount, reference) values ($1, $2, $3, $4, $5, $6)",
+			receiptID, payment.Method, payment.Amount, payment.Tendered, payment.Change, reference)
+		if err != nil {
+			return fmt.Errorf("insertReceiptPayments: %v", err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) getReceiptPayments(receiptID int64) ([]types.PaymentResponse, error) {
+	var payments []types.PaymentResponse
+
+	rows, err := db.db.Query("select method, amount, tendered, change_amount, coalesce(reference, '') from Receipt_Payment where receipt_id = $1 order by id", receiptID)
+	if err != nil {
+		return nil, fmt.Errorf("getReceiptPayments: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var payment types.PaymentResponse
+		if err := rows.Scan(&payment.Method, &payment.Amount, &payment.Tendered, &payment.Change, &payment.Reference); err != nil {
+			return nil, fmt.Errorf("getReceiptPayments: %v", err)
+		}
+		payments = append(payments, payment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getReceiptPayments: %v", err)
+	}
+	return payments, nil
+}
+
+func (db *DB) getShiftPaymentTotals(tx *sql.Tx, shiftID int64) ([]types.PaymentTotalResponse, error) {
+	query := `
+	select method, sum(sales), sum(refunds)
+	from (
+		select p.method, p.amount as sales, 0 as refunds
+		from Receipt_Payment as p
+		join Receipt as r on r.id = p.receipt_id
+		where r.shift_id = $1 and r.status = 'active' and not r.after_close
+		union all
+		select rr.payment_method, 0, rr.total_amount
+		from Receipt_Return as rr
+		where rr.shift_id = $1
+	) as t
+	group by method
+	order by method`
+
+	var totals []types.PaymentTotalResponse
+	rows, err := tx.Query(query, shiftID)
+	if err != nil {
+		return nil, fmt.Errorf("getShiftPaymentTotals: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var total types.PaymentTotalResponse
+		if err := rows.Scan(&total.Method, &total.Sales, &total.Refunds); err != nil {
+			return nil, fmt.Errorf("getShiftPaymentTotals: %v", err)
+		}
+		total.Refunds = -total.Refunds
+		totals = append(totals, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getShiftPaymentTotals: %v", err)
+	}
+	return totals, nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"db5/internal/types"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAllocatePayments(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    types.Money
+		payments []types.PaymentRequest
+		want     []types.PaymentResponse
+		wantErr  bool
+	}{
+		{
+			name:  "no payments is cash without change",
+			total: 15000,
+			want:  []types.PaymentResponse{{Method: types.PaymentMethodCash, Amount: 15000, Tendered: 15000}},
+		},
+		{
+			name:  "no payments on zero total",
+			total: 0,
+			want:  nil,
+		},
+		{
+			name:     "cash with change",
+			total:    15000,
+			payments: []types.PaymentRequest{{Method: types.PaymentMethodCash, Amount: 20000}},
+			want:     []types.PaymentResponse{{Method: types.PaymentMethodCash, Amount: 15000, Tendered: 20000, Change: 5000}},
+		},
+		{
+			name:  "several cash payments are merged",
+			total: 15000,
+			payments: []types.PaymentRequest{
+				{Method: types.PaymentMethodCash, Amount: 10000},
+				{Method: types.PaymentMethodCash, Amount: 10000},
+			},
+			want: []types.PaymentResponse{{Method: types.PaymentMethodCash, Amount: 15000, Tendered: 20000, Change: 5000}},
+		},
+		{
+			name:  "card and cash split, change from cash only",
+			total: 15000,
+			payments: []types.PaymentRequest{
+				{Method: types.PaymentMethodCash, Amount: 10000},
+				{Method: types.PaymentMethodCard, Amount: 10000},
+			},
+			want: []types.PaymentResponse{
+				{Method: types.PaymentMethodCard, Amount: 10000, Tendered: 10000},
+				{Method: types.PaymentMethodCash, Amount: 5000, Tendered: 10000, Change: 5000},
+			},
+		},
+		{
+			name:  "gift certificate keeps reference",
+			total: 15000,
+			payments: []types.PaymentRequest{
+				{Method: types.PaymentMethodGiftCertificate, Amount: 15000, Reference: "GC-1"},
+			},
+			want: []types.PaymentResponse{
+				{Method: types.PaymentMethodGiftCertificate, Amount: 15000, Tendered: 15000, Reference: "GC-1"},
+			},
+		},
+		{
+			name:     "card over total",
+			total:    15000,
+			payments: []types.PaymentRequest{{Method: types.PaymentMethodCard, Amount: 15001}},
+			wantErr:  true,
+		},
+		{
+			name:     "payments do not cover total",
+			total:    15000,
+			payments: []types.PaymentRequest{{Method: types.PaymentMethodCash, Amount: 14999}},
+			wantErr:  true,
+		},
+		{
+			name:  "cash when card already covers total",
+			total: 15000,
+			payments: []types.PaymentRequest{
+				{Method: types.PaymentMethodCard, Amount: 15000},
+				{Method: types.PaymentMethodCash, Amount: 100},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "unknown method",
+			total:    15000,
+			payments: []types.PaymentRequest{{Method: "barter", Amount: 15000}},
+			wantErr:  true,
+		},
+		{
+			name:     "zero amount",
+			total:    15000,
+			payments: []types.PaymentRequest{{Method: types.PaymentMethodCash, Amount: 0}},
+			wantErr:  true,
+		},
+		{
+			name:     "gift certificate without reference",
+			total:    15000,
+			payments: []types.PaymentRequest{{Method: types.PaymentMethodGiftCertificate, Amount: 15000, Reference: " "}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := allocatePayments(tt.total, tt.payments)
+			if tt.wantErr {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("allocatePayments() error = %v, want ValidationError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("allocatePayments(): %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocatePayments() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"fmt"
+	"time"
+)
+
+// receiptDraft shortages — нехватка товара, с которой проведен чек кассы без связи
+type receiptDraft struct {
+	lines     []receiptLine
+	total     types.Money
+	discount  types.Money
+	shortages map[int64]types.InsufficientStockResponse
+}
+
+// receiptLine gross — стоимость по цене без скидок, discount включает promotionDiscount
+type receiptLine struct {
+	productID         int64
+	name              string
+	category          string
+	quantity          int64
+	price             types.Money
+	gross             types.Money
+	promotion         *promotion
+	promotionDiscount types.Money
+	discount          types.Money
+	amount            types.Money
+	vatRate           float64
+	vatAmount         types.Money
+	expected          *lineExpected
+}
+
+// lineExpected цена и сумма строки по расчету сервера, если касса без связи посчитала иначе
+type lineExpected struct {
+	price  types.Money
+	amount types.Money
+}
+
+// priceReceipt считает строки и итог чека по текущим ценам из Product и проверяет остатки.
+// Сначала применяются акции, затем на остаток строки скидка уровня карты лояльности discountPercent.
+// Price и Amount из запроса используются только для сверки с расчетом, Amount сверяется с учетом скидок.
+// Не переданные Price и Amount не сверяются.
+// Чек кассы без связи offline уже продан: Price и Amount обязательны и принимаются как есть,
+// расхождение с расчетом сохраняется в строке, нехватка товара — в draft.shortages, остаток уходит в минус.
+// Акции берутся действующие в момент продажи saleTime. Строки товаров блокируются до конца транзакции.
+func (db *DB) priceReceipt(tx *sql.Tx, receiptInfo types.ReceiptInfoRequest, discountPercent float64, saleTime time.Time, offline bool) (receiptDraft, error) {
+	if len(receiptInfo.Products) == 0 {
+		return receiptDraft{}, newValidationError("receipt has no products")
+	}
+
+	ids := make([]int64, 0, len(receiptInfo.Products))
+	for _, item := range receiptInfo.Products {
+		if item.Quantity <= 0 {
+			return receiptDraft{}, newValidationError("product %d: quantity must be positive", item.ProductID)
+		}
+		if offline && (item.Price == nil || item.Amount == nil) {
+			return receiptDraft{}, newValidationError("product %d: price and amount are required for offline receipts", item.ProductID)
+		}
+		if offline && (*item.Price < 0 || *item.Amount < 0) {
+			return receiptDraft{}, newValidationError("product %d: price and amount must not be negative", item.ProductID)
+		}
+		ids = append(ids, item.ProductID)
+	}
+
+	products, err := db.lockProducts(tx, ids)
+	if err != nil {
+		return receiptDraft{}, fmt.Errorf("priceReceipt: %v", err)
+	}
+
+	promotions, err := db.getActivePromotions(tx, saleTime, receiptInfo.Coupons)
+	if err != nil {
+		return receiptDraft{}, fmt.Errorf("priceReceipt: %w", err)
+	}
+
+	var draft receiptDraft
+	for _, item := range receiptInfo.Products {
+		product, ok := products[item.ProductID]
+		if !ok {
+			return receiptDraft{}, newValidationError("product %d not found", item.ProductID)
+		}
+		draft.lines = append(draft.lines, receiptLine{
+			productID: item.ProductID,
+			name:      product.name,
+			category:  product.category,
+			quantity:  item.Quantity,
+			price:     product.price,
+			gross:     product.price.Mul(item.Quantity),
+			vatRate:   product.vatRate,
+		})
+	}
+
+	applyPromotions(draft.lines, promotions)
+
+	var mismatches []types.PriceMismatchResponse
+	for i, item := range receiptInfo.Products {
+		line := &draft.lines[i]
+		line.discount = line.promotionDiscount + (line.gross - line.promotionDiscount).Percent(discountPercent)
+		line.amount = line.gross - line.discount
+		line.vatAmount = vatIncluded(line.amount, line.vatRate)
+
+		if offline && (*item.Price != line.price || *item.Amount != line.amount) {
+			line.expected = &lineExpected{price: line.price, amount: line.amount}
+			line.price = *item.Price
+			line.gross = line.price.Mul(line.quantity)
+			line.amount = *item.Amount
+			line.discount = line.gross - line.amount
+			line.promotion = nil
+			line.promotionDiscount = 0
+			line.vatAmount = vatIncluded(line.amount, line.vatRate)
+		} else if (item.Price != nil && *item.Price != line.price) || (item.Amount != nil && *item.Amount != line.amount) {
+			mismatches = append(mismatches, types.PriceMismatchResponse{
+				ProductID:      item.ProductID,
+				ExpectedPrice:  line.price,
+				ReceivedPrice:  item.Price,
+				ExpectedAmount: line.amount,
+				ReceivedAmount: item.Amount,
+			})
+		}
+
+		draft.total += line.amount
+		draft.discount += line.discount
+	}
+
+	if len(mismatches) > 0 {
+		return receiptDraft{}, &PriceMismatchError{Items: mismatches}
+	}
+
+	if offline {
+		for _, shortage := range db.stockShortages(draft.lines, products) {
+			if draft.shortages == nil {
+				draft.shortages = make(map[int64]types.InsufficientStockResponse)
+			}
+			draft.shortages[shortage.ProductID] = shortage
+		}
+	} else if err := db.checkStock(draft.lines, products); err != nil {
+		return receiptDraft{}, err
+	}
+
+	return draft, nil
+}
+
+// receiptSale рассчитанный, но еще не записанный чек
+type receiptSale struct {
+	shiftID        int64
+	card           receiptCard
+	draft          receiptDraft
+	payments       []types.PaymentResponse
+	pointsRedeemed types.Money
+	pointsAccrued  int64
+}
+
+// prepareReceipt проверяет карту, считает строки, скидки, оплаты и баллы для чека смены shiftID,
+// проданного в момент saleTime. Общая часть проведения чека и предварительного расчета, в базу ничего не пишет.
+// offline — чек кассы без связи, см. priceReceipt.
+func (db *DB) prepareReceipt(tx *sql.Tx, receiptInfo types.ReceiptInfoRequest, shiftID int64, saleTime time.Time, offline bool) (receiptSale, error) {
+	sale := receiptSale{shiftID: shiftID}
+	var err error
+
+	sale.card, err = db.resolveLoyaltyCard(tx, receiptInfo.LoyaltyCardNumber)
+	if err != nil {
+		return receiptSale{}, err
+	}
+
+	sale.draft, err = db.priceReceipt(tx, receiptInfo, sale.card.tier.discountPercent, saleTime, offline)
+	if err != nil {
+		return receiptSale{}, err
+	}
+
+	sale.payments, err = allocatePayments(sale.draft.total, receiptInfo.Payments)
+	if err != nil {
+		return receiptSale{}, err
+	}
+
+	sale.pointsRedeemed, sale.pointsAccrued, err = db.calculateReceiptPoints(tx, sale.card.id, sale.draft, sale.payments)
+	if err != nil {
+		return receiptSale{}, err
+	}
+	return sale, nil
+}
+
+func (s *receiptSale) toReceiptResponse(id int64, number int, date time.Time) types.ReceiptResponse {
+	response := s.draft.toReceiptResponse(id, number, date)
+	response.ShiftID = s.shiftID
+	response.Payments = s.payments
+	response.Change = paymentsChange(s.payments)
+	response.PointsAccrued = s.pointsAccrued
+	return response
+}
+
+func (d *receiptDraft) toReceiptResponse(id int64, number int, date time.Time) types.ReceiptResponse {
+	response := types.ReceiptResponse{
+		ID:       id,
+		Number:   number,
+		Date:     date,
+		Total:    d.total,
+		Discount: d.discount,
+		Products: make([]types.ReceiptLineResponse, len(d.lines)),
+	}
+	for i, line := range d.lines {
+		response.Products[i] = types.ReceiptLineResponse{
+			ProductID:         line.productID,
+			Name:              line.name,
+			Quantity:          line.quantity,
+			Price:             line.price,
+			Discount:          line.discount,
+			PromotionDiscount: line.promotionDiscount,
+			Amount:            line.amount,
+			VatRate:           line.vatRate,
+			VatAmount:         line.vatAmount,
+		}
+		if line.expected != nil {
+			response.Products[i].ExpectedPrice = &line.expected.price
+			response.Products[i].ExpectedAmount = &line.expected.amount
+		}
+		if line.promotion != nil {
+			response.Products[i].PromotionID = &line.promotion.id
+			response.Products[i].PromotionName = line.promotion.name
+		}
+	}
+	response.Taxes = taxTotals(response.Products, func(line types.ReceiptLineResponse) (float64, types.Money, types.Money) {
+		return line.VatRate, line.Amount, line.VatAmount
+	})
+	return response
+}
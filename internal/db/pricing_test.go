@@ -0,0 +1,212 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+type testProduct struct {
+	id       int64
+	name     string
+	price    types.Money
+	category string
+	stock    int64
+	vatRate  any
+}
+
+func expectLockProducts(mock sqlmock.Sqlmock, products ...testProduct) {
+	rows := sqlmock.NewRows([]string{"id", "name", "price", "category", "quantity_in_stock", "vat_rate"})
+	for _, p := range products {
+		rows.AddRow(p.id, p.name, p.price.String(), p.category, p.stock, p.vatRate)
+	}
+	mock.ExpectQuery(`from Product as p\s+left join Category_Tax_Rate as ctr on ctr.category = p.category\s+where p.id = any\(\$1\)\s+order by p.id\s+for update of p`).WillReturnRows(rows)
+}
+
+func moneyPtr(m types.Money) *types.Money {
+	return &m
+}
+
+var (
+	testMilk  = testProduct{id: 1, name: "Milk", price: 8990, category: "dairy", stock: 10}
+	testBread = testProduct{id: 2, name: "Bread", price: 4550, category: "bakery", stock: 10}
+)
+
+func TestCreateNewReceiptPricesOnServer(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.vatDefaultRate = 20
+	milk := testMilk
+	milk.vatRate = 10.0
+	date := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	expectLockProducts(mock, milk, testBread)
+	expectActivePromotions(mock)
+	expectNextReceiptNumber(mock, "day:1:2026-03-14", 5)
+	mock.ExpectQuery(`insert into Receipt \(`).
+		WithArgs(types.Money(36070), int64(3), nil, int64(8), 5, "1-20260314-0005", sql.NullTime{}, sql.NullString{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date_time"}).AddRow(10, date))
+	mock.ExpectExec(`insert into Receipt_Product`).
+		WithArgs(int64(10), int64(1), int64(3), types.Money(26970), types.Money(8990), types.Money(0), nil, types.Money(0), 10.0, types.Money(2452), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectStockUpdate(mock, 1, -3, types.StockMovementSale)
+	mock.ExpectExec(`insert into Receipt_Product`).
+		WithArgs(int64(10), int64(2), int64(2), types.Money(9100), types.Money(4550), types.Money(0), nil, types.Money(0), 20.0, types.Money(1517), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectStockUpdate(mock, 2, -2, types.StockMovementSale)
+	mock.ExpectExec(`insert into Receipt_Payment`).
+		WithArgs(int64(10), types.PaymentMethodCard, types.Money(10000), types.Money(10000), types.Money(0), "slip-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`insert into Receipt_Payment`).
+		WithArgs(int64(10), types.PaymentMethodCash, types.Money(26070), types.Money(30000), types.Money(3930), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	got, err := db.CreateNewReceipt(types.ReceiptInfoRequest{
+		TellerID: 3,
+		Products: []types.ReceiptProductInfoRequest{
+			{ProductID: 1, Quantity: 3},
+			{ProductID: 2, Quantity: 2, Price: moneyPtr(4550), Amount: moneyPtr(9100)},
+		},
+		Payments: []types.PaymentRequest{
+			{Method: types.PaymentMethodCash, Amount: 30000},
+			{Method: types.PaymentMethodCard, Amount: 10000, Reference: "slip-1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.ReceiptResponse{
+		ID:            10,
+		Number:        5,
+		PrintedNumber: "1-20260314-0005",
+		Date:          date,
+		ShiftID:       8,
+		Total:         36070,
+		Products: []types.ReceiptLineResponse{
+			{ProductID: 1, Name: "Milk", Quantity: 3, Price: 8990, Amount: 26970, VatRate: 10, VatAmount: 2452},
+			{ProductID: 2, Name: "Bread", Quantity: 2, Price: 4550, Amount: 9100, VatRate: 20, VatAmount: 1517},
+		},
+		Taxes: []types.TaxTotalResponse{
+			{Rate: 10, Amount: 26970, Tax: 2452},
+			{Rate: 20, Amount: 9100, Tax: 1517},
+		},
+		Payments: []types.PaymentResponse{
+			{Method: types.PaymentMethodCard, Amount: 10000, Tendered: 10000, Reference: "slip-1"},
+			{Method: types.PaymentMethodCash, Amount: 26070, Tendered: 30000, Change: 3930},
+		},
+		Change: 3930,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CreateNewReceipt() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCreateNewReceiptRejectsClientPrices(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	expectLockProducts(mock, testMilk, testBread)
+	expectActivePromotions(mock)
+	mock.ExpectRollback()
+
+	_, err := db.CreateNewReceipt(types.ReceiptInfoRequest{
+		TellerID: 3,
+		Products: []types.ReceiptProductInfoRequest{
+			{ProductID: 1, Quantity: 3, Price: moneyPtr(7990)},
+			{ProductID: 2, Quantity: 2, Amount: moneyPtr(0)},
+		},
+	})
+	var mismatch *PriceMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("CreateNewReceipt() error = %v, want PriceMismatchError", err)
+	}
+	want := []types.PriceMismatchResponse{
+		{ProductID: 1, ExpectedPrice: 8990, ReceivedPrice: moneyPtr(7990), ExpectedAmount: 26970},
+		{ProductID: 2, ExpectedPrice: 4550, ExpectedAmount: 9100, ReceivedAmount: moneyPtr(0)},
+	}
+	if !reflect.DeepEqual(mismatch.Items, want) {
+		t.Errorf("mismatches = %+v, want %+v", mismatch.Items, want)
+	}
+}
+
+func TestCreateNewReceiptValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		products []types.ReceiptProductInfoRequest
+		queried  bool
+	}{
+		{name: "no products"},
+		{name: "zero quantity", products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 0}}},
+		{name: "unknown product", products: []types.ReceiptProductInfoRequest{{ProductID: 9, Quantity: 1}}, queried: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			expectOpenShift(mock, 3, 8)
+			if tt.queried {
+				expectLockProducts(mock, testMilk)
+				expectActivePromotions(mock)
+			}
+			mock.ExpectRollback()
+
+			_, err := db.CreateNewReceipt(types.ReceiptInfoRequest{TellerID: 3, Products: tt.products})
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Errorf("CreateNewReceipt() error = %v, want ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestPreviewReceiptWritesNothing(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	expectLockProducts(mock, testMilk, testBread)
+	expectActivePromotions(mock)
+	mock.ExpectRollback()
+
+	got, err := db.PreviewReceipt(types.ReceiptInfoRequest{
+		TellerID: 3,
+		Products: []types.ReceiptProductInfoRequest{
+			{ProductID: 1, Quantity: 3},
+			{ProductID: 2, Quantity: 2},
+		},
+		Payments: []types.PaymentRequest{{Method: types.PaymentMethodCash, Amount: 50000}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 0 || got.Total != 36070 || got.ShiftID != 8 || got.Change != 13930 {
+		t.Errorf("PreviewReceipt() = %+v, want unsaved receipt total 360.7 change 139.3 in shift 8", got)
+	}
+}
+
+func TestPreviewReceiptReportsErrors(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	expectLockProducts(mock, testMilk)
+	expectActivePromotions(mock)
+	mock.ExpectRollback()
+
+	_, err := db.PreviewReceipt(types.ReceiptInfoRequest{
+		TellerID: 3,
+		Products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 1, Price: moneyPtr(7990)}},
+	})
+	var mismatch *PriceMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("PreviewReceipt() error = %v, want PriceMismatchError", err)
+	}
+}
@@ -0,0 +1,478 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const promotionClockLayout = "15:04"
+
+const promotionColumns = `id, name, kind, coalesce(product_id, 0), coalesce(category, ''), coalesce(percent, 0), coalesce(amount, 0), buy_quantity, free_quantity,
+	coalesce(coupon_code, ''), starts_at, ends_at, coalesce(to_char(time_from, 'HH24:MI'), ''), coalesce(to_char(time_to, 'HH24:MI'), ''),
+	active, created_at`
+
+type promotion struct {
+	id           int64
+	name         string
+	kind         string
+	productID    int64
+	category     string
+	percent      float64
+	amount       types.Money
+	buyQuantity  int64
+	freeQuantity int64
+	bundle       []types.PromotionBundleItemResponse
+	couponCode   string
+	timeFrom     string
+	timeTo       string
+}
+
+// matches акция на товар или на категорию распространяется на строку
+func (p promotion) matches(line receiptLine) bool {
+	if p.productID != 0 {
+		return line.productID == p.productID
+	}
+	return p.category != "" && line.category == p.category
+}
+
+// activeAt проверяет счастливые часы. Окно с time_from позже time_to переходит через полночь.
+func (p promotion) activeAt(now time.Time) bool {
+	if p.timeFrom == "" {
+		return true
+	}
+	clock := now.Format(promotionClockLayout)
+	if p.timeFrom <= p.timeTo {
+		return clock >= p.timeFrom && clock < p.timeTo
+	}
+	return clock >= p.timeFrom || clock < p.timeTo
+}
+
+// lineDiscount скидка по акции на строку целиком, не больше суммы строки
+func (p promotion) lineDiscount(line receiptLine) types.Money {
+	var discount types.Money
+	switch p.kind {
+	case types.PromotionKindPercent:
+		discount = line.gross.Percent(p.percent)
+	case types.PromotionKindFixed:
+		discount = min(p.amount, line.price).Mul(line.quantity)
+	case types.PromotionKindBuyNGetM:
+		free := line.quantity / (p.buyQuantity + p.freeQuantity) * p.freeQuantity
+		discount = line.price.Mul(free)
+	}
+	return min(discount, line.gross)
+}
+
+// applyPromotions раскладывает акции по строкам чека. Сначала собираются комплекты,
+// затем каждой оставшейся строке достается самая выгодная для покупателя акция.
+// На строку приходится не больше одной акции.
+func applyPromotions(lines []receiptLine, promotions []promotion) {
+	for _, p := range promotions {
+		if p.kind == types.PromotionKindBundle {
+			applyBundle(lines, p)
+		}
+	}
+
+	for i := range lines {
+		if lines[i].promotion != nil {
+			continue
+		}
+		for _, p := range promotions {
+			if p.kind == types.PromotionKindBundle || !p.matches(lines[i]) {
+				continue
+			}
+			if discount := p.lineDiscount(lines[i]); discount > lines[i].promotionDiscount {
+				lines[i].promotion = &p
+				lines[i].promotionDiscount = discount
+			}
+		}
+	}
+}
+
+// applyBundle продает полные комплекты по цене акции. Скидка делится между строками
+// комплекта пропорционально их стоимости, остаток от округления уходит последней строке.
+func applyBundle(lines []receiptLine, p promotion) {
+	index := make(map[int64]int, len(p.bundle))
+	for i, line := range lines {
+		if _, ok := index[line.productID]; !ok && line.promotion == nil {
+			index[line.productID] = i
+		}
+	}
+
+	var count int64 = -1
+	for _, item := range p.bundle {
+		i, ok := index[item.ProductID]
+		if !ok {
+			return
+		}
+		if sets := lines[i].quantity / item.Quantity; count < 0 || sets < count {
+			count = sets
+		}
+	}
+	if count <= 0 {
+		return
+	}
+
+	var full types.Money
+	for _, item := range p.bundle {
+		full += lines[index[item.ProductID]].price.Mul(item.Quantity * count)
+	}
+	discount := full - p.amount.Mul(count)
+	if discount <= 0 {
+		return
+	}
+
+	rest := discount
+	for n, item := range p.bundle {
+		line := &lines[index[item.ProductID]]
+		part := discount.MulDiv(int64(line.price.Mul(item.Quantity*count)), int64(full))
+		if n == len(p.bundle)-1 {
+			part = rest
+		}
+		rest -= part
+		line.promotion = &p
+		line.promotionDiscount = part
+	}
+}
+
+// getActivePromotions акции, действующие в момент now. Купонные акции попадают в расчет,
+// только если их код предъявлен. Неизвестный или недействующий купон считается ошибкой клиента.
+func (db *DB) getActivePromotions(q queryer, now time.Time, coupons []string) ([]promotion, error) {
+	codes := make([]string, 0, len(coupons))
+	for _, coupon := range coupons {
+		if code := normalizeCouponCode(coupon); code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	query := `
+	select id, name, kind, coalesce(product_id, 0), coalesce(category, ''), coalesce(percent, 0), coalesce(amount, 0), buy_quantity, free_quantity,
+	coalesce(coupon_code, ''), coalesce(to_char(time_from, 'HH24:MI'), ''), coalesce(to_char(time_to, 'HH24:MI'), '')
+	from Promotion
+	where active
+	and (starts_at is null or starts_at <= $1)
+	and (ends_at is null or ends_at > $1)
+	and (coupon_code is null or coupon_code = any($2))
+	order by id`
+
+	rows, err := q.Query(query, now, pq.Array(codes))
+	if err != nil {
+		return nil, fmt.Errorf("getActivePromotions: %v", err)
+	}
+	defer rows.Close()
+
+	var promotions []promotion
+	var bundleIDs []int64
+	accepted := make(map[string]bool, len(codes))
+	for rows.Next() {
+		var p promotion
+		if err := rows.Scan(&p.id, &p.name, &p.kind, &p.productID, &p.category, &p.percent, &p.amount, &p.buyQuantity, &p.freeQuantity,
+			&p.couponCode, &p.timeFrom, &p.timeTo); err != nil {
+			return nil, fmt.Errorf("getActivePromotions: %v", err)
+		}
+		if !p.activeAt(now) {
+			continue
+		}
+		if p.couponCode != "" {
+			accepted[p.couponCode] = true
+		}
+		if p.kind == types.PromotionKindBundle {
+			bundleIDs = append(bundleIDs, p.id)
+		}
+		promotions = append(promotions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getActivePromotions: %v", err)
+	}
+
+	for _, code := range codes {
+		if !accepted[code] {
+			return nil, newValidationError("coupon %q is not valid", code)
+		}
+	}
+
+	if len(bundleIDs) > 0 {
+		items, err := getPromotionBundleItems(q, bundleIDs)
+		if err != nil {
+			return nil, fmt.Errorf("getActivePromotions: %v", err)
+		}
+		for i := range promotions {
+			promotions[i].bundle = items[promotions[i].id]
+		}
+	}
+	return promotions, nil
+}
+
+func getPromotionBundleItems(q queryer, promotionIDs []int64) (map[int64][]types.PromotionBundleItemResponse, error) {
+	rows, err := q.Query("select promotion_id, product_id, quantity from Promotion_Bundle_Item where promotion_id = any($1) order by promotion_id, product_id", pq.Array(promotionIDs))
+	if err != nil {
+		return nil, fmt.Errorf("getPromotionBundleItems: %v", err)
+	}
+	defer rows.Close()
+
+	items := make(map[int64][]types.PromotionBundleItemResponse)
+	for rows.Next() {
+		var promotionID int64
+		var item types.PromotionBundleItemResponse
+		if err := rows.Scan(&promotionID, &item.ProductID, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("getPromotionBundleItems: %v", err)
+		}
+		items[promotionID] = append(items[promotionID], item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getPromotionBundleItems: %v", err)
+	}
+	return items, nil
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func validatePromotion(promotionInfo *types.PromotionRequest) error {
+	promotionInfo.Name = strings.TrimSpace(promotionInfo.Name)
+	promotionInfo.Category = strings.TrimSpace(promotionInfo.Category)
+	promotionInfo.CouponCode = normalizeCouponCode(promotionInfo.CouponCode)
+
+	if promotionInfo.Name == "" {
+		return newValidationError("name is required")
+	}
+
+	switch promotionInfo.Kind {
+	case types.PromotionKindPercent, types.PromotionKindFixed, types.PromotionKindBuyNGetM:
+		if (promotionInfo.ProductID == 0) == (promotionInfo.Category == "") {
+			return newValidationError("exactly one of product_id and category is required")
+		}
+		if len(promotionInfo.BundleItems) > 0 {
+			return newValidationError("bundle_items are allowed only for bundle promotions")
+		}
+	case types.PromotionKindBundle:
+		if promotionInfo.ProductID != 0 || promotionInfo.Category != "" {
+			return newValidationError("bundle promotion uses bundle_items instead of product_id and category")
+		}
+	default:
+		return newValidationError("unknown promotion kind %q", promotionInfo.Kind)
+	}
+
+	if promotionInfo.Kind != types.PromotionKindPercent && promotionInfo.Percent != 0 {
+		return newValidationError("percent is allowed only for percent promotions")
+	}
+	if promotionInfo.Kind != types.PromotionKindFixed && promotionInfo.Kind != types.PromotionKindBundle && promotionInfo.Amount != 0 {
+		return newValidationError("amount is allowed only for fixed and bundle promotions")
+	}
+
+	switch promotionInfo.Kind {
+	case types.PromotionKindPercent:
+		if promotionInfo.Percent <= 0 || promotionInfo.Percent > 100 {
+			return newValidationError("percent must be in (0, 100]")
+		}
+	case types.PromotionKindFixed:
+		if promotionInfo.Amount <= 0 {
+			return newValidationError("fixed discount amount must be positive")
+		}
+	case types.PromotionKindBuyNGetM:
+		if promotionInfo.BuyQuantity <= 0 || promotionInfo.FreeQuantity <= 0 {
+			return newValidationError("buy_quantity and free_quantity must be positive")
+		}
+	case types.PromotionKindBundle:
+		if promotionInfo.Amount <= 0 {
+			return newValidationError("bundle price amount must be positive")
+		}
+		seen := make(map[int64]bool, len(promotionInfo.BundleItems))
+		var units int64
+		for _, item := range promotionInfo.BundleItems {
+			if item.Quantity <= 0 {
+				return newValidationError("bundle product %d: quantity must be positive", item.ProductID)
+			}
+			if seen[item.ProductID] {
+				return newValidationError("bundle product %d is listed twice", item.ProductID)
+			}
+			seen[item.ProductID] = true
+			units += item.Quantity
+		}
+		if units < 2 {
+			return newValidationError("bundle must contain at least two units")
+		}
+	}
+
+	if (promotionInfo.TimeFrom == "") != (promotionInfo.TimeTo == "") {
+		return newValidationError("time_from and time_to must be set together")
+	}
+	for _, clock := range []string{promotionInfo.TimeFrom, promotionInfo.TimeTo} {
+		if clock == "" {
+			continue
+		}
+		if _, err := time.Parse(promotionClockLayout, clock); err != nil {
+			return newValidationError("time must be in HH:MM format, got %q", clock)
+		}
+	}
+	if promotionInfo.TimeFrom != "" && promotionInfo.TimeFrom == promotionInfo.TimeTo {
+		return newValidationError("time_from and time_to must differ")
+	}
+
+	if promotionInfo.StartsAt != nil && promotionInfo.EndsAt != nil && !promotionInfo.EndsAt.After(*promotionInfo.StartsAt) {
+		return newValidationError("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// CreatePromotion заводит акцию. Код купона хранится в верхнем регистре и уникален среди действующих акций.
+func (db *DB) CreatePromotion(promotionInfo types.PromotionRequest) (types.PromotionResponse, error) {
+	if err := validatePromotion(&promotionInfo); err != nil {
+		return types.PromotionResponse{}, err
+	}
+
+	productIDs := make([]int64, 0, len(promotionInfo.BundleItems)+1)
+	if promotionInfo.ProductID != 0 {
+		productIDs = append(productIDs, promotionInfo.ProductID)
+	}
+	for _, item := range promotionInfo.BundleItems {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("CreatePromotion: %v", err)
+	}
+	defer tx.Rollback()
+
+	if len(productIDs) > 0 {
+		var found int
+		if err := tx.QueryRow("select count(*) from Product where id = any($1)", pq.Array(productIDs)).Scan(&found); err != nil {
+			return types.PromotionResponse{}, fmt.Errorf("CreatePromotion: %v", err)
+		}
+		if found != len(productIDs) {
+			return types.PromotionResponse{}, newValidationError("promotion refers to unknown products")
+		}
+	}
+
+	if promotionInfo.CouponCode != "" {
+		var exists bool
+		if err := tx.QueryRow("select exists(select 1 from Promotion where coupon_code = $1 and active)", promotionInfo.CouponCode).Scan(&exists); err != nil {
+			return types.PromotionResponse{}, fmt.Errorf("CreatePromotion: %v", err)
+		}
+		if exists {
+			return types.PromotionResponse{}, newConflictError("coupon %q is already used by an active promotion", promotionInfo.CouponCode)
+		}
+	}
+
+	var promotionID int64
+	err = tx.QueryRow(`
+	insert into Promotion (name, kind, product_id, category, percent, amount, buy_quantity, free_quantity, coupon_code, starts_at, ends_at, time_from, time_to)
+	values ($1, $2, $3, nullif($4, ''), nullif($5::numeric, 0), nullif($6::numeric, 0), $7, $8, nullif($9, ''), $10, $11, nullif($12, '')::time, nullif($13, '')::time)
+	returning id`,
+		promotionInfo.Name, promotionInfo.Kind, nullID(promotionInfo.ProductID), promotionInfo.Category, promotionInfo.Percent, promotionInfo.Amount,
+		promotionInfo.BuyQuantity, promotionInfo.FreeQuantity, promotionInfo.CouponCode, promotionInfo.StartsAt, promotionInfo.EndsAt,
+		promotionInfo.TimeFrom, promotionInfo.TimeTo,
+	).Scan(&promotionID)
+	if err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("CreatePromotion: %v", err)
+	}
+
+	for _, item := range promotionInfo.BundleItems {
+		_, err := tx.Exec("insert into Promotion_Bundle_Item (promotion_id, product_id, quantity) values ($1, $2, $3)", promotionID, item.ProductID, item.Quantity)
+		if err != nil {
+			return types.PromotionResponse{}, fmt.Errorf("CreatePromotion: %v", err)
+		}
+	}
+
+	response, err := db.getPromotion(tx, promotionID)
+	if err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("CreatePromotion: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("CreatePromotion: %v", err)
+	}
+	return response, nil
+}
+
+// GetPromotions все акции, новые первыми. activeOnly оставляет только не отключенные.
+func (db *DB) GetPromotions(activeOnly bool) ([]types.PromotionResponse, error) {
+	rows, err := db.db.Query("select "+promotionColumns+" from Promotion where active or not $1 order by id desc", activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("GetPromotions: %v", err)
+	}
+	defer rows.Close()
+
+	var promotions []types.PromotionResponse
+	var ids []int64
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetPromotions: %v", err)
+		}
+		promotions = append(promotions, promotion)
+		ids = append(ids, promotion.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetPromotions: %v", err)
+	}
+
+	items, err := getPromotionBundleItems(db.db, ids)
+	if err != nil {
+		return nil, fmt.Errorf("GetPromotions: %v", err)
+	}
+	for i := range promotions {
+		promotions[i].BundleItems = items[promotions[i].ID]
+	}
+	return promotions, nil
+}
+
+// DeactivatePromotion отключает акцию. Акции не удаляются, на них ссылаются строки проданных чеков.
+func (db *DB) DeactivatePromotion(promotionID int64) (types.PromotionResponse, error) {
+	result, err := db.db.Exec("update Promotion set active = false where id = $1", promotionID)
+	if err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("DeactivatePromotion: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("DeactivatePromotion: %v", err)
+	} else if affected == 0 {
+		return types.PromotionResponse{}, newNotFoundError("promotion %d not found", promotionID)
+	}
+
+	promotion, err := db.getPromotion(db.db, promotionID)
+	if err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("DeactivatePromotion: %w", err)
+	}
+	return promotion, nil
+}
+
+func (db *DB) getPromotion(q queryer, promotionID int64) (types.PromotionResponse, error) {
+	promotion, err := scanPromotion(q.QueryRow("select "+promotionColumns+" from Promotion where id = $1", promotionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.PromotionResponse{}, newNotFoundError("promotion %d not found", promotionID)
+	}
+	if err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("getPromotion: %v", err)
+	}
+
+	items, err := getPromotionBundleItems(q, []int64{promotionID})
+	if err != nil {
+		return types.PromotionResponse{}, fmt.Errorf("getPromotion: %v", err)
+	}
+	promotion.BundleItems = items[promotionID]
+	return promotion, nil
+}
+
+func scanPromotion(row rowScanner) (types.PromotionResponse, error) {
+	var promotion types.PromotionResponse
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&promotion.ID, &promotion.Name, &promotion.Kind, &promotion.ProductID, &promotion.Category, &promotion.Percent, &promotion.Amount,
+		&promotion.BuyQuantity, &promotion.FreeQuantity, &promotion.CouponCode, &startsAt, &endsAt, &promotion.TimeFrom, &promotion.TimeTo,
+		&promotion.Active, &promotion.CreatedAt)
+	if err != nil {
+		return types.PromotionResponse{}, err
+	}
+	if startsAt.Valid {
+		promotion.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		promotion.EndsAt = &endsAt.Time
+	}
+	return promotion, nil
+}
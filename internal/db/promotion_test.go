@@ -0,0 +1,256 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPromotionActiveAt(t *testing.T) {
+	day := promotion{timeFrom: "10:00", timeTo: "12:00"}
+	night := promotion{timeFrom: "22:00", timeTo: "02:00"}
+	tests := []struct {
+		name  string
+		p     promotion
+		clock string
+		want  bool
+	}{
+		{name: "no window", p: promotion{}, clock: "03:00", want: true},
+		{name: "day before", p: day, clock: "09:59", want: false},
+		{name: "day start", p: day, clock: "10:00", want: true},
+		{name: "day inside", p: day, clock: "11:30", want: true},
+		{name: "day end is exclusive", p: day, clock: "12:00", want: false},
+		{name: "night before", p: night, clock: "21:59", want: false},
+		{name: "night start", p: night, clock: "22:00", want: true},
+		{name: "night before midnight", p: night, clock: "23:59", want: true},
+		{name: "night midnight", p: night, clock: "00:00", want: true},
+		{name: "night after midnight", p: night, clock: "01:59", want: true},
+		{name: "night end is exclusive", p: night, clock: "02:00", want: false},
+		{name: "night daytime", p: night, clock: "12:00", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse("2006-01-02 15:04", "2026-03-14 "+tt.clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.p.activeAt(now); got != tt.want {
+				t.Errorf("activeAt(%s) = %v, want %v", tt.clock, got, tt.want)
+			}
+		})
+	}
+}
+
+func testLine(productID int64, category string, price types.Money, quantity int64) receiptLine {
+	return receiptLine{productID: productID, category: category, price: price, quantity: quantity, gross: price.Mul(quantity)}
+}
+
+func TestApplyPromotions(t *testing.T) {
+	percent := promotion{id: 1, kind: types.PromotionKindPercent, productID: 1, percent: 10}
+	fixed := promotion{id: 2, kind: types.PromotionKindFixed, productID: 1, amount: 5000}
+	category := promotion{id: 3, kind: types.PromotionKindPercent, category: "dairy", percent: 20}
+	buy2get1 := promotion{id: 4, kind: types.PromotionKindBuyNGetM, productID: 2, buyQuantity: 2, freeQuantity: 1}
+	bundle := promotion{id: 5, kind: types.PromotionKindBundle, amount: 12000, bundle: []types.PromotionBundleItemResponse{
+		{ProductID: 1, Quantity: 1},
+		{ProductID: 2, Quantity: 1},
+	}}
+
+	type want struct {
+		promotionID int64
+		discount    types.Money
+	}
+	tests := []struct {
+		name       string
+		lines      []receiptLine
+		promotions []promotion
+		want       []want
+	}{
+		{
+			name:       "percent",
+			lines:      []receiptLine{testLine(1, "", 10000, 3)},
+			promotions: []promotion{percent},
+			want:       []want{{1, 3000}},
+		},
+		{
+			name:       "fixed per unit is capped by price",
+			lines:      []receiptLine{testLine(1, "", 3000, 2)},
+			promotions: []promotion{fixed},
+			want:       []want{{2, 6000}},
+		},
+		{
+			name:       "best promotion wins",
+			lines:      []receiptLine{testLine(1, "", 10000, 2)},
+			promotions: []promotion{percent, fixed},
+			want:       []want{{2, 10000}},
+		},
+		{
+			name:       "category",
+			lines:      []receiptLine{testLine(7, "dairy", 5000, 1), testLine(8, "bread", 5000, 1)},
+			promotions: []promotion{category},
+			want:       []want{{3, 1000}, {0, 0}},
+		},
+		{
+			name:       "buy 2 get 1 counts full sets only",
+			lines:      []receiptLine{testLine(2, "", 5000, 7)},
+			promotions: []promotion{buy2get1},
+			want:       []want{{4, 10000}},
+		},
+		{
+			name:       "buy 2 get 1 below a set",
+			lines:      []receiptLine{testLine(2, "", 5000, 2)},
+			promotions: []promotion{buy2get1},
+			want:       []want{{0, 0}},
+		},
+		{
+			name:       "bundle splits discount by line value",
+			lines:      []receiptLine{testLine(1, "", 10000, 3), testLine(2, "", 5000, 2)},
+			promotions: []promotion{bundle},
+			want:       []want{{5, 4000}, {5, 2000}},
+		},
+		{
+			name:       "bundle lines take no other promotion",
+			lines:      []receiptLine{testLine(1, "", 10000, 1), testLine(2, "", 5000, 1)},
+			promotions: []promotion{percent, buy2get1, bundle},
+			want:       []want{{5, 2000}, {5, 1000}},
+		},
+		{
+			name:       "incomplete bundle falls back to line promotions",
+			lines:      []receiptLine{testLine(1, "", 10000, 2)},
+			promotions: []promotion{bundle, percent},
+			want:       []want{{1, 2000}},
+		},
+		{
+			name:  "bundle priced above its items is skipped",
+			lines: []receiptLine{testLine(1, "", 5000, 1), testLine(2, "", 5000, 1)},
+			promotions: []promotion{{id: 6, kind: types.PromotionKindBundle, amount: 20000, bundle: []types.PromotionBundleItemResponse{
+				{ProductID: 1, Quantity: 1},
+				{ProductID: 2, Quantity: 1},
+			}}},
+			want: []want{{0, 0}, {0, 0}},
+		},
+		{
+			name:  "bundle rounding remainder goes to the last line",
+			lines: []receiptLine{testLine(1, "", 100, 1), testLine(2, "", 100, 1), testLine(3, "", 100, 1)},
+			promotions: []promotion{{id: 7, kind: types.PromotionKindBundle, amount: 200, bundle: []types.PromotionBundleItemResponse{
+				{ProductID: 1, Quantity: 1},
+				{ProductID: 2, Quantity: 1},
+				{ProductID: 3, Quantity: 1},
+			}}},
+			want: []want{{7, 33}, {7, 33}, {7, 34}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applyPromotions(tt.lines, tt.promotions)
+			for i, line := range tt.lines {
+				var got want
+				if line.promotion != nil {
+					got.promotionID = line.promotion.id
+				}
+				got.discount = line.promotionDiscount
+				if got != tt.want[i] {
+					t.Errorf("line %d: promotion %d discount %d, want promotion %d discount %d",
+						i, got.promotionID, got.discount, tt.want[i].promotionID, tt.want[i].discount)
+				}
+			}
+		})
+	}
+}
+
+func expectActivePromotions(mock sqlmock.Sqlmock, promotions ...promotion) {
+	rows := sqlmock.NewRows([]string{"id", "name", "kind", "product_id", "category", "percent", "amount", "buy_quantity", "free_quantity", "coupon_code", "time_from", "time_to"})
+	for _, p := range promotions {
+		rows.AddRow(p.id, p.name, p.kind, p.productID, p.category, p.percent, p.amount.String(), p.buyQuantity, p.freeQuantity, p.couponCode, p.timeFrom, p.timeTo)
+	}
+	mock.ExpectQuery(`from Promotion\s+where active`).WillReturnRows(rows)
+}
+
+func TestCreateNewReceiptAppliesPromotion(t *testing.T) {
+	db, mock := newMockDB(t)
+	date := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	expectLockProducts(mock, testMilk)
+	expectActivePromotions(mock, promotion{id: 2, name: "Milk -10%", kind: types.PromotionKindPercent, productID: 1, percent: 10, couponCode: "MILK10"})
+	expectNextReceiptNumber(mock, "day:1:2026-03-14", 5)
+	mock.ExpectQuery(`insert into Receipt \(`).
+		WithArgs(types.Money(24273), int64(3), nil, int64(8), 5, "1-20260314-0005", sql.NullTime{}, sql.NullString{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date_time"}).AddRow(10, date))
+	mock.ExpectExec(`insert into Receipt_Product`).
+		WithArgs(int64(10), int64(1), int64(3), types.Money(24273), types.Money(8990), types.Money(2697), int64(2), types.Money(2697), 0.0, types.Money(0), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectStockUpdate(mock, 1, -3, types.StockMovementSale)
+	mock.ExpectExec(`insert into Receipt_Payment`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	got, err := db.CreateNewReceipt(types.ReceiptInfoRequest{
+		TellerID: 3,
+		Coupons:  []string{" milk10 "},
+		Products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := got.Products[0]
+	if got.Total != 24273 || line.PromotionID == nil || *line.PromotionID != 2 || line.PromotionDiscount != 2697 {
+		t.Errorf("total %v, line %+v; want total 242.73 with promotion 2 discount 26.97", got.Total, line)
+	}
+}
+
+func TestCreateNewReceiptRejectsUnknownCoupon(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	expectLockProducts(mock, testMilk)
+	expectActivePromotions(mock)
+	mock.ExpectRollback()
+
+	_, err := db.CreateNewReceipt(types.ReceiptInfoRequest{
+		TellerID: 3,
+		Coupons:  []string{"NOPE"},
+		Products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 1}},
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("CreateNewReceipt() error = %v, want ValidationError", err)
+	}
+}
+
+func TestValidatePromotionValues(t *testing.T) {
+	bundle := []types.PromotionBundleItemRequest{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 1}}
+	tests := []struct {
+		name    string
+		request types.PromotionRequest
+		wantErr bool
+	}{
+		{name: "percent", request: types.PromotionRequest{Kind: types.PromotionKindPercent, ProductID: 1, Percent: 12.5}},
+		{name: "fixed", request: types.PromotionRequest{Kind: types.PromotionKindFixed, ProductID: 1, Amount: 1050}},
+		{name: "bundle", request: types.PromotionRequest{Kind: types.PromotionKindBundle, Amount: 12000, BundleItems: bundle}},
+		{name: "percent over 100", request: types.PromotionRequest{Kind: types.PromotionKindPercent, ProductID: 1, Percent: 101}, wantErr: true},
+		{name: "percent with amount", request: types.PromotionRequest{Kind: types.PromotionKindPercent, ProductID: 1, Percent: 10, Amount: 100}, wantErr: true},
+		{name: "fixed with percent", request: types.PromotionRequest{Kind: types.PromotionKindFixed, ProductID: 1, Percent: 10, Amount: 100}, wantErr: true},
+		{name: "fixed without amount", request: types.PromotionRequest{Kind: types.PromotionKindFixed, ProductID: 1}, wantErr: true},
+		{name: "bundle without amount", request: types.PromotionRequest{Kind: types.PromotionKindBundle, BundleItems: bundle}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.Name = "Акция"
+			err := validatePromotion(&tt.request)
+			if tt.wantErr {
+				if !hasErrorType(err, &ValidationError{}) {
+					t.Errorf("validatePromotion() error = %v, want ValidationError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("validatePromotion() error = %v", err)
+			}
+		})
+	}
+}
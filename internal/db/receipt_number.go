@@ -0,0 +1,112 @@
+package db
+
+import (
+	"database/sql"
+	"db5/config"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// receiptNumberFields значения для подстановки в шаблон номера чека
+type receiptNumberFields struct {
+	register string
+	shiftID  int64
+	date     time.Time
+	counter  int
+}
+
+// formatReceiptNumber подставляет поля в шаблон вида "{register}-{date}-{counter:4}"
+func formatReceiptNumber(format string, fields receiptNumberFields) (string, error) {
+	var result strings.Builder
+	rest := format
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			result.WriteString(rest)
+			return result.String(), nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed placeholder in %q", format)
+		}
+		result.WriteString(rest[:start])
+
+		name, width, hasWidth := strings.Cut(rest[start+1:start+end], ":")
+		switch name {
+		case "register":
+			result.WriteString(fields.register)
+		case "shift":
+			result.WriteString(strconv.FormatInt(fields.shiftID, 10))
+		case "date":
+			result.WriteString(fields.date.Format("20060102"))
+		case "counter":
+			digits := 0
+			if hasWidth {
+				var err error
+				digits, err = strconv.Atoi(width)
+				if err != nil || digits < 1 || digits > 10 {
+					return "", fmt.Errorf("invalid counter width %q in %q", width, format)
+				}
+			}
+			fmt.Fprintf(&result, "%0*d", digits, fields.counter)
+		default:
+			return "", fmt.Errorf("unknown placeholder {%s} in %q", name, format)
+		}
+		rest = rest[start+end+1:]
+	}
+}
+
+// validateReceiptNumbering проверяет шаблон при подключении, чтобы ошибка не всплыла на первом чеке.
+// Печатный номер уникален, поэтому шаблон должен различать счетчики: смену или кассу и день.
+func validateReceiptNumbering(numbering config.ReceiptNumberingConfig) error {
+	if !strings.Contains(numbering.Format, "{counter") {
+		return fmt.Errorf("receipt number format %q has no {counter}", numbering.Format)
+	}
+	switch numbering.Scope {
+	case config.ReceiptNumberScopeShift:
+		if !strings.Contains(numbering.Format, "{shift}") {
+			return fmt.Errorf("receipt number format %q has no {shift} for shift numbering", numbering.Format)
+		}
+	case config.ReceiptNumberScopeDay:
+		if !strings.Contains(numbering.Format, "{date}") {
+			return fmt.Errorf("receipt number format %q has no {date} for daily numbering", numbering.Format)
+		}
+		if !strings.Contains(numbering.Format, "{register}") {
+			return fmt.Errorf("receipt number format %q has no {register} for daily numbering", numbering.Format)
+		}
+	}
+	_, err := formatReceiptNumber(numbering.Format, receiptNumberFields{register: numbering.DefaultRegister, date: time.Now()})
+	return err
+}
+
+// nextReceiptNumber выдает следующий номер чека в смене или в кассе за день date, пустой date — сегодня.
+// Строка счетчика остается заблокированной до конца транзакции: параллельные чеки
+// той же кассы ждут друг друга, а откат чека возвращает номер, поэтому пропусков нет.
+func (db *DB) nextReceiptNumber(tx *sql.Tx, shiftID int64, date sql.NullTime) (int, string, error) {
+	fields := receiptNumberFields{shiftID: shiftID}
+	err := tx.QueryRow("select register, coalesce($2::timestamp, now()::timestamp) from Shift where id = $1", shiftID, date).Scan(&fields.register, &fields.date)
+	if err != nil {
+		return 0, "", fmt.Errorf("nextReceiptNumber: %v", err)
+	}
+
+	scope := fmt.Sprintf("shift:%d", shiftID)
+	if db.receiptNumbering.Scope == config.ReceiptNumberScopeDay {
+		scope = fmt.Sprintf("day:%s:%s", fields.register, fields.date.Format(time.DateOnly))
+	}
+
+	err = tx.QueryRow(`
+	insert into Receipt_Counter (scope, last_number) values ($1, 1)
+	on conflict (scope) do update set last_number = Receipt_Counter.last_number + 1
+	returning last_number`, scope).Scan(&fields.counter)
+	if err != nil {
+		return 0, "", fmt.Errorf("nextReceiptNumber: %v", err)
+	}
+
+	printed, err := formatReceiptNumber(db.receiptNumbering.Format, fields)
+	if err != nil {
+		return 0, "", fmt.Errorf("nextReceiptNumber: %v", err)
+	}
+	return fields.counter, printed, nil
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"db5/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFormatReceiptNumber(t *testing.T) {
+	fields := receiptNumberFields{
+		register: "K2",
+		shiftID:  41,
+		date:     time.Date(2026, 3, 4, 23, 59, 0, 0, time.UTC),
+		counter:  7,
+	}
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{format: "{register}-{date}-{counter:4}", want: "K2-20260304-0007"},
+		{format: "S{shift}/{counter}", want: "S41/7"},
+		{format: "{counter:1}", want: "7"},
+		{format: "no placeholders", want: "no placeholders"},
+		{format: "", want: ""},
+		{format: "{counter:10}", want: "0000000007"},
+		{format: "{counter:0}", wantErr: true},
+		{format: "{counter:11}", wantErr: true},
+		{format: "{counter:x}", wantErr: true},
+		{format: "{counter", wantErr: true},
+		{format: "{cashier}-{counter}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := formatReceiptNumber(tt.format, fields)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("formatReceiptNumber(%q) = %q, want error", tt.format, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("formatReceiptNumber(%q): %v", tt.format, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("formatReceiptNumber(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestFormatReceiptNumberWideCounter(t *testing.T) {
+	got, err := formatReceiptNumber("{counter:2}", receiptNumberFields{counter: 12345})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "12345" {
+		t.Errorf("counter wider than the template = %q, want %q", got, "12345")
+	}
+}
+
+func expectNextReceiptNumber(mock sqlmock.Sqlmock, scope string, counter int) {
+	mock.ExpectQuery(`select register, coalesce\(\$2::timestamp, now\(\)::timestamp\) from Shift where id = \$1`).WithArgs(int64(8), sql.NullTime{}).
+		WillReturnRows(sqlmock.NewRows([]string{"register", "now"}).AddRow("1", time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)))
+	mock.ExpectQuery(`insert into Receipt_Counter \(scope, last_number\) values \(\$1, 1\)`).WithArgs(scope).
+		WillReturnRows(sqlmock.NewRows([]string{"last_number"}).AddRow(counter))
+}
+
+func TestNextReceiptNumber(t *testing.T) {
+	tests := []struct {
+		name      string
+		numbering config.ReceiptNumberingConfig
+		scope     string
+		want      string
+	}{
+		{
+			name:      "day",
+			numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeDay, Format: "{register}-{date}-{counter:4}"},
+			scope:     "day:1:2026-03-14",
+			want:      "1-20260314-0012",
+		},
+		{
+			name:      "shift",
+			numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeShift, Format: "S{shift}/{counter}"},
+			scope:     "shift:8",
+			want:      "S8/12",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			db.receiptNumbering = tt.numbering
+			mock.ExpectBegin()
+			expectNextReceiptNumber(mock, tt.scope, 12)
+			tx, err := db.db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			number, printed, err := db.nextReceiptNumber(tx, 8, sql.NullTime{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if number != 12 || printed != tt.want {
+				t.Errorf("nextReceiptNumber() = %d, %q, want 12, %q", number, printed, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReceiptNumbering(t *testing.T) {
+	tests := []struct {
+		name      string
+		numbering config.ReceiptNumberingConfig
+		wantErr   bool
+	}{
+		{name: "default", numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeDay, Format: "{register}-{date}-{counter:4}"}},
+		{name: "shift", numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeShift, Format: "{shift}-{counter}"}},
+		{name: "no counter", numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeShift, Format: "{shift}"}, wantErr: true},
+		{name: "day without date", numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeDay, Format: "{register}-{counter}"}, wantErr: true},
+		{name: "day without register", numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeDay, Format: "{date}-{counter}"}, wantErr: true},
+		{name: "shift without shift", numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeShift, Format: "{register}-{counter}"}, wantErr: true},
+		{name: "unknown placeholder", numbering: config.ReceiptNumberingConfig{Scope: config.ReceiptNumberScopeShift, Format: "{shift}-{till}-{counter}"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateReceiptNumbering(tt.numbering)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateReceiptNumbering() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+)
+
+type soldLine struct {
+	id               int64
+	productID        int64
+	name             string
+	quantity         int64
+	price            types.Money
+	amount           types.Money
+	returnedQuantity int64
+	returnedAmount   types.Money
+	vatRate          sql.NullFloat64
+	vatAmount        types.Money
+	returnedVat      types.Money
+}
+
+func (l soldLine) remaining() int64 {
+	return l.quantity - l.returnedQuantity
+}
+
+// refundAmount сумма к возврату за quantity единиц строки. Последний возврат
+// забирает весь остаток суммы, чтобы копейки от округления не терялись.
+func (l soldLine) refundAmount(quantity int64) types.Money {
+	if quantity == l.remaining() {
+		return l.amount - l.returnedAmount
+	}
+	return l.amount.MulDiv(quantity, l.quantity)
+}
+
+// refundVat НДС в сумме возврата. Для строк, проданных до учета НДС, ставка неизвестна и НДС нулевой.
+func (l soldLine) refundVat(quantity int64, amount types.Money) types.Money {
+	if !l.vatRate.Valid {
+		return 0
+	}
+	if quantity == l.remaining() {
+		return l.vatAmount - l.returnedVat
+	}
+	return vatIncluded(amount, l.vatRate.Float64)
+}
+
+// CreateReceiptReturn оформляет возврат части строк чека и возвращает товар на склад.
+// Вернуть можно не больше, чем было продано за вычетом прошлых возвратов.
+func (db *DB) CreateReceiptReturn(receiptID int64, returnInfo types.ReceiptReturnRequest) (types.ReceiptReturnResponse, error) {
+	if returnInfo.TellerID == 0 {
+		return types.ReceiptReturnResponse{}, newValidationError("teller_id is required")
+	}
+	if len(returnInfo.Products) == 0 {
+		return types.ReceiptReturnResponse{}, newValidationError("return has no products")
+	}
+	if returnInfo.PaymentMethod != "" && !isPaymentMethod(returnInfo.PaymentMethod) {
+		return types.ReceiptReturnResponse{}, newValidationError("unknown payment method %q", returnInfo.PaymentMethod)
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %v", err)
+	}
+	defer tx.Rollback()
+
+	shiftID, err := db.requireOpenShift(tx, returnInfo.TellerID)
+	if err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %w", err)
+	}
+
+	receipt, err := db.lockReceipt(tx, receiptID)
+	if err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %w", err)
+	}
+	if receipt.status != types.ReceiptStatusActive {
+		return types.ReceiptReturnResponse{}, newConflictError("receipt %d is %s", receiptID, receipt.status)
+	}
+
+	lines, err := db.getSoldLines(tx, receiptID)
+	if err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %v", err)
+	}
+
+	returned := make(map[int64]int64, len(returnInfo.Products))
+	var order []int64
+	for _, item := range returnInfo.Products {
+		line, ok := lines[item.ReceiptProductID]
+		if !ok {
+			return types.ReceiptReturnResponse{}, newValidationError("line %d does not belong to receipt %d", item.ReceiptProductID, receiptID)
+		}
+		if item.Quantity <= 0 {
+			return types.ReceiptReturnResponse{}, newValidationError("line %d: quantity must be positive", item.ReceiptProductID)
+		}
+		if _, ok := returned[line.id]; !ok {
+			order = append(order, line.id)
+		}
+		returned[line.id] += item.Quantity
+		if returned[line.id] > line.remaining() {
+			return types.ReceiptReturnResponse{}, newConflictError("line %d: only %d left to return", line.id, line.remaining())
+		}
+	}
+
+	response := types.ReceiptReturnResponse{
+		ReceiptID: receiptID,
+		TellerID:  returnInfo.TellerID,
+	}
+	var total types.Money
+	for _, lineID := range order {
+		line := lines[lineID]
+		amount := line.refundAmount(returned[lineID])
+		total += amount
+		response.Products = append(response.Products, types.ReceiptReturnLineResponse{
+			ReceiptProductID: line.id,
+			ProductID:        line.productID,
+			Name:             line.name,
+			Quantity:         returned[lineID],
+			Price:            line.price,
+			Amount:           -amount,
+			VatAmount:        -line.refundVat(returned[lineID], amount),
+		})
+	}
+
+	refundable, err := db.getRefundablePayments(tx, receiptID)
+	if err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %v", err)
+	}
+	response.PaymentMethod, err = refundMethod(returnInfo.PaymentMethod, total, refundable)
+	if err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %w", err)
+	}
+	returnInfo.PaymentMethod = response.PaymentMethod
+
+	err = tx.QueryRow(
+		"insert into Receipt_Return (receipt_id, employee_id, shift_id, payment_method, total_amount) values ($1, $2, $3, $4, $5) returning id, date_time",
+		receiptID, returnInfo.TellerID, shiftID, returnInfo.PaymentMethod, total,
+	).Scan(&response.ID, &response.Date)
+	if err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %v", err)
+	}
+
+	response.PointsChange, err = db.applyReturnPoints(tx, receiptID, response.ID, total, returnInfo.PaymentMethod)
+	if err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %w", err)
+	}
+
+	for _, line := range response.Products {
+		_, err := tx.Exec("insert into Receipt_Return_Product (return_id, receipt_product_id, quantity, amount, vat_amount) values ($1, $2, $3, $4, $5)",
+			response.ID, line.ReceiptProductID, line.Quantity, -line.Amount, -line.VatAmount)
+		if err != nil {
+			return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %v", err)
+		}
+		if _, err := db.updateProductStock(tx, line.ProductID, line.Quantity, stockMovement{
+			kind: types.StockMovementReturn, documentType: types.StockDocumentReceiptReturn, documentID: response.ID, employeeID: returnInfo.TellerID,
+		}); err != nil {
+			return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.ReceiptReturnResponse{}, fmt.Errorf("CreateReceiptReturn: %v", err)
+	}
+
+	response.Total = -total
+	return response, nil
+}
+
+// getRefundablePayments сколько по каждому способу оплаты чека еще можно вернуть: оплачено за вычетом прошлых возвратов
+func (db *DB) getRefundablePayments(tx *sql.Tx, receiptID int64) (map[string]types.Money, error) {
+	query := `
+	select method, sum(amount)
+	from (
+		select method, amount from Receipt_Payment where receipt_id = $1
+		union all
+		select payment_method, -total_amount from Receipt_Return where receipt_id = $1
+	) as t
+	group by method`
+
+	rows, err := tx.Query(query, receiptID)
+	if err != nil {
+		return nil, fmt.Errorf("getRefundablePayments: %v", err)
+	}
+	defer rows.Close()
+
+	refundable := make(map[string]types.Money)
+	for rows.Next() {
+		var method string
+		var amount types.Money
+		if err := rows.Scan(&method, &amount); err != nil {
+			return nil, fmt.Errorf("getRefundablePayments: %v", err)
+		}
+		refundable[method] = amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getRefundablePayments: %v", err)
+	}
+	return refundable, nil
+}
+
+// refundMethod возврат идет тем способом, которым чек оплачен, и не больше оплаченного им.
+// Пустой method допустим, если чек оплачен одним способом.
+func refundMethod(method string, total types.Money, refundable map[string]types.Money) (string, error) {
+	if method == "" {
+		if len(refundable) == 0 && total == 0 {
+			return types.PaymentMethodCash, nil
+		}
+		if len(refundable) != 1 {
+			return "", newValidationError("payment_method is required for receipts paid by several methods")
+		}
+		for paid := range refundable {
+			method = paid
+		}
+	}
+	available, ok := refundable[method]
+	if !ok {
+		return "", newValidationError("receipt was not paid by %s", method)
+	}
+	if total > available {
+		return "", newValidationError("refund %s exceeds %s left to refund by %s", total, available, method)
+	}
+	return method, nil
+}
+
+type lockedReceipt struct {
+	status  string
+	shiftID sql.NullInt64
+}
+
+func (db *DB) lockReceipt(tx *sql.Tx, receiptID int64) (lockedReceipt, error) {
+	var receipt lockedReceipt
+	err := tx.QueryRow("select status, shift_id from Receipt where id = $1 for update", receiptID).Scan(&receipt.status, &receipt.shiftID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return lockedReceipt{}, newNotFoundError("receipt %d not found", receiptID)
+	}
+	if err != nil {
+		return lockedReceipt{}, fmt.Errorf("lockReceipt: %v", err)
+	}
+	return receipt, nil
+}
+
+// getSoldLines строки чека вместе с уже возвращенным количеством и суммой
+func (db *DB) getSoldLines(tx *sql.Tx, receiptID int64) (map[int64]soldLine, error) {
+	query := `
+	select
+	rp.id,
+	rp.product_id,
+	p.name,
+	rp.quantity,
+	rp.price_at_purchase,
+	rp.amount,
+	coalesce(sum(rrp.quantity), 0),
+	coalesce(sum(rrp.amount), 0),
+	rp.vat_rate,
+	rp.vat_amount,
+	coalesce(sum(rrp.vat_amount), 0)
+	from Receipt_Product as rp
+	join Product as p on p.id = rp.product_id
+	left join Receipt_Return_Product as rrp on rrp.receipt_product_id = rp.id
+	where rp.receipt_id = $1
+	group by rp.id, rp.product_id, p.name, rp.quantity, rp.price_at_purchase, rp.amount, rp.vat_rate, rp.vat_amount`
+
+	rows, err := tx.Query(query, receiptID)
+	if err != nil {
+		return nil, fmt.Errorf("getSoldLines: %v", err)
+	}
+	defer rows.Close()
+
+	lines := make(map[int64]soldLine)
+	for rows.Next() {
+		var line soldLine
+		if err := rows.Scan(&line.id, &line.productID, &line.name, &line.quantity, &line.price, &line.amount, &line.returnedQuantity, &line.returnedAmount,
+			&line.vatRate, &line.vatAmount, &line.returnedVat); err != nil {
+			return nil, fmt.Errorf("getSoldLines: %v", err)
+		}
+		lines[line.id] = line
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getSoldLines: %v", err)
+	}
+	return lines, nil
+}
+
+func (db *DB) getReceiptReturnsByReceiptID(receiptID int64) ([]types.ReceiptReturnResponse, error) {
+	var returns []types.ReceiptReturnResponse
+
+	rows, err := db.db.Query("select id, employee_id, payment_method, date_time, total_amount from Receipt_Return where receipt_id = $1 order by id", receiptID)
+	if err != nil {
+		return nil, fmt.Errorf("getReceiptReturnsByReceiptID: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		receiptReturn := types.ReceiptReturnResponse{ReceiptID: receiptID}
+		if err := rows.Scan(&receiptReturn.ID, &receiptReturn.TellerID, &receiptReturn.PaymentMethod, &receiptReturn.Date, &receiptReturn.Total); err != nil {
+			return nil, fmt.Errorf("getReceiptReturnsByReceiptID: %v", err)
+		}
+		receiptReturn.Total = -receiptReturn.Total
+		returns = append(returns, receiptReturn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getReceiptReturnsByReceiptID: %v", err)
+	}
+
+	for i := range returns {
+		returns[i].Products, err = db.getReceiptReturnLines(returns[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("getReceiptReturnsByReceiptID: %v", err)
+		}
+	}
+	return returns, nil
+}
+
+func (db *DB) getReceiptReturnLines(returnID int64) ([]types.ReceiptReturnLineResponse, error) {
+	query := `
+	select
+	rrp.receipt_product_id,
+	rp.product_id,
+	p.name,
+	rrp.quantity,
+	rp.price_at_purchase,
+	rrp.amount,
+	rrp.vat_amount
+	from Receipt_Return_Product as rrp
+	join Receipt_Product as rp on rp.id = rrp.receipt_product_id
+	join Product as p on p.id = rp.product_id
+	where rrp.return_id = $1
+	order by rrp.id`
+
+	var lines []types.ReceiptReturnLineResponse
+	rows, err := db.db.Query(query, returnID)
+	if err != nil {
+		return nil, fmt.Errorf("getReceiptReturnLines: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line types.ReceiptReturnLineResponse
+		if err := rows.Scan(&line.ReceiptProductID, &line.ProductID, &line.Name, &line.Quantity, &line.Price, &line.Amount, &line.VatAmount); err != nil {
+			return nil, fmt.Errorf("getReceiptReturnLines: %v", err)
+		}
+		line.Amount = -line.Amount
+		line.VatAmount = -line.VatAmount
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getReceiptReturnLines: %v", err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"db5/internal/types"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSoldLineRefundAmount(t *testing.T) {
+	line := soldLine{quantity: 3, amount: 10000}
+	tests := []struct {
+		name     string
+		line     soldLine
+		quantity int64
+		want     types.Money
+	}{
+		{name: "one of three", line: line, quantity: 1, want: 3333},
+		{name: "two of three", line: line, quantity: 2, want: 6667},
+		{name: "whole line", line: line, quantity: 3, want: 10000},
+		{name: "last unit takes the remainder", line: soldLine{quantity: 3, amount: 10000, returnedQuantity: 2, returnedAmount: 6666}, quantity: 1, want: 3334},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.line.refundAmount(tt.quantity); got != tt.want {
+				t.Errorf("refundAmount(%d) = %v, want %v", tt.quantity, got, tt.want)
+			}
+		})
+	}
+}
+
+func expectLockReceipt(mock sqlmock.Sqlmock, status string, shiftID any) {
+	mock.ExpectQuery(`select status, shift_id from Receipt where id = \$1 for update`).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "shift_id"}).AddRow(status, shiftID))
+}
+
+func expectSoldLines(mock sqlmock.Sqlmock, lines ...soldLine) {
+	rows := sqlmock.NewRows([]string{"id", "product_id", "name", "quantity", "price_at_purchase", "amount", "returned_quantity", "returned_amount", "vat_rate", "vat_amount", "returned_vat"})
+	for _, l := range lines {
+		var vatRate driver.Value
+		if l.vatRate.Valid {
+			vatRate = l.vatRate.Float64
+		}
+		rows.AddRow(l.id, l.productID, l.name, l.quantity, l.price.String(), l.amount.String(), l.returnedQuantity, l.returnedAmount.String(),
+			vatRate, l.vatAmount.String(), l.returnedVat.String())
+	}
+	mock.ExpectQuery(`from Receipt_Product as rp`).WithArgs(int64(5)).WillReturnRows(rows)
+}
+
+func expectRefundablePayments(mock sqlmock.Sqlmock, refundable map[string]types.Money) {
+	rows := sqlmock.NewRows([]string{"method", "sum"})
+	for method, amount := range refundable {
+		rows.AddRow(method, amount.String())
+	}
+	mock.ExpectQuery(`select method, sum\(amount\)`).WithArgs(int64(5)).WillReturnRows(rows)
+}
+
+func TestCreateReceiptReturn(t *testing.T) {
+	db, mock := newMockDB(t)
+	date := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	expectLockReceipt(mock, types.ReceiptStatusActive, 8)
+	expectSoldLines(mock,
+		soldLine{id: 11, productID: 1, name: "Milk", quantity: 3, price: 8990, amount: 26970, returnedQuantity: 1, returnedAmount: 8990,
+			vatRate: sql.NullFloat64{Float64: 10, Valid: true}, vatAmount: 2452, returnedVat: 817},
+		soldLine{id: 12, productID: 2, name: "Bread", quantity: 1, price: 4550, amount: 4550},
+	)
+	expectRefundablePayments(mock, map[string]types.Money{types.PaymentMethodCash: 31520})
+	mock.ExpectQuery(`insert into Receipt_Return \(`).WithArgs(int64(5), int64(3), int64(8), types.PaymentMethodCash, types.Money(17980)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date_time"}).AddRow(40, date))
+	expectReceiptCard(mock, nil, 31520)
+	mock.ExpectExec(`insert into Receipt_Return_Product`).WithArgs(int64(40), int64(11), int64(2), types.Money(17980), types.Money(1635)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectStockUpdate(mock, 1, 2, types.StockMovementReturn)
+	mock.ExpectCommit()
+
+	got, err := db.CreateReceiptReturn(5, types.ReceiptReturnRequest{
+		TellerID: 3,
+		Products: []types.ReceiptReturnProductRequest{{ReceiptProductID: 11, Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != -17980 || len(got.Products) != 1 || got.Products[0].Amount != -17980 || got.Products[0].VatAmount != -1635 {
+		t.Errorf("CreateReceiptReturn() = %+v, want total and line amount -179.8 with vat -16.35", got)
+	}
+}
+
+func TestCreateReceiptReturnLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		products []types.ReceiptReturnProductRequest
+		wantErr  error
+	}{
+		{name: "more than left", products: []types.ReceiptReturnProductRequest{{ReceiptProductID: 11, Quantity: 3}}, wantErr: &ConflictError{}},
+		{name: "split over the limit", products: []types.ReceiptReturnProductRequest{{ReceiptProductID: 11, Quantity: 1}, {ReceiptProductID: 11, Quantity: 2}}, wantErr: &ConflictError{}},
+		{name: "voided receipt", status: types.ReceiptStatusVoided, wantErr: &ConflictError{}},
+		{name: "line of another receipt", products: []types.ReceiptReturnProductRequest{{ReceiptProductID: 99, Quantity: 1}}, wantErr: &ValidationError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			expectOpenShift(mock, 3, 8)
+			if tt.status == "" {
+				expectLockReceipt(mock, types.ReceiptStatusActive, 8)
+				expectSoldLines(mock, soldLine{id: 11, productID: 1, name: "Milk", quantity: 3, price: 8990, amount: 26970, returnedQuantity: 1, returnedAmount: 8990})
+			} else {
+				expectLockReceipt(mock, tt.status, 8)
+			}
+			mock.ExpectRollback()
+
+			products := tt.products
+			if products == nil {
+				products = []types.ReceiptReturnProductRequest{{ReceiptProductID: 11, Quantity: 1}}
+			}
+			_, err := db.CreateReceiptReturn(5, types.ReceiptReturnRequest{TellerID: 3, Products: products})
+			if !hasErrorType(err, tt.wantErr) {
+				t.Errorf("CreateReceiptReturn() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetDailyReport(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`from Receipt_Return`).
+		WithArgs(time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows([]string{"receipts", "sales", "voids", "voided", "returns", "refunds"}).AddRow(4, "1000.10", 1, "50.00", 1, "200.05"))
+	mock.ExpectQuery(`select coalesce\(sum\(rp.discount_amount\), 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("35.50"))
+	mock.ExpectQuery(`join Promotion as p on p.id = rp.promotion_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "count", "sum"}).AddRow(2, "Milk -10%", 3, "26.97"))
+	mock.ExpectQuery(`group by rate`).
+		WillReturnRows(sqlmock.NewRows([]string{"rate", "sales", "sales_tax", "refunds", "refunds_tax"}).AddRow(20.0, "1000.10", "166.68", "200.05", "33.34"))
+
+	got, err := db.GetDailyReport(time.Date(2026, 3, 14, 18, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.DailyReportResponse{Date: "2026-03-14", ReceiptCount: 4, GrossSales: 100010, VoidCount: 1, VoidedTotal: 5000, ReturnCount: 1, Refunds: -20005, NetRevenue: 80005,
+		Discounts: 3550, Promotions: []types.PromotionTotalResponse{{PromotionID: 2, Name: "Milk -10%", LineCount: 3, Discount: 2697}},
+		Taxes: []types.TaxReportResponse{{Rate: 20, Sales: 100010, SalesTax: 16668, Refunds: -20005, RefundsTax: -3334, NetTax: 13334}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetDailyReport() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRefundMethod(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		total      types.Money
+		refundable map[string]types.Money
+		want       string
+		wantErr    bool
+	}{
+		{name: "single method by default", total: 5000, refundable: map[string]types.Money{types.PaymentMethodCard: 10000}, want: types.PaymentMethodCard},
+		{name: "chosen method", method: types.PaymentMethodCash, total: 5000,
+			refundable: map[string]types.Money{types.PaymentMethodCard: 10000, types.PaymentMethodCash: 5000}, want: types.PaymentMethodCash},
+		{name: "zero receipt without payments", refundable: map[string]types.Money{}, want: types.PaymentMethodCash},
+		{name: "several methods need a choice", total: 5000,
+			refundable: map[string]types.Money{types.PaymentMethodCard: 10000, types.PaymentMethodCash: 5000}, wantErr: true},
+		{name: "method not paid", method: types.PaymentMethodCash, total: 5000, refundable: map[string]types.Money{types.PaymentMethodCard: 10000}, wantErr: true},
+		{name: "more than left", method: types.PaymentMethodCash, total: 5001,
+			refundable: map[string]types.Money{types.PaymentMethodCard: 10000, types.PaymentMethodCash: 5000}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := refundMethod(tt.method, tt.total, tt.refundable)
+			if tt.wantErr {
+				if !hasErrorType(err, &ValidationError{}) {
+					t.Errorf("refundMethod() error = %v, want ValidationError", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("refundMethod() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// VoidReceipt аннулирует чек, пока не закрыта смена, в которой он пробит.
+// Требуется решение старшего сотрудника.
+// Чек не удаляется, а помечается voided, товар возвращается на склад.
+func (db *DB) VoidReceipt(receiptID int64, voidInfo types.ReceiptVoidRequest) (types.FullReceiptInfoResponse, error) {
+	if strings.TrimSpace(voidInfo.Reason) == "" {
+		return types.FullReceiptInfoResponse{}, newValidationError("reason is required")
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.checkSupervisor(tx, voidInfo.SupervisorID, "void receipts"); err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %w", err)
+	}
+
+	receipt, err := db.lockReceipt(tx, receiptID)
+	if err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %w", err)
+	}
+	if receipt.status != types.ReceiptStatusActive {
+		return types.FullReceiptInfoResponse{}, newConflictError("receipt %d is already %s", receiptID, receipt.status)
+	}
+	if err := db.checkShiftOpen(tx, receipt.shiftID); err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %w", err)
+	}
+
+	lines, err := db.getSoldLines(tx, receiptID)
+	if err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %v", err)
+	}
+	for _, line := range lines {
+		if line.returnedQuantity > 0 {
+			return types.FullReceiptInfoResponse{}, newConflictError("receipt %d has returns and cannot be voided", receiptID)
+		}
+	}
+
+	for _, line := range lines {
+		if _, err := db.updateProductStock(tx, line.productID, line.quantity, stockMovement{
+			kind: types.StockMovementVoid, documentType: types.StockDocumentReceipt, documentID: receiptID, employeeID: voidInfo.SupervisorID, comment: voidInfo.Reason,
+		}); err != nil {
+			return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %v", err)
+		}
+	}
+
+	if err := db.reverseReceiptPoints(tx, receiptID); err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %v", err)
+	}
+
+	_, err = tx.Exec("update Receipt set status = $1, void_reason = $2, voided_by = $3, voided_at = now() where id = $4",
+		types.ReceiptStatusVoided, voidInfo.Reason, voidInfo.SupervisorID, receiptID)
+	if err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %v", err)
+	}
+
+	result, err := db.getFullReceipt(receiptID)
+	if err != nil {
+		return types.FullReceiptInfoResponse{}, fmt.Errorf("VoidReceipt: %v", err)
+	}
+	return result, nil
+}
+
+// checkSupervisor проверяет, что сотрудник существует и его должность есть в SUPERVISOR_POSITIONS
+func (db *DB) checkSupervisor(tx *sql.Tx, employeeID int64, action string) error {
+	var position string
+	err := tx.QueryRow("select position from Employee where id = $1", employeeID).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return newValidationError("supervisor %d not found", employeeID)
+	}
+	if err != nil {
+		return fmt.Errorf("checkSupervisor: %v", err)
+	}
+	if !slices.Contains(db.supervisorPositions, position) {
+		return newValidationError("employee %d (%s) is not allowed to %s", employeeID, position, action)
+	}
+	return nil
+}
+
+// checkShiftOpen чек можно аннулировать только в его смене
+func (db *DB) checkShiftOpen(tx *sql.Tx, shiftID sql.NullInt64) error {
+	if !shiftID.Valid {
+		return newConflictError("receipt was created without a shift and cannot be voided")
+	}
+
+	var open bool
+	err := tx.QueryRow("select closed_at is null from Shift where id = $1 for share", shiftID.Int64).Scan(&open)
+	if err != nil {
+		return fmt.Errorf("checkShiftOpen: %v", err)
+	}
+	if !open {
+		return newConflictError("shift %d is closed, receipt can no longer be voided", shiftID.Int64)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"db5/internal/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectSupervisor(mock sqlmock.Sqlmock, position string) {
+	mock.ExpectQuery(`select position from Employee where id = \$1`).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(position))
+}
+
+func expectFullReceiptRead(mock sqlmock.Sqlmock, status string) {
+	mock.ExpectQuery(`from Receipt as r`).
+		WillReturnRows(sqlmock.NewRows([]string{"first_name", "last_name", "middle_name", "id", "status", "void_reason", "number", "printed_number", "date_time", "total_amount", "card", "shift_id", "register"}).
+			AddRow("Anna", "Ivanova", "", 5, status, "", 1, "1-20260314-0001", time.Now(), "100.00", 0, 8, "1"))
+	mock.ExpectQuery(`FROM Receipt_Product as rp`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity", "amount", "price", "returned"}))
+	mock.ExpectQuery(`from Receipt_Payment where receipt_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"method", "amount", "tendered", "change_amount", "reference"}))
+	mock.ExpectQuery(`from Receipt_Return where receipt_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "employee_id", "payment_method", "date_time", "total_amount"}))
+}
+
+func expectShiftOpen(mock sqlmock.Sqlmock, open bool) {
+	mock.ExpectQuery(`select closed_at is null from Shift where id = \$1 for share`).WithArgs(int64(8)).
+		WillReturnRows(sqlmock.NewRows([]string{"open"}).AddRow(open))
+}
+
+func TestVoidReceipt(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.supervisorPositions = []string{"Администратор"}
+
+	mock.ExpectBegin()
+	expectSupervisor(mock, "Администратор")
+	expectLockReceipt(mock, types.ReceiptStatusActive, 8)
+	expectShiftOpen(mock, true)
+	expectSoldLines(mock,
+		soldLine{id: 11, productID: 1, name: "Milk", quantity: 3, price: 8990, amount: 26970},
+	)
+	expectStockUpdate(mock, 1, 3, types.StockMovementVoid)
+	mock.ExpectExec(`insert into Loyalty_Points_Ledger \(card_id, receipt_id, kind, points\)`).
+		WithArgs(int64(5), pointsKindReversal).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`update Receipt set status = \$1, void_reason = \$2, voided_by = \$3`).
+		WithArgs(types.ReceiptStatusVoided, "wrong product", int64(2), int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectFullReceiptRead(mock, types.ReceiptStatusVoided)
+
+	got, err := db.VoidReceipt(5, types.ReceiptVoidRequest{SupervisorID: 2, Reason: "wrong product"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != types.ReceiptStatusVoided {
+		t.Errorf("status = %q, want %q", got.Status, types.ReceiptStatusVoided)
+	}
+}
+
+func TestVoidReceiptRejected(t *testing.T) {
+	lockActive := func(mock sqlmock.Sqlmock) {
+		expectSupervisor(mock, "Администратор")
+		expectLockReceipt(mock, types.ReceiptStatusActive, 8)
+	}
+	tests := []struct {
+		name    string
+		reason  string
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{name: "no reason", reason: " ", wantErr: &ValidationError{}},
+		{
+			name:    "not a supervisor",
+			expect:  func(mock sqlmock.Sqlmock) { expectSupervisor(mock, "Кассир") },
+			wantErr: &ValidationError{},
+		},
+		{
+			name: "already voided",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectSupervisor(mock, "Администратор")
+				expectLockReceipt(mock, types.ReceiptStatusVoided, 8)
+			},
+			wantErr: &ConflictError{},
+		},
+		{
+			name: "closed shift",
+			expect: func(mock sqlmock.Sqlmock) {
+				lockActive(mock)
+				expectShiftOpen(mock, false)
+			},
+			wantErr: &ConflictError{},
+		},
+		{
+			name: "receipt without a shift",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectSupervisor(mock, "Администратор")
+				expectLockReceipt(mock, types.ReceiptStatusActive, nil)
+			},
+			wantErr: &ConflictError{},
+		},
+		{
+			name: "has returns",
+			expect: func(mock sqlmock.Sqlmock) {
+				lockActive(mock)
+				expectShiftOpen(mock, true)
+				expectSoldLines(mock, soldLine{id: 11, productID: 1, quantity: 3, returnedQuantity: 1})
+			},
+			wantErr: &ConflictError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			db.supervisorPositions = []string{"Администратор"}
+			reason := tt.reason
+			if tt.expect != nil {
+				reason = "mistake"
+				mock.ExpectBegin()
+				tt.expect(mock)
+				mock.ExpectRollback()
+			}
+
+			_, err := db.VoidReceipt(5, types.ReceiptVoidRequest{SupervisorID: 2, Reason: reason})
+			if !hasErrorType(err, tt.wantErr) {
+				t.Errorf("VoidReceipt() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
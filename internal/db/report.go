@@ -0,0 +1,161 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"fmt"
+	"time"
+)
+
+// GetDailyReport выручка за день: продажи минус возвраты, оформленные в этот день.
+// Аннулированные чеки в выручку не входят и показываются отдельно.
+func (db *DB) GetDailyReport(date time.Time) (types.DailyReportResponse, error) {
+	query := `
+	select
+	(select count(*) from Receipt where status = 'active' and date_time >= $1 and date_time < $2),
+	(select coalesce(sum(total_amount), 0) from Receipt where status = 'active' and date_time >= $1 and date_time < $2),
+	(select count(*) from Receipt where status = 'voided' and date_time >= $1 and date_time < $2),
+	(select coalesce(sum(total_amount), 0) from Receipt where status = 'voided' and date_time >= $1 and date_time < $2),
+	(select count(*) from Receipt_Return where date_time >= $1 and date_time < $2),
+	(select coalesce(sum(total_amount), 0) from Receipt_Return where date_time >= $1 and date_time < $2)`
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	report := types.DailyReportResponse{Date: day.Format(time.DateOnly)}
+
+	err := db.db.QueryRow(query, day, day.AddDate(0, 0, 1)).Scan(&report.ReceiptCount, &report.GrossSales, &report.VoidCount, &report.VoidedTotal, &report.ReturnCount, &report.Refunds)
+	if err != nil {
+		return types.DailyReportResponse{}, fmt.Errorf("GetDailyReport: %v", err)
+	}
+
+	report.Refunds = -report.Refunds
+	report.NetRevenue = report.GrossSales + report.Refunds
+
+	report.Discounts, report.Promotions, err = db.getPromotionTotals(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return types.DailyReportResponse{}, fmt.Errorf("GetDailyReport: %v", err)
+	}
+
+	report.Taxes, err = db.getTaxReport(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return types.DailyReportResponse{}, fmt.Errorf("GetDailyReport: %v", err)
+	}
+	return report, nil
+}
+
+// getPromotionTotals все скидки в действующих чеках за период и их разбивка по акциям
+func (db *DB) getPromotionTotals(from, to time.Time) (types.Money, []types.PromotionTotalResponse, error) {
+	var discounts types.Money
+	err := db.db.QueryRow(`
+	select coalesce(sum(rp.discount_amount), 0)
+	from Receipt_Product as rp
+	join Receipt as r on r.id = rp.receipt_id
+	where r.status = 'active' and r.date_time >= $1 and r.date_time < $2`, from, to).Scan(&discounts)
+	if err != nil {
+		return 0, nil, fmt.Errorf("getPromotionTotals: %v", err)
+	}
+
+	query := `
+	select p.id, p.name, count(*), sum(rp.promotion_discount)
+	from Receipt_Product as rp
+	join Receipt as r on r.id = rp.receipt_id
+	join Promotion as p on p.id = rp.promotion_id
+	where r.status = 'active' and r.date_time >= $1 and r.date_time < $2
+	group by p.id, p.name
+	order by p.id`
+
+	rows, err := db.db.Query(query, from, to)
+	if err != nil {
+		return 0, nil, fmt.Errorf("getPromotionTotals: %v", err)
+	}
+	defer rows.Close()
+
+	promotions := []types.PromotionTotalResponse{}
+	for rows.Next() {
+		var total types.PromotionTotalResponse
+		if err := rows.Scan(&total.PromotionID, &total.Name, &total.LineCount, &total.Discount); err != nil {
+			return 0, nil, fmt.Errorf("getPromotionTotals: %v", err)
+		}
+		promotions = append(promotions, total)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("getPromotionTotals: %v", err)
+	}
+	return discounts, promotions, nil
+}
+
+// productUnitCostsQuery себестоимость единицы товара (product_id, unit_cost) — средняя закупочная цена
+// в базовой валюте по принятому товару, для еще не принятых заказов — по заказанному.
+// Отмененные заказы учитываются только по уже принятому товару.
+const productUnitCostsQuery = `
+	select soi.product_id,
+	coalesce(
+		sum(soi.base_purchase_price * soi.received_quantity) / nullif(sum(soi.received_quantity), 0),
+		sum(soi.base_purchase_price * soi.quantity) / nullif(sum(soi.quantity), 0)
+	) as unit_cost
+	from Supplier_Order_Items as soi
+	join Supplier_Order as so on so.id = soi.order_id
+	where so.status <> 'cancelled' or soi.received_quantity > 0
+	group by soi.product_id`
+
+// GetMarginReport маржа по товарам за дни с from по to включительно, себестоимость по productUnitCostsQuery
+func (db *DB) GetMarginReport(from, to time.Time) (types.MarginReportResponse, error) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location())
+	if to.Before(from) {
+		return types.MarginReportResponse{}, newValidationError("from must not be after to")
+	}
+
+	query := `
+	with sales as (
+		select rp.product_id, rp.quantity, rp.amount
+		from Receipt_Product as rp
+		join Receipt as r on r.id = rp.receipt_id
+		where r.status = 'active' and r.date_time >= $1 and r.date_time < $2
+		union all
+		select rp.product_id, -rrp.quantity, -rrp.amount
+		from Receipt_Return_Product as rrp
+		join Receipt_Return as rr on rr.id = rrp.return_id
+		join Receipt_Product as rp on rp.id = rrp.receipt_product_id
+		where rr.date_time >= $1 and rr.date_time < $2
+	),
+	costs as (` + productUnitCostsQuery + `)
+	select p.id, p.name, sum(s.quantity), sum(s.amount), round(c.unit_cost, 2)
+	from sales as s
+	join Product as p on p.id = s.product_id
+	left join costs as c on c.product_id = s.product_id
+	group by p.id, p.name, c.unit_cost
+	order by p.id`
+
+	rows, err := db.db.Query(query, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return types.MarginReportResponse{}, fmt.Errorf("GetMarginReport: %v", err)
+	}
+	defer rows.Close()
+
+	report := types.MarginReportResponse{
+		From:     from.Format(time.DateOnly),
+		To:       to.Format(time.DateOnly),
+		Currency: db.baseCurrency,
+		Products: []types.ProductMarginResponse{},
+	}
+	for rows.Next() {
+		var product types.ProductMarginResponse
+		var unitCost sql.Null[types.Money]
+		if err := rows.Scan(&product.ProductID, &product.Name, &product.Quantity, &product.Revenue, &unitCost); err != nil {
+			return types.MarginReportResponse{}, fmt.Errorf("GetMarginReport: %v", err)
+		}
+		report.Revenue += product.Revenue
+		if unitCost.Valid {
+			product.UnitCost = &unitCost.V
+			product.Cost = unitCost.V.Mul(product.Quantity)
+			product.Margin = product.Revenue - product.Cost
+			report.Cost += product.Cost
+			report.Margin += product.Margin
+		}
+		report.Products = append(report.Products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return types.MarginReportResponse{}, fmt.Errorf("GetMarginReport: %v", err)
+	}
+	return report, nil
+}
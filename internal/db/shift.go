@@ -0,0 +1,233 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	shiftReportX = "X"
+	shiftReportZ = "Z"
+)
+
+// OpenShift открывает смену кассира с начальным остатком наличных в кассе
+func (db *DB) OpenShift(shiftInfo types.ShiftOpenRequest) (types.ShiftResponse, error) {
+	if shiftInfo.TellerID == 0 {
+		return types.ShiftResponse{}, newValidationError("teller_id is required")
+	}
+	if shiftInfo.OpeningCash < 0 {
+		return types.ShiftResponse{}, newValidationError("opening_cash must not be negative")
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.ShiftResponse{}, fmt.Errorf("OpenShift: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := db.getOpenShiftID(tx, shiftInfo.TellerID); err == nil {
+		return types.ShiftResponse{}, newConflictError("teller %d already has an open shift", shiftInfo.TellerID)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return types.ShiftResponse{}, fmt.Errorf("OpenShift: %v", err)
+	}
+
+	register := strings.TrimSpace(shiftInfo.Register)
+	if register == "" {
+		register = db.receiptNumbering.DefaultRegister
+	}
+	if len(register) > 32 {
+		return types.ShiftResponse{}, newValidationError("register must be at most 32 characters")
+	}
+
+	var shiftID int64
+	err = tx.QueryRow("insert into Shift (employee_id, register, opening_cash) values ($1, $2, $3) returning id",
+		shiftInfo.TellerID, register, shiftInfo.OpeningCash).Scan(&shiftID)
+	if isUniqueViolation(err) {
+		return types.ShiftResponse{}, newConflictError("teller %d already has an open shift", shiftInfo.TellerID)
+	}
+	if err != nil {
+		return types.ShiftResponse{}, fmt.Errorf("OpenShift: %v", err)
+	}
+
+	shift, err := db.getShift(tx, shiftID)
+	if err != nil {
+		return types.ShiftResponse{}, fmt.Errorf("OpenShift: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.ShiftResponse{}, fmt.Errorf("OpenShift: %v", err)
+	}
+	return shift, nil
+}
+
+// CloseShift закрывает смену с пересчитанными наличными и возвращает Z-отчет
+func (db *DB) CloseShift(shiftID int64, closeInfo types.ShiftCloseRequest) (types.ShiftReportResponse, error) {
+	if closeInfo.CountedCash < 0 {
+		return types.ShiftReportResponse{}, newValidationError("counted_cash must not be negative")
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("CloseShift: %v", err)
+	}
+	defer tx.Rollback()
+
+	var closed bool
+	err = tx.QueryRow("select closed_at is not null from Shift where id = $1 for update", shiftID).Scan(&closed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.ShiftReportResponse{}, newNotFoundError("shift %d not found", shiftID)
+	}
+	if err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("CloseShift: %v", err)
+	}
+	if closed {
+		return types.ShiftReportResponse{}, newConflictError("shift %d is already closed", shiftID)
+	}
+
+	_, err = tx.Exec("update Shift set closed_at = now(), closing_cash = $1 where id = $2", closeInfo.CountedCash, shiftID)
+	if err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("CloseShift: %v", err)
+	}
+
+	report, err := db.buildShiftReport(tx, shiftID)
+	if err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("CloseShift: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("CloseShift: %v", err)
+	}
+	return report, nil
+}
+
+// GetShiftReport X-отчет по открытой смене или Z-отчет по закрытой
+func (db *DB) GetShiftReport(shiftID int64) (types.ShiftReportResponse, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("GetShiftReport: %v", err)
+	}
+	defer tx.Rollback()
+
+	report, err := db.buildShiftReport(tx, shiftID)
+	if err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("GetShiftReport: %w", err)
+	}
+	return report, nil
+}
+
+func (db *DB) buildShiftReport(tx *sql.Tx, shiftID int64) (types.ShiftReportResponse, error) {
+	shift, err := db.getShift(tx, shiftID)
+	if err != nil {
+		return types.ShiftReportResponse{}, err
+	}
+
+	// Чеки, выгруженные после закрытия смены, в итоги не входят, чтобы Z-отчет не менялся
+	query := `
+	select
+	(select count(*) from Receipt where shift_id = $1 and status = 'active' and not after_close),
+	(select coalesce(sum(total_amount), 0) from Receipt where shift_id = $1 and status = 'active' and not after_close),
+	(select count(*) from Receipt where shift_id = $1 and status = 'voided'),
+	(select coalesce(sum(total_amount), 0) from Receipt where shift_id = $1 and status = 'voided'),
+	(select count(*) from Receipt_Return where shift_id = $1),
+	(select coalesce(sum(total_amount), 0) from Receipt_Return where shift_id = $1),
+	(select count(*) from Receipt where shift_id = $1 and after_close),
+	(select coalesce(sum(total_amount), 0) from Receipt where shift_id = $1 and after_close)`
+
+	report := types.ShiftReportResponse{
+		Type:        shiftReportX,
+		Shift:       shift,
+		GeneratedAt: time.Now(),
+	}
+	err = tx.QueryRow(query, shiftID).Scan(&report.ReceiptCount, &report.GrossSales, &report.VoidCount, &report.VoidedTotal, &report.ReturnCount, &report.Refunds,
+		&report.AfterCloseCount, &report.AfterCloseTotal)
+	if err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("buildShiftReport: %v", err)
+	}
+
+	report.Refunds = -report.Refunds
+	report.NetRevenue = report.GrossSales + report.Refunds
+
+	report.Payments, err = db.getShiftPaymentTotals(tx, shiftID)
+	if err != nil {
+		return types.ShiftReportResponse{}, fmt.Errorf("buildShiftReport: %v", err)
+	}
+
+	report.ExpectedCash = shift.OpeningCash
+	for _, payment := range report.Payments {
+		if payment.Method == types.PaymentMethodCash {
+			report.ExpectedCash += payment.Sales + payment.Refunds
+		}
+	}
+
+	if shift.ClosedAt != nil {
+		report.Type = shiftReportZ
+		report.CountedCash = shift.ClosingCash
+		discrepancy := *shift.ClosingCash - report.ExpectedCash
+		report.CashDiscrepancy = &discrepancy
+	}
+	return report, nil
+}
+
+func (db *DB) getShift(tx *sql.Tx, shiftID int64) (types.ShiftResponse, error) {
+	var shift types.ShiftResponse
+	var closedAt sql.NullTime
+	var closingCash sql.Null[types.Money]
+
+	err := tx.QueryRow("select id, employee_id, register, opened_at, closed_at, opening_cash, closing_cash from Shift where id = $1", shiftID).
+		Scan(&shift.ID, &shift.TellerID, &shift.Register, &shift.OpenedAt, &closedAt, &shift.OpeningCash, &closingCash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.ShiftResponse{}, newNotFoundError("shift %d not found", shiftID)
+	}
+	if err != nil {
+		return types.ShiftResponse{}, fmt.Errorf("getShift: %v", err)
+	}
+	if closedAt.Valid {
+		shift.ClosedAt = &closedAt.Time
+	}
+	if closingCash.Valid {
+		shift.ClosingCash = &closingCash.V
+	}
+	return shift, nil
+}
+
+// getOpenShiftID открытая смена кассира. Строка смены блокируется на чтение,
+// чтобы смену нельзя было закрыть, пока по ней проводится документ.
+func (db *DB) getOpenShiftID(tx *sql.Tx, tellerID int64) (int64, error) {
+	var shiftID int64
+	err := tx.QueryRow("select id from Shift where employee_id = $1 and closed_at is null for share", tellerID).Scan(&shiftID)
+	return shiftID, err
+}
+
+// shiftAt смена кассира, открытая в момент at, для чеков, пробитых без связи. Строка блокируется
+// на чтение, как в getOpenShiftID. closed — смена уже закрыта, чек в нее попадает как корректировка после закрытия.
+func (db *DB) shiftAt(tx *sql.Tx, tellerID int64, at time.Time) (shiftID int64, closed bool, err error) {
+	err = tx.QueryRow(`
+	select id, closed_at is not null from Shift
+	where employee_id = $1 and opened_at <= $2::timestamp and (closed_at is null or closed_at > $2::timestamp)
+	order by opened_at desc
+	limit 1
+	for share`, tellerID, at).Scan(&shiftID, &closed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, newConflictError("teller %d had no open shift at %s", tellerID, at.Format("2006-01-02 15:04:05"))
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("shiftAt: %v", err)
+	}
+	return shiftID, closed, nil
+}
+
+// requireOpenShift то же, что getOpenShiftID, но отсутствие смены считается ошибкой клиента
+func (db *DB) requireOpenShift(tx *sql.Tx, tellerID int64) (int64, error) {
+	shiftID, err := db.getOpenShiftID(tx, tellerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, newConflictError("teller %d has no open shift", tellerID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("requireOpenShift: %v", err)
+	}
+	return shiftID, nil
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql/driver"
+	"db5/internal/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func expectOpenShift(mock sqlmock.Sqlmock, tellerID, shiftID int64) {
+	rows := sqlmock.NewRows([]string{"id"})
+	if shiftID != 0 {
+		rows.AddRow(shiftID)
+	}
+	mock.ExpectQuery(`select id from Shift where employee_id = \$1 and closed_at is null for share`).
+		WithArgs(tellerID).WillReturnRows(rows)
+}
+
+func expectGetShift(mock sqlmock.Sqlmock, closedAt, closingCash driver.Value) {
+	mock.ExpectQuery(`from Shift where id = \$1`).WithArgs(int64(8)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "employee_id", "register", "opened_at", "closed_at", "opening_cash", "closing_cash"}).
+			AddRow(8, 3, "1", time.Now(), closedAt, "500.00", closingCash))
+}
+
+func expectShiftTotals(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`from Receipt_Return where shift_id = \$1`).WithArgs(int64(8)).
+		WillReturnRows(sqlmock.NewRows([]string{"receipts", "sales", "voids", "voided", "returns", "refunds", "after_close", "after_close_total"}).
+			AddRow(3, "1500.50", 1, "99.90", 1, "200.25", 1, "45.00"))
+	mock.ExpectQuery(`from Receipt_Payment as p`).WithArgs(int64(8)).
+		WillReturnRows(sqlmock.NewRows([]string{"method", "sales", "refunds"}).
+			AddRow(types.PaymentMethodCard, "500.00", "0.00").
+			AddRow(types.PaymentMethodCash, "1000.50", "200.25"))
+}
+
+func TestCreateNewReceiptRequiresOpenShift(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 0)
+	mock.ExpectRollback()
+
+	_, err := db.CreateNewReceipt(types.ReceiptInfoRequest{
+		TellerID: 3,
+		Products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 1}},
+	})
+	if !hasErrorType(err, &ConflictError{}) {
+		t.Errorf("CreateNewReceipt() error = %v, want ConflictError", err)
+	}
+}
+
+func TestOpenShiftTwice(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	mock.ExpectRollback()
+
+	_, err := db.OpenShift(types.ShiftOpenRequest{TellerID: 3, OpeningCash: 50000})
+	if !hasErrorType(err, &ConflictError{}) {
+		t.Errorf("OpenShift() error = %v, want ConflictError", err)
+	}
+}
+
+func TestOpenShiftDefaultRegister(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 0)
+	mock.ExpectQuery(`insert into Shift \(employee_id, register, opening_cash\)`).WithArgs(int64(3), "1", types.Money(50000)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	expectGetShift(mock, nil, nil)
+	mock.ExpectCommit()
+
+	got, err := db.OpenShift(types.ShiftOpenRequest{TellerID: 3, Register: " ", OpeningCash: 50000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 8 || got.Register != "1" {
+		t.Errorf("OpenShift() = %+v, want shift 8 on register 1", got)
+	}
+}
+
+func TestOpenShiftConcurrent(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 0)
+	mock.ExpectQuery(`insert into Shift \(employee_id, register, opening_cash\)`).WithArgs(int64(3), "1", types.Money(0)).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	_, err := db.OpenShift(types.ShiftOpenRequest{TellerID: 3})
+	if !hasErrorType(err, &ConflictError{}) {
+		t.Errorf("OpenShift() error = %v, want ConflictError", err)
+	}
+}
+
+func TestGetShiftReportX(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectGetShift(mock, nil, nil)
+	expectShiftTotals(mock)
+	mock.ExpectRollback()
+
+	got, err := db.GetShiftReport(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != shiftReportX || got.NetRevenue != 130025 || got.ExpectedCash != 130025 || got.Refunds != -20025 {
+		t.Errorf("GetShiftReport() = %+v", got)
+	}
+	if got.AfterCloseCount != 1 || got.AfterCloseTotal != 4500 {
+		t.Errorf("after close = %d receipts for %v, want 1 for 45.00 outside the totals", got.AfterCloseCount, got.AfterCloseTotal)
+	}
+	if got.CountedCash != nil || got.CashDiscrepancy != nil {
+		t.Errorf("X report has counted cash %v and discrepancy %v, want none", got.CountedCash, got.CashDiscrepancy)
+	}
+}
+
+func TestCloseShift(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`select closed_at is not null from Shift where id = \$1 for update`).WithArgs(int64(8)).
+		WillReturnRows(sqlmock.NewRows([]string{"closed"}).AddRow(false))
+	mock.ExpectExec(`update Shift set closed_at = now\(\), closing_cash = \$1`).WithArgs(types.Money(129000), int64(8)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectGetShift(mock, time.Now(), "1290.00")
+	expectShiftTotals(mock)
+	mock.ExpectCommit()
+
+	got, err := db.CloseShift(8, types.ShiftCloseRequest{CountedCash: 129000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != shiftReportZ {
+		t.Errorf("type = %s, want %s", got.Type, shiftReportZ)
+	}
+	if got.CashDiscrepancy == nil || *got.CashDiscrepancy != -1025 {
+		t.Errorf("discrepancy = %v, want -10.25", got.CashDiscrepancy)
+	}
+}
+
+func TestCloseShiftClosed(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`select closed_at is not null from Shift where id = \$1 for update`).
+		WillReturnRows(sqlmock.NewRows([]string{"closed"}).AddRow(true))
+	mock.ExpectRollback()
+
+	_, err := db.CloseShift(8, types.ShiftCloseRequest{CountedCash: 179000})
+	if !hasErrorType(err, &ConflictError{}) {
+		t.Errorf("CloseShift() error = %v, want ConflictError", err)
+	}
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"fmt"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+type stockProduct struct {
+	name     string
+	price    types.Money
+	category string
+	quantity int64
+	vatRate  float64
+}
+
+// lockProducts читает товары с блокировкой строк. Порядок по id нужен,
+// чтобы параллельные транзакции не ловили взаимную блокировку.
+// Ставка НДС берется у товара, затем у категории, затем VAT_DEFAULT_RATE.
+func (db *DB) lockProducts(tx *sql.Tx, productIDs []int64) (map[int64]stockProduct, error) {
+	rows, err := tx.Query(
+		`select p.id, p.name, p.price, p.category, p.quantity_in_stock, coalesce(p.vat_rate, ctr.rate)
+		from Product as p
+		left join Category_Tax_Rate as ctr on ctr.category = p.category
+		where p.id = any($1)
+		order by p.id
+		for update of p`,
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("lockProducts: %v", err)
+	}
+	defer rows.Close()
+
+	products := make(map[int64]stockProduct, len(productIDs))
+	for rows.Next() {
+		var id int64
+		var product stockProduct
+		var vatRate sql.NullFloat64
+		if err := rows.Scan(&id, &product.name, &product.price, &product.category, &product.quantity, &vatRate); err != nil {
+			return nil, fmt.Errorf("lockProducts: %v", err)
+		}
+		product.vatRate = db.vatDefaultRate
+		if vatRate.Valid {
+			product.vatRate = vatRate.Float64
+		}
+		products[id] = product
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("lockProducts: %v", err)
+	}
+	return products, nil
+}
+
+// checkStock проверяет, что продажа строк не уведет остаток в минус.
+// Категории из настройки NEGATIVE_STOCK_CATEGORIES не проверяются.
+func (db *DB) checkStock(lines []receiptLine, products map[int64]stockProduct) error {
+	if shortages := db.stockShortages(lines, products); len(shortages) > 0 {
+		return &InsufficientStockError{Items: shortages}
+	}
+	return nil
+}
+
+// stockShortages товары, которых не хватает для продажи строк, в порядке первого появления в чеке
+func (db *DB) stockShortages(lines []receiptLine, products map[int64]stockProduct) []types.InsufficientStockResponse {
+	requested := make(map[int64]int64, len(lines))
+	var order []int64
+	for _, line := range lines {
+		if _, ok := requested[line.productID]; !ok {
+			order = append(order, line.productID)
+		}
+		requested[line.productID] += line.quantity
+	}
+
+	var shortages []types.InsufficientStockResponse
+	for _, productID := range order {
+		product := products[productID]
+		if db.allowsNegativeStock(product.category) {
+			continue
+		}
+		if product.quantity < requested[productID] {
+			shortages = append(shortages, types.InsufficientStockResponse{
+				ProductID: productID,
+				Requested: requested[productID],
+				Available: product.quantity,
+			})
+		}
+	}
+	return shortages
+}
+
+func (db *DB) allowsNegativeStock(category string) bool {
+	return slices.Contains(db.negativeStockCategories, category)
+}
+
+type stockMovement struct {
+	kind         string
+	documentType string
+	documentID   int64
+	employeeID   int64
+	comment      string
+}
+
+// updateProductStock остаток меняется только здесь, поэтому сумма журнала совпадает с quantity_in_stock
+func (db *DB) updateProductStock(tx *sql.Tx, productID int64, delta int64, movement stockMovement) (types.StockMovementResponse, error) {
+	response := types.StockMovementResponse{
+		Kind:         movement.kind,
+		Quantity:     delta,
+		DocumentType: movement.documentType,
+		DocumentID:   movement.documentID,
+		EmployeeID:   movement.employeeID,
+		Comment:      movement.comment,
+	}
+	err := tx.QueryRow("update Product set quantity_in_stock = quantity_in_stock + $1 where id = $2 returning quantity_in_stock", delta, productID).
+		Scan(&response.Balance)
+	if err != nil {
+		return types.StockMovementResponse{}, fmt.Errorf("updateProductStock: %v", err)
+	}
+
+	var documentType sql.NullString
+	if movement.documentType != "" {
+		documentType = sql.NullString{String: movement.documentType, Valid: true}
+	}
+	err = tx.QueryRow(`insert into Stock_Movement (product_id, kind, quantity, document_type, document_id, employee_id, comment)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	returning id, created_at`,
+		productID, movement.kind, delta, documentType, nullID(movement.documentID), nullID(movement.employeeID), movement.comment).
+		Scan(&response.ID, &response.CreatedAt)
+	if err != nil {
+		return types.StockMovementResponse{}, fmt.Errorf("updateProductStock: %v", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func checkEmployee(q queryer, employeeID int64) error {
+	var exists bool
+	if err := q.QueryRow("select exists (select 1 from Employee where id = $1)", employeeID).Scan(&exists); err != nil {
+		return fmt.Errorf("checkEmployee: %v", err)
+	}
+	if !exists {
+		return newValidationError("employee %d not found", employeeID)
+	}
+	return nil
+}
+
+// CreateStockMovement перемещение пишет расход и приход в одной транзакции под общим документом Stock_Transfer.
+// Списание и перемещение не уводят остаток в минус, кроме категорий из NEGATIVE_STOCK_CATEGORIES.
+func (db *DB) CreateStockMovement(productID int64, movementInfo types.StockMovementRequest) (types.StockMovementResponse, error) {
+	switch movementInfo.Kind {
+	case types.StockMovementWriteOff:
+		if movementInfo.Quantity >= 0 {
+			return types.StockMovementResponse{}, newValidationError("write_off quantity must be negative")
+		}
+	case types.StockMovementAdjustment:
+		if movementInfo.Quantity == 0 {
+			return types.StockMovementResponse{}, newValidationError("quantity must not be zero")
+		}
+	case types.StockMovementTransfer:
+		if movementInfo.Quantity >= 0 {
+			return types.StockMovementResponse{}, newValidationError("transfer quantity must be negative")
+		}
+		if movementInfo.TargetProductID == 0 || movementInfo.TargetProductID == productID {
+			return types.StockMovementResponse{}, newValidationError("target_product_id must be another product")
+		}
+	default:
+		return types.StockMovementResponse{}, newValidationError("kind must be write_off, adjustment or transfer")
+	}
+	if movementInfo.Kind != types.StockMovementTransfer && movementInfo.TargetProductID != 0 {
+		return types.StockMovementResponse{}, newValidationError("target_product_id is only allowed for transfer")
+	}
+	if movementInfo.EmployeeID == 0 {
+		return types.StockMovementResponse{}, newValidationError("employee_id is required")
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.StockMovementResponse{}, fmt.Errorf("CreateStockMovement: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkEmployee(tx, movementInfo.EmployeeID); err != nil {
+		return types.StockMovementResponse{}, fmt.Errorf("CreateStockMovement: %w", err)
+	}
+
+	productIDs := []int64{productID}
+	if movementInfo.Kind == types.StockMovementTransfer {
+		productIDs = append(productIDs, movementInfo.TargetProductID)
+	}
+	products, err := db.lockProducts(tx, productIDs)
+	if err != nil {
+		return types.StockMovementResponse{}, fmt.Errorf("CreateStockMovement: %v", err)
+	}
+	product, ok := products[productID]
+	if !ok {
+		return types.StockMovementResponse{}, newNotFoundError("product %d not found", productID)
+	}
+	if movementInfo.Kind == types.StockMovementTransfer {
+		if _, ok := products[movementInfo.TargetProductID]; !ok {
+			return types.StockMovementResponse{}, newValidationError("target product %d not found", movementInfo.TargetProductID)
+		}
+	}
+	if movementInfo.Kind != types.StockMovementAdjustment && product.quantity+movementInfo.Quantity < 0 && !db.allowsNegativeStock(product.category) {
+		return types.StockMovementResponse{}, &InsufficientStockError{Items: []types.InsufficientStockResponse{{
+			ProductID: productID,
+			Requested: -movementInfo.Quantity,
+			Available: product.quantity,
+		}}}
+	}
+
+	movement := stockMovement{kind: movementInfo.Kind, employeeID: movementInfo.EmployeeID, comment: strings.TrimSpace(movementInfo.Comment)}
+	if movementInfo.Kind == types.StockMovementTransfer {
+		err = tx.QueryRow(`
+		insert into Stock_Transfer (source_product_id, target_product_id, quantity, employee_id, comment)
+		values ($1, $2, $3, $4, $5)
+		returning id`,
+			productID, movementInfo.TargetProductID, -movementInfo.Quantity, movement.employeeID, movement.comment).Scan(&movement.documentID)
+		if err != nil {
+			return types.StockMovementResponse{}, fmt.Errorf("CreateStockMovement: %v", err)
+		}
+		movement.documentType = types.StockDocumentTransfer
+	}
+
+	response, err := db.updateProductStock(tx, productID, movementInfo.Quantity, movement)
+	if err != nil {
+		return types.StockMovementResponse{}, fmt.Errorf("CreateStockMovement: %v", err)
+	}
+	if movementInfo.Kind == types.StockMovementTransfer {
+		incoming, err := db.updateProductStock(tx, movementInfo.TargetProductID, -movementInfo.Quantity, movement)
+		if err != nil {
+			return types.StockMovementResponse{}, fmt.Errorf("CreateStockMovement: %v", err)
+		}
+		response.Incoming = &incoming
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.StockMovementResponse{}, fmt.Errorf("CreateStockMovement: %v", err)
+	}
+	return response, nil
+}
+
+func (db *DB) GetProductMovements(productID int64) (types.ProductMovementsResponse, error) {
+	response := types.ProductMovementsResponse{ProductID: productID, Movements: []types.StockMovementResponse{}}
+	err := db.db.QueryRow("select name, quantity_in_stock from Product where id = $1", productID).Scan(&response.Name, &response.Stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.ProductMovementsResponse{}, newNotFoundError("product %d not found", productID)
+	}
+	if err != nil {
+		return types.ProductMovementsResponse{}, fmt.Errorf("GetProductMovements: %v", err)
+	}
+
+	rows, err := db.db.Query(`
+	select id, kind, quantity, sum(quantity) over (order by id),
+	coalesce(document_type, ''), coalesce(document_id, 0), coalesce(employee_id, 0), comment, created_at
+	from Stock_Movement
+	where product_id = $1
+	order by id`, productID)
+	if err != nil {
+		return types.ProductMovementsResponse{}, fmt.Errorf("GetProductMovements: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movement types.StockMovementResponse
+		if err := rows.Scan(&movement.ID, &movement.Kind, &movement.Quantity, &movement.Balance,
+			&movement.DocumentType, &movement.DocumentID, &movement.EmployeeID, &movement.Comment, &movement.CreatedAt); err != nil {
+			return types.ProductMovementsResponse{}, fmt.Errorf("GetProductMovements: %v", err)
+		}
+		response.Movements = append(response.Movements, movement)
+	}
+	if err := rows.Err(); err != nil {
+		return types.ProductMovementsResponse{}, fmt.Errorf("GetProductMovements: %v", err)
+	}
+	return response, nil
+}
+
+func (db *DB) CheckStockLedger() (types.StockCheckResponse, error) {
+	rows, err := db.db.Query(`
+	select p.id, p.name, p.quantity_in_stock, coalesce(sum(sm.quantity), 0) as ledger
+	from Product as p
+	left join Stock_Movement as sm on sm.product_id = p.id
+	group by p.id
+	order by p.id`)
+	if err != nil {
+		return types.StockCheckResponse{}, fmt.Errorf("CheckStockLedger: %v", err)
+	}
+	defer rows.Close()
+
+	response := types.StockCheckResponse{Mismatches: []types.StockMismatchResponse{}}
+	for rows.Next() {
+		var product types.StockMismatchResponse
+		if err := rows.Scan(&product.ProductID, &product.Name, &product.Stock, &product.Ledger); err != nil {
+			return types.StockCheckResponse{}, fmt.Errorf("CheckStockLedger: %v", err)
+		}
+		response.Products++
+		if product.Stock != product.Ledger {
+			product.Difference = product.Stock - product.Ledger
+			response.Mismatches = append(response.Mismatches, product)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return types.StockCheckResponse{}, fmt.Errorf("CheckStockLedger: %v", err)
+	}
+	response.Consistent = len(response.Mismatches) == 0
+	return response, nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectCheckEmployee(mock sqlmock.Sqlmock, employeeID int64, exists bool) {
+	mock.ExpectQuery(`select exists \(select 1 from Employee where id = \$1\)`).WithArgs(employeeID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+}
+
+func TestCreateStockMovementValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		request types.StockMovementRequest
+	}{
+		{name: "positive write_off", request: types.StockMovementRequest{Kind: types.StockMovementWriteOff, Quantity: 2, EmployeeID: 3}},
+		{name: "zero adjustment", request: types.StockMovementRequest{Kind: types.StockMovementAdjustment, EmployeeID: 3}},
+		{name: "document kind", request: types.StockMovementRequest{Kind: types.StockMovementSale, Quantity: -1, EmployeeID: 3}},
+		{name: "no employee", request: types.StockMovementRequest{Kind: types.StockMovementWriteOff, Quantity: -1}},
+		{name: "positive transfer", request: types.StockMovementRequest{Kind: types.StockMovementTransfer, Quantity: 2, TargetProductID: 2, EmployeeID: 3}},
+		{name: "transfer without target", request: types.StockMovementRequest{Kind: types.StockMovementTransfer, Quantity: -2, EmployeeID: 3}},
+		{name: "transfer to itself", request: types.StockMovementRequest{Kind: types.StockMovementTransfer, Quantity: -2, TargetProductID: 1, EmployeeID: 3}},
+		{name: "target on write_off", request: types.StockMovementRequest{Kind: types.StockMovementWriteOff, Quantity: -2, TargetProductID: 2, EmployeeID: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newMockDB(t)
+			_, err := db.CreateStockMovement(1, tt.request)
+			if !hasErrorType(err, &ValidationError{}) {
+				t.Errorf("CreateStockMovement() error = %v, want ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestCreateStockMovementWriteOff(t *testing.T) {
+	db, mock := newMockDB(t)
+	createdAt := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	expectCheckEmployee(mock, 3, true)
+	expectLockProducts(mock, testMilk)
+	mock.ExpectQuery(`update Product set quantity_in_stock = quantity_in_stock \+ \$1 where id = \$2 returning quantity_in_stock`).WithArgs(int64(-4), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity_in_stock"}).AddRow(6))
+	mock.ExpectQuery(`insert into Stock_Movement`).
+		WithArgs(int64(1), types.StockMovementWriteOff, int64(-4), sql.NullString{}, nil, int64(3), "истек срок").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(55, createdAt))
+	mock.ExpectCommit()
+
+	got, err := db.CreateStockMovement(1, types.StockMovementRequest{
+		Kind: types.StockMovementWriteOff, Quantity: -4, EmployeeID: 3, Comment: " истек срок ",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.StockMovementResponse{
+		ID: 55, Kind: types.StockMovementWriteOff, Quantity: -4, Balance: 6, EmployeeID: 3, Comment: "истек срок", CreatedAt: createdAt,
+	}
+	if got != want {
+		t.Errorf("CreateStockMovement() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCreateStockMovementTransfer(t *testing.T) {
+	db, mock := newMockDB(t)
+	createdAt := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	expectCheckEmployee(mock, 3, true)
+	expectLockProducts(mock, testMilk, testBread)
+	mock.ExpectQuery(`insert into Stock_Transfer \(source_product_id, target_product_id, quantity, employee_id, comment\)`).
+		WithArgs(int64(1), int64(2), int64(4), int64(3), "пересорт").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	// Расход и приход в одной транзакции ссылаются на один документ
+	documentType := sql.NullString{String: types.StockDocumentTransfer, Valid: true}
+	mock.ExpectQuery(`update Product set quantity_in_stock = quantity_in_stock \+ \$1 where id = \$2 returning quantity_in_stock`).WithArgs(int64(-4), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity_in_stock"}).AddRow(6))
+	mock.ExpectQuery(`insert into Stock_Movement`).
+		WithArgs(int64(1), types.StockMovementTransfer, int64(-4), documentType, int64(7), int64(3), "пересорт").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(55, createdAt))
+	mock.ExpectQuery(`update Product set quantity_in_stock = quantity_in_stock \+ \$1 where id = \$2 returning quantity_in_stock`).WithArgs(int64(4), int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity_in_stock"}).AddRow(14))
+	mock.ExpectQuery(`insert into Stock_Movement`).
+		WithArgs(int64(2), types.StockMovementTransfer, int64(4), documentType, int64(7), int64(3), "пересорт").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(56, createdAt))
+	mock.ExpectCommit()
+
+	got, err := db.CreateStockMovement(1, types.StockMovementRequest{
+		Kind: types.StockMovementTransfer, Quantity: -4, TargetProductID: 2, EmployeeID: 3, Comment: "пересорт",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 55 || got.Quantity != -4 || got.Balance != 6 || got.DocumentType != types.StockDocumentTransfer || got.DocumentID != 7 {
+		t.Errorf("outgoing = %+v, want movement 55 of -4 leaving 6 under transfer 7", got)
+	}
+	if in := got.Incoming; in == nil || in.ID != 56 || in.Quantity != 4 || in.Balance != 14 || in.DocumentID != 7 {
+		t.Errorf("incoming = %+v, want movement 56 of 4 leaving 14 under transfer 7", in)
+	}
+}
+
+func TestCreateStockMovementRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		request types.StockMovementRequest
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name:    "unknown employee",
+			request: types.StockMovementRequest{Kind: types.StockMovementWriteOff, Quantity: -1, EmployeeID: 9},
+			expect:  func(mock sqlmock.Sqlmock) { expectCheckEmployee(mock, 9, false) },
+			wantErr: &ValidationError{},
+		},
+		{
+			name:    "unknown product",
+			request: types.StockMovementRequest{Kind: types.StockMovementAdjustment, Quantity: 1, EmployeeID: 3},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectCheckEmployee(mock, 3, true)
+				expectLockProducts(mock)
+			},
+			wantErr: &NotFoundError{},
+		},
+		{
+			name:    "write_off below zero",
+			request: types.StockMovementRequest{Kind: types.StockMovementWriteOff, Quantity: -11, EmployeeID: 3},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectCheckEmployee(mock, 3, true)
+				expectLockProducts(mock, testMilk)
+			},
+			wantErr: &InsufficientStockError{},
+		},
+		{
+			name:    "unknown transfer target",
+			request: types.StockMovementRequest{Kind: types.StockMovementTransfer, Quantity: -1, TargetProductID: 2, EmployeeID: 3},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectCheckEmployee(mock, 3, true)
+				expectLockProducts(mock, testMilk)
+			},
+			wantErr: &ValidationError{},
+		},
+		{
+			name:    "transfer below zero",
+			request: types.StockMovementRequest{Kind: types.StockMovementTransfer, Quantity: -11, TargetProductID: 2, EmployeeID: 3},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectCheckEmployee(mock, 3, true)
+				expectLockProducts(mock, testMilk, testBread)
+			},
+			wantErr: &InsufficientStockError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			tt.expect(mock)
+			mock.ExpectRollback()
+
+			_, err := db.CreateStockMovement(1, tt.request)
+			if !hasErrorType(err, tt.wantErr) {
+				t.Errorf("CreateStockMovement() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckStockLedger(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`from Product as p\s+left join Stock_Movement as sm on sm.product_id = p.id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity_in_stock", "ledger"}).
+			AddRow(1, "Milk", 10, 10).
+			AddRow(2, "Bread", 7, 4))
+
+	got, err := db.CheckStockLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Consistent || got.Products != 2 || len(got.Mismatches) != 1 {
+		t.Fatalf("CheckStockLedger() = %+v, want 2 products with one mismatch", got)
+	}
+	if m := got.Mismatches[0]; m.ProductID != 2 || m.Stock != 7 || m.Ledger != 4 || m.Difference != 3 {
+		t.Errorf("mismatch = %+v, want product 2 with difference 3", m)
+	}
+}
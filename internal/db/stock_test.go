@@ -0,0 +1,96 @@
+package db
+
+import (
+	"db5/internal/types"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectStockUpdate изменение остатка и его запись в журнале движений вида kind
+func expectStockUpdate(mock sqlmock.Sqlmock, productID, delta int64, kind string) {
+	mock.ExpectQuery(`update Product set quantity_in_stock = quantity_in_stock \+ \$1 where id = \$2 returning quantity_in_stock`).
+		WithArgs(delta, productID).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity_in_stock"}).AddRow(delta))
+	mock.ExpectQuery(`insert into Stock_Movement \(product_id, kind, quantity, document_type, document_id, employee_id, comment\)`).
+		WithArgs(productID, kind, delta, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Time{}))
+}
+
+func TestCheckStock(t *testing.T) {
+	products := map[int64]stockProduct{
+		1: {category: "dairy", quantity: 5},
+		2: {category: "weighed", quantity: 0},
+		3: {category: "bakery", quantity: -2},
+	}
+	tests := []struct {
+		name  string
+		lines []receiptLine
+		want  []types.InsufficientStockResponse
+	}{
+		{
+			name:  "enough stock",
+			lines: []receiptLine{{productID: 1, quantity: 5}},
+		},
+		{
+			name:  "repeated lines are summed",
+			lines: []receiptLine{{productID: 1, quantity: 3}, {productID: 1, quantity: 3}},
+			want:  []types.InsufficientStockResponse{{ProductID: 1, Requested: 6, Available: 5}},
+		},
+		{
+			name:  "negative stock category is not checked",
+			lines: []receiptLine{{productID: 2, category: "weighed", quantity: 4}},
+		},
+		{
+			name:  "all shortages in receipt order",
+			lines: []receiptLine{{productID: 3, quantity: 1}, {productID: 1, quantity: 6}, {productID: 2, quantity: 1}},
+			want: []types.InsufficientStockResponse{
+				{ProductID: 3, Requested: 1, Available: -2},
+				{ProductID: 1, Requested: 6, Available: 5},
+			},
+		},
+	}
+	db := &DB{negativeStockCategories: []string{"weighed"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.checkStock(tt.lines, products)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("checkStock() = %v, want nil", err)
+				}
+				return
+			}
+			var stockErr *InsufficientStockError
+			if !errors.As(err, &stockErr) {
+				t.Fatalf("checkStock() = %v, want InsufficientStockError", err)
+			}
+			if !reflect.DeepEqual(stockErr.Items, tt.want) {
+				t.Errorf("shortages = %+v, want %+v", stockErr.Items, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateNewReceiptRejectsOversold(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectOpenShift(mock, 3, 8)
+	expectLockProducts(mock, testProduct{id: 1, name: "Milk", price: 8990, category: "dairy", stock: 2})
+	expectActivePromotions(mock)
+	mock.ExpectRollback()
+
+	_, err := db.CreateNewReceipt(types.ReceiptInfoRequest{
+		TellerID: 3,
+		Products: []types.ReceiptProductInfoRequest{{ProductID: 1, Quantity: 3}},
+	})
+	var stockErr *InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("CreateNewReceipt() error = %v, want InsufficientStockError", err)
+	}
+	if got := stockErr.Error(); got != "insufficient stock for products: 1" {
+		t.Errorf("Error() = %q", got)
+	}
+}
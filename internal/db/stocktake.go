@@ -0,0 +1,406 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// stocktakeMovedQuery движение после открытия: у закрытой инвентаризации зафиксированное, у открытой по журналу
+const stocktakeMovedQuery = `coalesce(si.moved_quantity, (
+	select coalesce(sum(sm.quantity), 0) from Stock_Movement as sm
+	where sm.product_id = si.product_id and sm.id > s.last_movement_id))`
+
+// OpenStocktake ожидаемый остаток — зафиксированный при открытии плюс движения журнала после него
+func (db *DB) OpenStocktake(openInfo types.StocktakeOpenRequest) (types.StocktakeResponse, error) {
+	if openInfo.EmployeeID == 0 {
+		return types.StocktakeResponse{}, newValidationError("employee_id is required")
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkEmployee(tx, openInfo.EmployeeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %w", err)
+	}
+
+	// Блокировка отдела не дает открыть две инвентаризации одновременно
+	var departmentID int64
+	err = tx.QueryRow("select id from Department where id = $1 for update", openInfo.DepartmentID).Scan(&departmentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.StocktakeResponse{}, newValidationError("department %d not found", openInfo.DepartmentID)
+	}
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	}
+
+	var openID int64
+	err = tx.QueryRow("select id from Stocktake where department_id = $1 and status = $2", departmentID, types.StocktakeStatusOpen).Scan(&openID)
+	if err == nil {
+		return types.StocktakeResponse{}, newConflictError("department %d already has open stocktake %d", departmentID, openID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	}
+
+	// Блокировка товаров дожидается документов, которые уже меняют их остатки. После нее каждое
+	// движение этих товаров либо видно в остатке, либо получит id больше last_movement_id.
+	if _, err := tx.Exec("select id from Product where department_id = $1 order by id for share", departmentID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	}
+
+	var stocktakeID int64
+	err = tx.QueryRow(`
+	insert into Stocktake (department_id, status, comment, opened_by, last_movement_id)
+	values ($1, $2, $3, $4, (select coalesce(max(id), 0) from Stock_Movement))
+	returning id`,
+		departmentID, types.StocktakeStatusOpen, strings.TrimSpace(openInfo.Comment), openInfo.EmployeeID).Scan(&stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	}
+
+	result, err := tx.Exec(`
+	insert into Stocktake_Item (stocktake_id, product_id, expected_quantity, unit_cost)
+	select $1, p.id, p.quantity_in_stock, round(c.unit_cost, 2)
+	from Product as p
+	left join (`+productUnitCostsQuery+`) as c on c.product_id = p.id
+	where p.department_id = $2`, stocktakeID, departmentID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	}
+	if products, err := result.RowsAffected(); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	} else if products == 0 {
+		return types.StocktakeResponse{}, newValidationError("department %d has no products", departmentID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	}
+
+	stocktake, err := db.getStocktake(stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("OpenStocktake: %v", err)
+	}
+	return stocktake, nil
+}
+
+func (db *DB) GetStocktakes(status string) ([]types.StocktakeResponse, error) {
+	switch status {
+	case "", types.StocktakeStatusOpen, types.StocktakeStatusApproved, types.StocktakeStatusCancelled:
+	default:
+		return nil, newValidationError("unknown stocktake status %q", status)
+	}
+
+	stocktakes, err := db.queryStocktakes("$1 = '' or s.status = $1", status)
+	if err != nil {
+		return nil, fmt.Errorf("GetStocktakes: %v", err)
+	}
+	return stocktakes, nil
+}
+
+func (db *DB) GetStocktake(stocktakeID int64) (types.StocktakeResponse, error) {
+	stocktake, err := db.getStocktake(stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("GetStocktake: %w", err)
+	}
+	return stocktake, nil
+}
+
+// CountStocktake подсчеты одного товара из разных выгрузок складываются
+func (db *DB) CountStocktake(stocktakeID int64, countInfo types.StocktakeCountRequest) (types.StocktakeResponse, error) {
+	if countInfo.EmployeeID == 0 {
+		return types.StocktakeResponse{}, newValidationError("employee_id is required")
+	}
+	if len(countInfo.Items) == 0 {
+		return types.StocktakeResponse{}, newValidationError("count has no items")
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CountStocktake: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkEmployee(tx, countInfo.EmployeeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CountStocktake: %w", err)
+	}
+	if err := db.lockOpenStocktake(tx, stocktakeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CountStocktake: %w", err)
+	}
+
+	for _, item := range countInfo.Items {
+		var counted int64
+		err := tx.QueryRow(`
+		update Stocktake_Item set counted_quantity = coalesce(counted_quantity, 0) + $1
+		where stocktake_id = $2 and product_id = $3
+		returning counted_quantity`, item.Quantity, stocktakeID, item.ProductID).Scan(&counted)
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.StocktakeResponse{}, newValidationError("product %d is not in stocktake %d", item.ProductID, stocktakeID)
+		}
+		if err != nil {
+			return types.StocktakeResponse{}, fmt.Errorf("CountStocktake: %v", err)
+		}
+		if counted < 0 {
+			return types.StocktakeResponse{}, newValidationError("product %d: counted quantity cannot be negative", item.ProductID)
+		}
+
+		_, err = tx.Exec("insert into Stocktake_Count (stocktake_id, product_id, quantity, employee_id) values ($1, $2, $3, $4)",
+			stocktakeID, item.ProductID, item.Quantity, countInfo.EmployeeID)
+		if err != nil {
+			return types.StocktakeResponse{}, fmt.Errorf("CountStocktake: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CountStocktake: %v", err)
+	}
+
+	stocktake, err := db.getStocktake(stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CountStocktake: %v", err)
+	}
+	return stocktake, nil
+}
+
+// ApproveStocktake неподсчитанные товары не меняются
+func (db *DB) ApproveStocktake(stocktakeID int64, closeInfo types.StocktakeCloseRequest) (types.StocktakeResponse, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.checkSupervisor(tx, closeInfo.EmployeeID, "approve stocktakes"); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %w", err)
+	}
+	if err := db.lockOpenStocktake(tx, stocktakeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %w", err)
+	}
+
+	// Порядок по товару, как в lockProducts, чтобы не ловить взаимную блокировку с продажами.
+	// Пока товары заблокированы, движение после открытия не может измениться.
+	_, err = tx.Exec(`
+	select p.id from Product as p
+	join Stocktake_Item as si on si.product_id = p.id
+	where si.stocktake_id = $1
+	order by p.id
+	for update of p`, stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+	}
+	if err := db.fixStocktakeMovements(tx, stocktakeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+	}
+
+	rows, err := tx.Query(`
+	select product_id, counted_quantity - (expected_quantity + moved_quantity)
+	from Stocktake_Item
+	where stocktake_id = $1 and counted_quantity is not null and counted_quantity <> expected_quantity + moved_quantity
+	order by product_id`, stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+	}
+	variances := make(map[int64]int64)
+	var productIDs []int64
+	for rows.Next() {
+		var productID, variance int64
+		if err := rows.Scan(&productID, &variance); err != nil {
+			rows.Close()
+			return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+		}
+		variances[productID] = variance
+		productIDs = append(productIDs, productID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+	}
+
+	movement := stockMovement{
+		kind:         types.StockMovementAdjustment,
+		documentType: types.StockDocumentStocktake,
+		documentID:   stocktakeID,
+		employeeID:   closeInfo.EmployeeID,
+		comment:      "инвентаризация",
+	}
+	for _, productID := range productIDs {
+		if _, err := db.updateProductStock(tx, productID, variances[productID], movement); err != nil {
+			return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+		}
+	}
+
+	if err := db.closeStocktake(tx, stocktakeID, types.StocktakeStatusApproved, closeInfo.EmployeeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+	}
+
+	stocktake, err := db.getStocktake(stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("ApproveStocktake: %v", err)
+	}
+	return stocktake, nil
+}
+
+func (db *DB) CancelStocktake(stocktakeID int64, closeInfo types.StocktakeCloseRequest) (types.StocktakeResponse, error) {
+	if closeInfo.EmployeeID == 0 {
+		return types.StocktakeResponse{}, newValidationError("employee_id is required")
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CancelStocktake: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkEmployee(tx, closeInfo.EmployeeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CancelStocktake: %w", err)
+	}
+	if err := db.lockOpenStocktake(tx, stocktakeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CancelStocktake: %w", err)
+	}
+	if err := db.fixStocktakeMovements(tx, stocktakeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CancelStocktake: %v", err)
+	}
+	if err := db.closeStocktake(tx, stocktakeID, types.StocktakeStatusCancelled, closeInfo.EmployeeID); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CancelStocktake: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CancelStocktake: %v", err)
+	}
+
+	stocktake, err := db.getStocktake(stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("CancelStocktake: %v", err)
+	}
+	return stocktake, nil
+}
+
+// lockOpenStocktake блокирует инвентаризацию до конца транзакции: подсчеты и утверждение идут по очереди
+func (db *DB) lockOpenStocktake(tx *sql.Tx, stocktakeID int64) error {
+	var status string
+	err := tx.QueryRow("select status from Stocktake where id = $1 for update", stocktakeID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return newNotFoundError("stocktake %d not found", stocktakeID)
+	}
+	if err != nil {
+		return fmt.Errorf("lockOpenStocktake: %v", err)
+	}
+	if status != types.StocktakeStatusOpen {
+		return newConflictError("stocktake %d is already %s", stocktakeID, status)
+	}
+	return nil
+}
+
+// fixStocktakeMovements расхождения закрытой инвентаризации не меняются от последующих продаж и ее корректировок
+func (db *DB) fixStocktakeMovements(tx *sql.Tx, stocktakeID int64) error {
+	_, err := tx.Exec(`
+	update Stocktake_Item as si set moved_quantity = `+stocktakeMovedQuery+`
+	from Stocktake as s
+	where s.id = si.stocktake_id and si.stocktake_id = $1`, stocktakeID)
+	if err != nil {
+		return fmt.Errorf("fixStocktakeMovements: %v", err)
+	}
+	return nil
+}
+
+func (db *DB) closeStocktake(tx *sql.Tx, stocktakeID int64, status string, employeeID int64) error {
+	_, err := tx.Exec("update Stocktake set status = $1, closed_by = $2, closed_at = now() where id = $3", status, employeeID, stocktakeID)
+	return err
+}
+
+func (db *DB) queryStocktakes(where string, args ...any) ([]types.StocktakeResponse, error) {
+	rows, err := db.db.Query(`
+	select s.id, s.department_id, d.name, s.status, s.comment, s.opened_by, s.opened_at, s.closed_by, s.closed_at,
+	count(si.product_id), count(si.counted_quantity),
+	coalesce(sum(si.counted_quantity - si.expected_quantity - moved.quantity), 0),
+	coalesce(sum((si.counted_quantity - si.expected_quantity - moved.quantity) * si.unit_cost), 0)
+	from Stocktake as s
+	join Department as d on d.id = s.department_id
+	left join Stocktake_Item as si on si.stocktake_id = s.id
+	left join lateral (select `+stocktakeMovedQuery+` as quantity) as moved on true
+	where `+where+`
+	group by s.id, d.name
+	order by s.id desc`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stocktakes := []types.StocktakeResponse{}
+	for rows.Next() {
+		var stocktake types.StocktakeResponse
+		var closedBy sql.NullInt64
+		var closedAt sql.NullTime
+		if err := rows.Scan(&stocktake.ID, &stocktake.DepartmentID, &stocktake.DepartmentName, &stocktake.Status, &stocktake.Comment,
+			&stocktake.OpenedBy, &stocktake.OpenedAt, &closedBy, &closedAt,
+			&stocktake.Products, &stocktake.Counted, &stocktake.Variance, &stocktake.VarianceValue); err != nil {
+			return nil, err
+		}
+		if closedBy.Valid {
+			stocktake.ClosedBy = &closedBy.Int64
+		}
+		if closedAt.Valid {
+			stocktake.ClosedAt = &closedAt.Time
+		}
+		stocktakes = append(stocktakes, stocktake)
+	}
+	return stocktakes, rows.Err()
+}
+
+func (db *DB) getStocktake(stocktakeID int64) (types.StocktakeResponse, error) {
+	stocktakes, err := db.queryStocktakes("s.id = $1", stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("getStocktake: %v", err)
+	}
+	if len(stocktakes) == 0 {
+		return types.StocktakeResponse{}, newNotFoundError("stocktake %d not found", stocktakeID)
+	}
+	stocktake := stocktakes[0]
+
+	rows, err := db.db.Query(`
+	select si.product_id, p.name, si.expected_quantity, `+stocktakeMovedQuery+`, si.counted_quantity, si.unit_cost
+	from Stocktake_Item as si
+	join Stocktake as s on s.id = si.stocktake_id
+	join Product as p on p.id = si.product_id
+	where si.stocktake_id = $1
+	order by p.name, si.product_id`, stocktakeID)
+	if err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("getStocktake: %v", err)
+	}
+	defer rows.Close()
+
+	stocktake.Items = []types.StocktakeItemResponse{}
+	for rows.Next() {
+		var item types.StocktakeItemResponse
+		var counted sql.NullInt64
+		var unitCost sql.Null[types.Money]
+		if err := rows.Scan(&item.ProductID, &item.Name, &item.Expected, &item.Moved, &counted, &unitCost); err != nil {
+			return types.StocktakeResponse{}, fmt.Errorf("getStocktake: %v", err)
+		}
+		if unitCost.Valid {
+			item.UnitCost = &unitCost.V
+		}
+		if counted.Valid {
+			variance := counted.Int64 - (item.Expected + item.Moved)
+			item.Counted = &counted.Int64
+			item.Variance = &variance
+			if unitCost.Valid {
+				value := unitCost.V.Mul(variance)
+				item.VarianceValue = &value
+			}
+		}
+		stocktake.Items = append(stocktake.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return types.StocktakeResponse{}, fmt.Errorf("getStocktake: %v", err)
+	}
+	return stocktake, nil
+}
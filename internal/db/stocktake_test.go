@@ -0,0 +1,169 @@
+package db
+
+import (
+	"db5/internal/types"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectLockStocktake(mock sqlmock.Sqlmock, status string) {
+	mock.ExpectQuery(`select status from Stocktake where id = \$1 for update`).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(status))
+}
+
+// expectStocktakeRead инвентаризация 4: после открытия продано одно молоко, подсчитано 8 из 9 ожидаемых;
+// хлеб не подсчитан и ни разу не закупался
+func expectStocktakeRead(mock sqlmock.Sqlmock, status string) {
+	mock.ExpectQuery(`from Stocktake as s`).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "department_id", "name", "status", "comment", "opened_by", "opened_at", "closed_by", "closed_at",
+			"products", "counted", "variance", "variance_value"}).
+			AddRow(4, 1, "Молочный", status, "", 3, time.Now(), nil, nil, 2, 1, -1, "-55.00"))
+	mock.ExpectQuery(`from Stocktake_Item as si`).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "name", "expected_quantity", "moved_quantity", "counted_quantity", "unit_cost"}).
+			AddRow(2, "Bread", 10, 0, nil, nil).
+			AddRow(1, "Milk", 10, -1, 8, "55.00"))
+}
+
+func TestGetStocktake(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectStocktakeRead(mock, types.StocktakeStatusOpen)
+
+	got, err := db.GetStocktake(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Products != 2 || got.Counted != 1 || got.Variance != -1 || got.VarianceValue != -5500 || len(got.Items) != 2 {
+		t.Fatalf("GetStocktake() = %+v, want 2 products, 1 counted, variance -1 worth -55.00", got)
+	}
+	if bread := got.Items[0]; bread.Counted != nil || bread.Variance != nil || bread.UnitCost != nil || bread.VarianceValue != nil {
+		t.Errorf("uncounted item = %+v, want no count, variance or cost", bread)
+	}
+	milk := got.Items[1]
+	if milk.Moved != -1 || milk.Counted == nil || *milk.Counted != 8 || milk.Variance == nil || *milk.Variance != -1 ||
+		milk.VarianceValue == nil || *milk.VarianceValue != -5500 {
+		t.Errorf("counted item = %+v, want moved -1, counted 8, variance -1 worth -55.00", milk)
+	}
+}
+
+func TestApproveStocktake(t *testing.T) {
+	db, mock := newMockDB(t)
+	db.supervisorPositions = []string{"Администратор"}
+
+	mock.ExpectBegin()
+	expectSupervisor(mock, "Администратор")
+	expectLockStocktake(mock, types.StocktakeStatusOpen)
+	mock.ExpectExec(`select p.id from Product as p\s+join Stocktake_Item as si on si.product_id = p.id\s+where si.stocktake_id = \$1\s+order by p.id\s+for update of p`).
+		WithArgs(int64(4)).WillReturnResult(sqlmock.NewResult(0, 2))
+	// движение после открытия фиксируется до расчета расхождений
+	mock.ExpectExec(`update Stocktake_Item as si set moved_quantity = coalesce\(si.moved_quantity`).WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`select product_id, counted_quantity - \(expected_quantity \+ moved_quantity\)\s+from Stocktake_Item`).WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "variance"}).AddRow(1, -2).AddRow(3, 5))
+	for _, line := range []struct{ productID, variance int64 }{{1, -2}, {3, 5}} {
+		mock.ExpectQuery(`update Product set quantity_in_stock = quantity_in_stock \+ \$1 where id = \$2 returning quantity_in_stock`).WithArgs(line.variance, line.productID).
+			WillReturnRows(sqlmock.NewRows([]string{"quantity_in_stock"}).AddRow(line.variance))
+		mock.ExpectQuery(`insert into Stock_Movement`).
+			WithArgs(line.productID, types.StockMovementAdjustment, line.variance, sqlmock.AnyArg(), int64(4), int64(2), "инвентаризация").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Time{}))
+	}
+	mock.ExpectExec(`update Stocktake set status = \$1, closed_by = \$2, closed_at = now\(\) where id = \$3`).
+		WithArgs(types.StocktakeStatusApproved, int64(2), int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectStocktakeRead(mock, types.StocktakeStatusApproved)
+
+	got, err := db.ApproveStocktake(4, types.StocktakeCloseRequest{EmployeeID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != types.StocktakeStatusApproved {
+		t.Errorf("status = %s, want approved", got.Status)
+	}
+}
+
+func TestApproveStocktakeRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		position string
+		status   string
+		wantErr  error
+	}{
+		{name: "not a supervisor", position: "Кассир", wantErr: &ValidationError{}},
+		{name: "already approved", position: "Администратор", status: types.StocktakeStatusApproved, wantErr: &ConflictError{}},
+		{name: "cancelled", position: "Администратор", status: types.StocktakeStatusCancelled, wantErr: &ConflictError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			db.supervisorPositions = []string{"Администратор"}
+			mock.ExpectBegin()
+			expectSupervisor(mock, tt.position)
+			if tt.status != "" {
+				expectLockStocktake(mock, tt.status)
+			}
+			mock.ExpectRollback()
+
+			_, err := db.ApproveStocktake(4, types.StocktakeCloseRequest{EmployeeID: 2})
+			if !hasErrorType(err, tt.wantErr) {
+				t.Errorf("ApproveStocktake() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCountStocktake(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectCheckEmployee(mock, 3, true)
+	expectLockStocktake(mock, types.StocktakeStatusOpen)
+	mock.ExpectQuery(`update Stocktake_Item set counted_quantity = coalesce\(counted_quantity, 0\) \+ \$1`).WithArgs(int64(8), int64(4), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"counted_quantity"}).AddRow(8))
+	mock.ExpectExec(`insert into Stocktake_Count`).WithArgs(int64(4), int64(1), int64(8), int64(3)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectStocktakeRead(mock, types.StocktakeStatusOpen)
+
+	_, err := db.CountStocktake(4, types.StocktakeCountRequest{
+		EmployeeID: 3,
+		Items:      []types.StocktakeCountItemRequest{{ProductID: 1, Quantity: 8}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCountStocktakeBelowZero(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectCheckEmployee(mock, 3, true)
+	expectLockStocktake(mock, types.StocktakeStatusOpen)
+	mock.ExpectQuery(`update Stocktake_Item set counted_quantity`).WithArgs(int64(-5), int64(4), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"counted_quantity"}).AddRow(-2))
+	mock.ExpectRollback()
+
+	_, err := db.CountStocktake(4, types.StocktakeCountRequest{
+		EmployeeID: 3,
+		Items:      []types.StocktakeCountItemRequest{{ProductID: 1, Quantity: -5}},
+	})
+	if !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("CountStocktake() error = %v, want ValidationError", err)
+	}
+}
+
+func TestOpenStocktakeAlreadyOpen(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	expectCheckEmployee(mock, 3, true)
+	mock.ExpectQuery(`select id from Department where id = \$1 for update`).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`select id from Stocktake where department_id = \$1 and status = \$2`).WithArgs(int64(1), types.StocktakeStatusOpen).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectRollback()
+
+	_, err := db.OpenStocktake(types.StocktakeOpenRequest{DepartmentID: 1, EmployeeID: 3})
+	if !hasErrorType(err, &ConflictError{}) {
+		t.Errorf("OpenStocktake() error = %v, want ConflictError", err)
+	}
+}
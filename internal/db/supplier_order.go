@@ -0,0 +1,279 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// supplierOrderTransitions переходы, доступные через смену статуса.
+// В partially_received и received заказ переводит только приемка. Отмена частично принятого
+// заказа закрывает недопоставку, принятый товар остается на складе.
+var supplierOrderTransitions = map[string][]string{
+	types.SupplierOrderStatusDraft:             {types.SupplierOrderStatusSubmitted, types.SupplierOrderStatusCancelled},
+	types.SupplierOrderStatusSubmitted:         {types.SupplierOrderStatusDraft, types.SupplierOrderStatusConfirmed, types.SupplierOrderStatusCancelled},
+	types.SupplierOrderStatusConfirmed:         {types.SupplierOrderStatusCancelled},
+	types.SupplierOrderStatusPartiallyReceived: {types.SupplierOrderStatusCancelled},
+}
+
+func isSupplierOrderStatus(status string) bool {
+	switch status {
+	case types.SupplierOrderStatusDraft,
+		types.SupplierOrderStatusSubmitted,
+		types.SupplierOrderStatusConfirmed,
+		types.SupplierOrderStatusPartiallyReceived,
+		types.SupplierOrderStatusReceived,
+		types.SupplierOrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func canReceiveSupplierOrder(status string) bool {
+	return status == types.SupplierOrderStatusConfirmed || status == types.SupplierOrderStatusPartiallyReceived
+}
+
+// ChangeSupplierOrderStatus переводит заказ в новый статус по правилам supplierOrderTransitions
+func (db *DB) ChangeSupplierOrderStatus(orderID int64, statusInfo types.SupplierOrderStatusRequest) (types.FullSupplierOrderInfoResponse, error) {
+	if !isSupplierOrderStatus(statusInfo.Status) {
+		return types.FullSupplierOrderInfoResponse{}, newValidationError("unknown supplier order status %q", statusInfo.Status)
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ChangeSupplierOrderStatus: %v", err)
+	}
+	defer tx.Rollback()
+
+	status, err := db.lockSupplierOrder(tx, orderID)
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ChangeSupplierOrderStatus: %w", err)
+	}
+
+	if !slices.Contains(supplierOrderTransitions[status], statusInfo.Status) {
+		return types.FullSupplierOrderInfoResponse{}, newConflictError("supplier order %d: cannot change status from %s to %s", orderID, status, statusInfo.Status)
+	}
+
+	if err := db.setSupplierOrderStatus(tx, orderID, statusInfo.Status); err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ChangeSupplierOrderStatus: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ChangeSupplierOrderStatus: %v", err)
+	}
+
+	order, err := db.getFullSupplierOrder(orderID)
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ChangeSupplierOrderStatus: %v", err)
+	}
+	return order, nil
+}
+
+type supplierOrderItem struct {
+	id               int64
+	productID        int64
+	quantity         int64
+	receivedQuantity int64
+}
+
+func (i supplierOrderItem) remaining() int64 {
+	return i.quantity - i.receivedQuantity
+}
+
+// ReceiveSupplierOrder без списка строк принимает весь непринятый остаток заказа
+func (db *DB) ReceiveSupplierOrder(orderID int64, receiveInfo types.SupplierOrderReceiveRequest) (types.FullSupplierOrderInfoResponse, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %v", err)
+	}
+	defer tx.Rollback()
+
+	if receiveInfo.EmployeeID != 0 {
+		if err := checkEmployee(tx, receiveInfo.EmployeeID); err != nil {
+			return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %w", err)
+		}
+	}
+
+	status, err := db.lockSupplierOrder(tx, orderID)
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %w", err)
+	}
+	if !canReceiveSupplierOrder(status) {
+		return types.FullSupplierOrderInfoResponse{}, newConflictError("supplier order %d is %s and cannot be received", orderID, status)
+	}
+
+	items, err := db.lockSupplierOrderItems(tx, orderID)
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %v", err)
+	}
+
+	received, err := receivedQuantities(items, receiveInfo)
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %w", err)
+	}
+
+	fullyReceived := true
+	for i := range items {
+		quantity := received[items[i].id]
+		if quantity > 0 {
+			if _, err := tx.Exec("update Supplier_Order_Items set received_quantity = received_quantity + $1 where id = $2", quantity, items[i].id); err != nil {
+				return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %v", err)
+			}
+			if _, err := db.updateProductStock(tx, items[i].productID, quantity, stockMovement{
+				kind: types.StockMovementSupplierReceipt, documentType: types.StockDocumentSupplierOrder, documentID: orderID, employeeID: receiveInfo.EmployeeID,
+			}); err != nil {
+				return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %v", err)
+			}
+			items[i].receivedQuantity += quantity
+		}
+		if items[i].remaining() > 0 {
+			fullyReceived = false
+		}
+	}
+
+	if fullyReceived {
+		if _, err := tx.Exec("update Supplier_Order set date_of_receipt = now() where id = $1", orderID); err != nil {
+			return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %v", err)
+		}
+		status = types.SupplierOrderStatusReceived
+	} else {
+		status = types.SupplierOrderStatusPartiallyReceived
+	}
+	if err := db.setSupplierOrderStatus(tx, orderID, status); err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %v", err)
+	}
+
+	order, err := db.getFullSupplierOrder(orderID)
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("ReceiveSupplierOrder: %v", err)
+	}
+	return order, nil
+}
+
+// receivedQuantities количество к приемке по строкам, не больше непринятого остатка
+func receivedQuantities(items []supplierOrderItem, receiveInfo types.SupplierOrderReceiveRequest) (map[int64]int64, error) {
+	received := make(map[int64]int64, len(items))
+
+	if len(receiveInfo.Items) == 0 {
+		for _, item := range items {
+			if item.remaining() > 0 {
+				received[item.id] = item.remaining()
+			}
+		}
+		if len(received) == 0 {
+			return nil, newConflictError("order is already fully received")
+		}
+		return received, nil
+	}
+
+	byID := make(map[int64]supplierOrderItem, len(items))
+	for _, item := range items {
+		byID[item.id] = item
+	}
+
+	for _, request := range receiveInfo.Items {
+		item, ok := byID[request.ItemID]
+		if !ok {
+			return nil, newValidationError("item %d does not belong to the order", request.ItemID)
+		}
+		if request.Quantity <= 0 {
+			return nil, newValidationError("item %d: quantity must be positive", request.ItemID)
+		}
+		received[item.id] += request.Quantity
+		if received[item.id] > item.remaining() {
+			return nil, newConflictError("item %d: only %d left to receive", item.id, item.remaining())
+		}
+	}
+	return received, nil
+}
+
+func (db *DB) lockSupplierOrder(tx *sql.Tx, orderID int64) (string, error) {
+	var status string
+	err := tx.QueryRow("select status from Supplier_Order where id = $1 for update", orderID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", newNotFoundError("supplier order %d not found", orderID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("lockSupplierOrder: %v", err)
+	}
+	return status, nil
+}
+
+func (db *DB) setSupplierOrderStatus(tx *sql.Tx, orderID int64, status string) error {
+	_, err := tx.Exec("update Supplier_Order set status = $1 where id = $2", status, orderID)
+	if err != nil {
+		return fmt.Errorf("setSupplierOrderStatus: %v", err)
+	}
+	return nil
+}
+
+func (db *DB) lockSupplierOrderItems(tx *sql.Tx, orderID int64) ([]supplierOrderItem, error) {
+	rows, err := tx.Query("select id, product_id, quantity, received_quantity from Supplier_Order_Items where order_id = $1 order by id for update", orderID)
+	if err != nil {
+		return nil, fmt.Errorf("lockSupplierOrderItems: %v", err)
+	}
+	defer rows.Close()
+
+	var items []supplierOrderItem
+	for rows.Next() {
+		var item supplierOrderItem
+		if err := rows.Scan(&item.id, &item.productID, &item.quantity, &item.receivedQuantity); err != nil {
+			return nil, fmt.Errorf("lockSupplierOrderItems: %v", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("lockSupplierOrderItems: %v", err)
+	}
+	return items, nil
+}
+
+func (db *DB) GetSupplierOrder(orderID int64) (types.FullSupplierOrderInfoResponse, error) {
+	order, err := db.getFullSupplierOrder(orderID)
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("GetSupplierOrder: %w", err)
+	}
+	return order, nil
+}
+
+func (db *DB) getFullSupplierOrder(orderID int64) (types.FullSupplierOrderInfoResponse, error) {
+	query := `
+	select
+	so.order_date,
+	so.date_of_receipt,
+	so.id,
+	so.status,
+	so.currency,
+	so.exchange_rate,
+	so.total_amount,
+	s.name
+	from Supplier_Order as so
+	join Supplier as s on so.supplier_id = s.id
+	where so.id = $1`
+	var order types.FullSupplierOrderInfoResponse
+	var nt sql.NullTime
+
+	err := db.db.QueryRow(query, orderID).Scan(&order.OrderDate, &nt, &order.ID, &order.Status, &order.Currency, &order.ExchangeRate, &order.Total, &order.SupplierName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.FullSupplierOrderInfoResponse{}, newNotFoundError("supplier order %d not found", orderID)
+	}
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("getFullSupplierOrder: %v", err)
+	}
+	if nt.Valid {
+		order.DateOfReceipt = nt.Time
+	}
+
+	order.SupplierOrderItems, err = db.getSupplierOrderItemByOrderID(orderID)
+	if err != nil {
+		return types.FullSupplierOrderInfoResponse{}, fmt.Errorf("getFullSupplierOrder: %v", err)
+	}
+	order.BaseTotal = supplierOrderBaseTotal(order.SupplierOrderItems)
+	return order, nil
+}
@@ -0,0 +1,278 @@
+package db
+
+import (
+	"db5/internal/types"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReceivedQuantities(t *testing.T) {
+	items := []supplierOrderItem{
+		{id: 1, productID: 10, quantity: 5, receivedQuantity: 2},
+		{id: 2, productID: 20, quantity: 4, receivedQuantity: 4},
+		{id: 3, productID: 30, quantity: 1},
+	}
+	tests := []struct {
+		name    string
+		request []types.SupplierOrderReceiveItemRequest
+		want    map[int64]int64
+		wantErr error
+	}{
+		{
+			name: "everything left",
+			want: map[int64]int64{1: 3, 3: 1},
+		},
+		{
+			name:    "partial line",
+			request: []types.SupplierOrderReceiveItemRequest{{ItemID: 1, Quantity: 2}},
+			want:    map[int64]int64{1: 2},
+		},
+		{
+			name:    "repeated line is summed",
+			request: []types.SupplierOrderReceiveItemRequest{{ItemID: 1, Quantity: 2}, {ItemID: 1, Quantity: 1}},
+			want:    map[int64]int64{1: 3},
+		},
+		{
+			name:    "more than left",
+			request: []types.SupplierOrderReceiveItemRequest{{ItemID: 1, Quantity: 4}},
+			wantErr: &ConflictError{},
+		},
+		{
+			name:    "received line",
+			request: []types.SupplierOrderReceiveItemRequest{{ItemID: 2, Quantity: 1}},
+			wantErr: &ConflictError{},
+		},
+		{
+			name:    "foreign line",
+			request: []types.SupplierOrderReceiveItemRequest{{ItemID: 9, Quantity: 1}},
+			wantErr: &ValidationError{},
+		},
+		{
+			name:    "zero quantity",
+			request: []types.SupplierOrderReceiveItemRequest{{ItemID: 1, Quantity: 0}},
+			wantErr: &ValidationError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := receivedQuantities(items, types.SupplierOrderReceiveRequest{Items: tt.request})
+			if tt.wantErr != nil {
+				if !hasErrorType(err, tt.wantErr) {
+					t.Fatalf("receivedQuantities() error = %v, want %T", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("receivedQuantities() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	fullyReceived := []supplierOrderItem{{id: 1, quantity: 5, receivedQuantity: 5}}
+	var conflictErr *ConflictError
+	if _, err := receivedQuantities(fullyReceived, types.SupplierOrderReceiveRequest{}); !errors.As(err, &conflictErr) {
+		t.Errorf("receiving a received order: error = %v, want ConflictError", err)
+	}
+}
+
+func expectSupplierOrderItems(mock sqlmock.Sqlmock, items ...supplierOrderItem) {
+	rows := sqlmock.NewRows([]string{"id", "product_id", "quantity", "received_quantity"})
+	for _, item := range items {
+		rows.AddRow(item.id, item.productID, item.quantity, item.receivedQuantity)
+	}
+	mock.ExpectQuery(`from Supplier_Order_Items where order_id = \$1 order by id for update`).WithArgs(int64(7)).WillReturnRows(rows)
+}
+
+func expectLockSupplierOrder(mock sqlmock.Sqlmock, status string) {
+	mock.ExpectQuery(`select status from Supplier_Order where id = \$1 for update`).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(status))
+}
+
+func expectSupplierOrderStatus(mock sqlmock.Sqlmock, status string) {
+	mock.ExpectExec(`update Supplier_Order set status = \$1 where id = \$2`).
+		WithArgs(status, int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectSupplierOrderRead(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`from Supplier_Order as so`).
+		WillReturnRows(sqlmock.NewRows([]string{"order_date", "date_of_receipt", "id", "status", "currency", "exchange_rate", "total_amount", "name"}).
+			AddRow(time.Now(), nil, 7, types.SupplierOrderStatusConfirmed, "RUB", 1.0, "500.00", "Dairy Farm"))
+	mock.ExpectQuery(`FROM Supplier_Order_Items as soi`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity", "received_quantity", "purchase_price", "base_purchase_price"}))
+}
+
+func TestReceiveSupplierOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  []types.SupplierOrderReceiveItemRequest
+		complete bool
+	}{
+		{name: "partial keeps the order open", request: []types.SupplierOrderReceiveItemRequest{{ItemID: 1, Quantity: 2}}},
+		{name: "last remainder closes the order", complete: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			expectLockSupplierOrder(mock, types.SupplierOrderStatusPartiallyReceived)
+			expectSupplierOrderItems(mock,
+				supplierOrderItem{id: 1, productID: 10, quantity: 5, receivedQuantity: 1},
+				supplierOrderItem{id: 2, productID: 20, quantity: 3, receivedQuantity: 3},
+			)
+			quantity := int64(4)
+			if !tt.complete {
+				quantity = 2
+			}
+			mock.ExpectExec(`update Supplier_Order_Items set received_quantity = received_quantity \+ \$1`).
+				WithArgs(quantity, int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+			expectStockUpdate(mock, 10, quantity, types.StockMovementSupplierReceipt)
+			if tt.complete {
+				mock.ExpectExec(`update Supplier_Order set date_of_receipt = now\(\)`).
+					WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectSupplierOrderStatus(mock, types.SupplierOrderStatusReceived)
+			} else {
+				expectSupplierOrderStatus(mock, types.SupplierOrderStatusPartiallyReceived)
+			}
+			mock.ExpectCommit()
+			expectSupplierOrderRead(mock)
+
+			if _, err := db.ReceiveSupplierOrder(7, types.SupplierOrderReceiveRequest{Items: tt.request}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestReceiveSupplierOrderNotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`select status from Supplier_Order where id = \$1 for update`).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}))
+	mock.ExpectRollback()
+
+	_, err := db.ReceiveSupplierOrder(7, types.SupplierOrderReceiveRequest{})
+	var notFoundErr *NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Errorf("ReceiveSupplierOrder() error = %v, want NotFoundError", err)
+	}
+}
+
+func TestReceiveSupplierOrderRequiresConfirmation(t *testing.T) {
+	for _, status := range []string{types.SupplierOrderStatusDraft, types.SupplierOrderStatusSubmitted, types.SupplierOrderStatusCancelled} {
+		t.Run(status, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			expectLockSupplierOrder(mock, status)
+			mock.ExpectRollback()
+
+			_, err := db.ReceiveSupplierOrder(7, types.SupplierOrderReceiveRequest{})
+			var conflictErr *ConflictError
+			if !errors.As(err, &conflictErr) {
+				t.Errorf("ReceiveSupplierOrder() error = %v, want ConflictError", err)
+			}
+		})
+	}
+}
+
+func TestSupplierOrderTransitions(t *testing.T) {
+	statuses := []string{
+		types.SupplierOrderStatusDraft,
+		types.SupplierOrderStatusSubmitted,
+		types.SupplierOrderStatusConfirmed,
+		types.SupplierOrderStatusPartiallyReceived,
+		types.SupplierOrderStatusReceived,
+		types.SupplierOrderStatusCancelled,
+	}
+	allowed := map[[2]string]bool{
+		{types.SupplierOrderStatusDraft, types.SupplierOrderStatusSubmitted}:             true,
+		{types.SupplierOrderStatusDraft, types.SupplierOrderStatusCancelled}:             true,
+		{types.SupplierOrderStatusSubmitted, types.SupplierOrderStatusDraft}:             true,
+		{types.SupplierOrderStatusSubmitted, types.SupplierOrderStatusConfirmed}:         true,
+		{types.SupplierOrderStatusSubmitted, types.SupplierOrderStatusCancelled}:         true,
+		{types.SupplierOrderStatusConfirmed, types.SupplierOrderStatusCancelled}:         true,
+		{types.SupplierOrderStatusPartiallyReceived, types.SupplierOrderStatusCancelled}: true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]string{from, to}]
+			if got := slices.Contains(supplierOrderTransitions[from], to); got != want {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestSupplierOrderStatuses(t *testing.T) {
+	tests := []struct {
+		status     string
+		known      bool
+		receivable bool
+	}{
+		{status: types.SupplierOrderStatusDraft, known: true},
+		{status: types.SupplierOrderStatusSubmitted, known: true},
+		{status: types.SupplierOrderStatusConfirmed, known: true, receivable: true},
+		{status: types.SupplierOrderStatusPartiallyReceived, known: true, receivable: true},
+		{status: types.SupplierOrderStatusReceived, known: true},
+		{status: types.SupplierOrderStatusCancelled, known: true},
+		{status: "shipped"},
+		{status: ""},
+	}
+	for _, tt := range tests {
+		if got := isSupplierOrderStatus(tt.status); got != tt.known {
+			t.Errorf("isSupplierOrderStatus(%q) = %v, want %v", tt.status, got, tt.known)
+		}
+		if got := canReceiveSupplierOrder(tt.status); got != tt.receivable {
+			t.Errorf("canReceiveSupplierOrder(%q) = %v, want %v", tt.status, got, tt.receivable)
+		}
+	}
+}
+
+func TestChangeSupplierOrderStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr error
+	}{
+		{name: "submit", from: types.SupplierOrderStatusDraft, to: types.SupplierOrderStatusSubmitted},
+		{name: "confirm", from: types.SupplierOrderStatusSubmitted, to: types.SupplierOrderStatusConfirmed},
+		{name: "skip submission", from: types.SupplierOrderStatusDraft, to: types.SupplierOrderStatusConfirmed, wantErr: &ConflictError{}},
+		{name: "receive by hand", from: types.SupplierOrderStatusConfirmed, to: types.SupplierOrderStatusReceived, wantErr: &ConflictError{}},
+		{name: "unknown status", to: "shipped", wantErr: &ValidationError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			if tt.from != "" {
+				mock.ExpectBegin()
+				expectLockSupplierOrder(mock, tt.from)
+				if tt.wantErr == nil {
+					expectSupplierOrderStatus(mock, tt.to)
+					mock.ExpectCommit()
+					expectSupplierOrderRead(mock)
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			_, err := db.ChangeSupplierOrderStatus(7, types.SupplierOrderStatusRequest{Status: tt.to})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !hasErrorType(err, tt.wantErr) {
+				t.Errorf("ChangeSupplierOrderStatus() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
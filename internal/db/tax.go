@@ -0,0 +1,192 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// vatIncluded НДС, включенный в сумму: amount * rate / (100 + rate)
+func vatIncluded(amount types.Money, rate float64) types.Money {
+	return types.Money(math.Round(float64(amount) * rate / (100 + rate)))
+}
+
+// taxTotals суммы и НДС строк по ставкам в порядке возрастания ставки.
+// split возвращает ставку, сумму строки и НДС строки.
+func taxTotals[T any](lines []T, split func(T) (float64, types.Money, types.Money)) []types.TaxTotalResponse {
+	byRate := make(map[float64]*types.TaxTotalResponse)
+	var rates []float64
+	for _, line := range lines {
+		rate, amount, tax := split(line)
+		total, ok := byRate[rate]
+		if !ok {
+			total = &types.TaxTotalResponse{Rate: rate}
+			byRate[rate] = total
+			rates = append(rates, rate)
+		}
+		total.Amount += amount
+		total.Tax += tax
+	}
+
+	slices.Sort(rates)
+	totals := make([]types.TaxTotalResponse, 0, len(rates))
+	for _, rate := range rates {
+		totals = append(totals, *byRate[rate])
+	}
+	return totals
+}
+
+// receiptProductTaxes разбивка сохраненного чека по ставкам. Строки, проданные до учета НДС, пропускаются.
+func receiptProductTaxes(products []types.ReceiptProductResponse) []types.TaxTotalResponse {
+	var taxed []types.ReceiptProductResponse
+	for _, product := range products {
+		if product.VatRate != nil {
+			taxed = append(taxed, product)
+		}
+	}
+	return taxTotals(taxed, func(product types.ReceiptProductResponse) (float64, types.Money, types.Money) {
+		return *product.VatRate, product.Amount, product.VatAmount
+	})
+}
+
+// getTaxReport продажи действующих чеков и возвраты за период по ставкам НДС
+func (db *DB) getTaxReport(from, to time.Time) ([]types.TaxReportResponse, error) {
+	query := `
+	select rate, sum(sales), sum(sales_tax), sum(refunds), sum(refunds_tax)
+	from (
+		select rp.vat_rate as rate, rp.amount as sales, rp.vat_amount as sales_tax, 0 as refunds, 0 as refunds_tax
+		from Receipt_Product as rp
+		join Receipt as r on r.id = rp.receipt_id
+		where r.status = 'active' and r.date_time >= $1 and r.date_time < $2 and rp.vat_rate is not null
+		union all
+		select rp.vat_rate, 0, 0, rrp.amount, rrp.vat_amount
+		from Receipt_Return_Product as rrp
+		join Receipt_Return as rr on rr.id = rrp.return_id
+		join Receipt_Product as rp on rp.id = rrp.receipt_product_id
+		where rr.date_time >= $1 and rr.date_time < $2 and rp.vat_rate is not null
+	) as t
+	group by rate
+	order by rate`
+
+	rows, err := db.db.Query(query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("getTaxReport: %v", err)
+	}
+	defer rows.Close()
+
+	taxes := []types.TaxReportResponse{}
+	for rows.Next() {
+		var tax types.TaxReportResponse
+		if err := rows.Scan(&tax.Rate, &tax.Sales, &tax.SalesTax, &tax.Refunds, &tax.RefundsTax); err != nil {
+			return nil, fmt.Errorf("getTaxReport: %v", err)
+		}
+		tax.Refunds = -tax.Refunds
+		tax.RefundsTax = -tax.RefundsTax
+		tax.NetTax = tax.SalesTax + tax.RefundsTax
+		taxes = append(taxes, tax)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getTaxReport: %v", err)
+	}
+	return taxes, nil
+}
+
+func validateVatRate(rate float64) error {
+	if rate < 0 || rate >= 100 {
+		return newValidationError("vat rate must be in [0, 100)")
+	}
+	return nil
+}
+
+// GetTaxRates ставка по умолчанию и все заданные ставки категорий и товаров
+func (db *DB) GetTaxRates() (types.TaxRatesResponse, error) {
+	response := types.TaxRatesResponse{
+		DefaultRate: db.vatDefaultRate,
+		Categories:  []types.CategoryTaxRateResponse{},
+		Products:    []types.ProductTaxRateResponse{},
+	}
+
+	rows, err := db.db.Query("select category, rate from Category_Tax_Rate order by category")
+	if err != nil {
+		return types.TaxRatesResponse{}, fmt.Errorf("GetTaxRates: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rate types.CategoryTaxRateResponse
+		if err := rows.Scan(&rate.Category, &rate.Rate); err != nil {
+			return types.TaxRatesResponse{}, fmt.Errorf("GetTaxRates: %v", err)
+		}
+		response.Categories = append(response.Categories, rate)
+	}
+	if err := rows.Err(); err != nil {
+		return types.TaxRatesResponse{}, fmt.Errorf("GetTaxRates: %v", err)
+	}
+
+	productRows, err := db.db.Query("select id, name, vat_rate from Product where vat_rate is not null order by id")
+	if err != nil {
+		return types.TaxRatesResponse{}, fmt.Errorf("GetTaxRates: %v", err)
+	}
+	defer productRows.Close()
+	for productRows.Next() {
+		var rate types.ProductTaxRateResponse
+		if err := productRows.Scan(&rate.ProductID, &rate.Name, &rate.Rate); err != nil {
+			return types.TaxRatesResponse{}, fmt.Errorf("GetTaxRates: %v", err)
+		}
+		response.Products = append(response.Products, rate)
+	}
+	if err := productRows.Err(); err != nil {
+		return types.TaxRatesResponse{}, fmt.Errorf("GetTaxRates: %v", err)
+	}
+	return response, nil
+}
+
+// SetCategoryTaxRate задает ставку категории, пустая ставка удаляет ее
+func (db *DB) SetCategoryTaxRate(category string, rateInfo types.TaxRateRequest) error {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return newValidationError("category is required")
+	}
+
+	if rateInfo.Rate == nil {
+		if _, err := db.db.Exec("delete from Category_Tax_Rate where category = $1", category); err != nil {
+			return fmt.Errorf("SetCategoryTaxRate: %v", err)
+		}
+		return nil
+	}
+
+	if err := validateVatRate(*rateInfo.Rate); err != nil {
+		return err
+	}
+	_, err := db.db.Exec("insert into Category_Tax_Rate (category, rate) values ($1, $2) on conflict (category) do update set rate = excluded.rate",
+		category, *rateInfo.Rate)
+	if err != nil {
+		return fmt.Errorf("SetCategoryTaxRate: %v", err)
+	}
+	return nil
+}
+
+// SetProductTaxRate задает собственную ставку товара, пустая ставка возвращает товар к ставке категории
+func (db *DB) SetProductTaxRate(productID int64, rateInfo types.TaxRateRequest) error {
+	var rate sql.NullFloat64
+	if rateInfo.Rate != nil {
+		if err := validateVatRate(*rateInfo.Rate); err != nil {
+			return err
+		}
+		rate = sql.NullFloat64{Float64: *rateInfo.Rate, Valid: true}
+	}
+
+	var id int64
+	err := db.db.QueryRow("update Product set vat_rate = $1 where id = $2 returning id", rate, productID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return newNotFoundError("product %d not found", productID)
+	}
+	if err != nil {
+		return fmt.Errorf("SetProductTaxRate: %v", err)
+	}
+	return nil
+}
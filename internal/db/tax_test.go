@@ -0,0 +1,92 @@
+package db
+
+import (
+	"database/sql"
+	"db5/internal/types"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestVatIncluded(t *testing.T) {
+	tests := []struct {
+		amount types.Money
+		rate   float64
+		want   types.Money
+	}{
+		{amount: 12000, rate: 20, want: 2000},
+		{amount: 26970, rate: 10, want: 2452},
+		{amount: 9100, rate: 20, want: 1517},
+		{amount: 10000, rate: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := vatIncluded(tt.amount, tt.rate); got != tt.want {
+			t.Errorf("vatIncluded(%v, %v) = %v, want %v", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestReceiptProductTaxes(t *testing.T) {
+	ten, twenty := 10.0, 20.0
+	products := []types.ReceiptProductResponse{
+		{Amount: 12000, VatRate: &twenty, VatAmount: 2000},
+		{Amount: 11000, VatRate: &ten, VatAmount: 1000},
+		{Amount: 6000, VatRate: &twenty, VatAmount: 1000},
+		{Amount: 5000},
+	}
+	want := []types.TaxTotalResponse{
+		{Rate: 10, Amount: 11000, Tax: 1000},
+		{Rate: 20, Amount: 18000, Tax: 3000},
+	}
+	if got := receiptProductTaxes(products); !reflect.DeepEqual(got, want) {
+		t.Errorf("receiptProductTaxes() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSoldLineRefundVat(t *testing.T) {
+	line := soldLine{quantity: 3, amount: 10000, vatRate: sql.NullFloat64{Float64: 20, Valid: true}, vatAmount: 1667}
+	if got := line.refundVat(1, 3333); got != 556 {
+		t.Errorf("refundVat(1) = %v, want 5.56", got)
+	}
+	line.returnedQuantity, line.returnedVat = 1, 556
+	if got := line.refundVat(2, 6667); got != 1111 {
+		t.Errorf("refundVat(rest) = %v, want 11.11", got)
+	}
+	if got := (soldLine{quantity: 1, amount: 10000}).refundVat(1, 10000); got != 0 {
+		t.Errorf("refundVat() without rate = %v, want 0", got)
+	}
+}
+
+func TestSetCategoryTaxRate(t *testing.T) {
+	db, mock := newMockDB(t)
+	rate := 10.0
+	mock.ExpectExec(`insert into Category_Tax_Rate`).WithArgs("dairy", rate).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`delete from Category_Tax_Rate where category = \$1`).WithArgs("dairy").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := db.SetCategoryTaxRate(" dairy ", types.TaxRateRequest{Rate: &rate}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetCategoryTaxRate("dairy", types.TaxRateRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := 100.0
+	if err := db.SetCategoryTaxRate("dairy", types.TaxRateRequest{Rate: &invalid}); !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("SetCategoryTaxRate(100) error = %v, want ValidationError", err)
+	}
+	if err := db.SetCategoryTaxRate(" ", types.TaxRateRequest{Rate: &rate}); !hasErrorType(err, &ValidationError{}) {
+		t.Errorf("SetCategoryTaxRate() without category error = %v, want ValidationError", err)
+	}
+}
+
+func TestSetProductTaxRateNotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`update Product set vat_rate = \$1 where id = \$2 returning id`).
+		WithArgs(sql.NullFloat64{}, int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if err := db.SetProductTaxRate(9, types.TaxRateRequest{}); !hasErrorType(err, &NotFoundError{}) {
+		t.Errorf("SetProductTaxRate() error = %v, want NotFoundError", err)
+	}
+}
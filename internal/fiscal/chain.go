@@ -0,0 +1,50 @@
+package fiscal
+
+import (
+	"crypto/sha256"
+	"db5/internal/types"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// GenesisHash предыдущий хеш для первого документа кассы
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// ChainHash подпись документа: sha256 от хеша предыдущего документа и тела документа.
+// Изменение или удаление любого документа ломает хеши всех последующих.
+func ChainHash(prevHash string, payload []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write([]byte{'\n'})
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ChainError первое нарушение цепочки
+type ChainError struct {
+	Number int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("document %d: %s", e.Number, e.Reason)
+}
+
+// VerifyChain проверяет документы одной кассы, упорядоченные по номеру, начиная с первого
+func VerifyChain(docs []types.FiscalDocumentResponse) error {
+	prevHash := GenesisHash
+	for i, doc := range docs {
+		if doc.Number != int64(i+1) {
+			return &ChainError{Number: int64(i + 1), Reason: fmt.Sprintf("missing, next document has number %d", doc.Number)}
+		}
+		if doc.PrevHash != prevHash {
+			return &ChainError{Number: doc.Number, Reason: "previous hash does not match"}
+		}
+		if ChainHash(doc.PrevHash, []byte(doc.Payload)) != doc.Hash {
+			return &ChainError{Number: doc.Number, Reason: "hash does not match payload"}
+		}
+		prevHash = doc.Hash
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package fiscal
+
+import (
+	"db5/internal/types"
+	"errors"
+	"testing"
+)
+
+// testChain цепочка из документов с телами payloads, подписанная как в базе
+func testChain(payloads ...string) []types.FiscalDocumentResponse {
+	docs := make([]types.FiscalDocumentResponse, len(payloads))
+	prevHash := GenesisHash
+	for i, payload := range payloads {
+		docs[i] = types.FiscalDocumentResponse{
+			Number:   int64(i + 1),
+			Payload:  payload,
+			PrevHash: prevHash,
+			Hash:     ChainHash(prevHash, []byte(payload)),
+		}
+		prevHash = docs[i].Hash
+	}
+	return docs
+}
+
+func TestChainHash(t *testing.T) {
+	hash := ChainHash(GenesisHash, []byte(`{"n":1}`))
+	if len(hash) != len(GenesisHash) {
+		t.Fatalf("hash length = %d, want %d", len(hash), len(GenesisHash))
+	}
+	if hash != ChainHash(GenesisHash, []byte(`{"n":1}`)) {
+		t.Error("hash is not deterministic")
+	}
+	if hash == ChainHash(GenesisHash, []byte(`{"n":2}`)) {
+		t.Error("hash does not depend on payload")
+	}
+	if hash == ChainHash(hash, []byte(`{"n":1}`)) {
+		t.Error("hash does not depend on the previous hash")
+	}
+	// Разделитель не дает перенести байты из хеша в тело документа
+	if ChainHash("ab", []byte("c")) == ChainHash("a", []byte("bc")) {
+		t.Error("hash ignores the boundary between previous hash and payload")
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		docs       func() []types.FiscalDocumentResponse
+		wantNumber int64
+	}{
+		{
+			name: "empty",
+			docs: func() []types.FiscalDocumentResponse { return nil },
+		},
+		{
+			name: "valid",
+			docs: func() []types.FiscalDocumentResponse { return testChain("a", "b", "c") },
+		},
+		{
+			name: "altered payload",
+			docs: func() []types.FiscalDocumentResponse {
+				docs := testChain("a", "b", "c")
+				docs[1].Payload = "B"
+				return docs
+			},
+			wantNumber: 2,
+		},
+		{
+			name: "re-signed document breaks the next one",
+			docs: func() []types.FiscalDocumentResponse {
+				docs := testChain("a", "b", "c")
+				docs[1].Payload = "B"
+				docs[1].Hash = ChainHash(docs[1].PrevHash, []byte("B"))
+				return docs
+			},
+			wantNumber: 3,
+		},
+		{
+			name: "missing document",
+			docs: func() []types.FiscalDocumentResponse {
+				docs := testChain("a", "b", "c")
+				return append(docs[:1], docs[2])
+			},
+			wantNumber: 2,
+		},
+		{
+			name: "chain does not start at genesis",
+			docs: func() []types.FiscalDocumentResponse {
+				docs := testChain("a")
+				docs[0].PrevHash = docs[0].Hash
+				return docs
+			},
+			wantNumber: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyChain(tt.docs())
+			if tt.wantNumber == 0 {
+				if err != nil {
+					t.Fatalf("VerifyChain(): %v", err)
+				}
+				return
+			}
+			var chainErr *ChainError
+			if !errors.As(err, &chainErr) {
+				t.Fatalf("VerifyChain() error = %v, want ChainError", err)
+			}
+			if chainErr.Number != tt.wantNumber {
+				t.Errorf("broken at %d, want %d: %v", chainErr.Number, tt.wantNumber, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package fiscal
+
+import (
+	"db5/config"
+	"db5/internal/types"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJSON = "json"
+	FormatXML  = "xml"
+)
+
+// Значения реквизитов ФФД
+const (
+	operationTypeIncome       = 1 // 1054: приход
+	operationTypeIncomeReturn = 2 // 1054: возврат прихода
+	paymentTypeFull           = 4 // 1214: полный расчет
+	productTypeGoods          = 1 // 1212: товар
+	dateTimeLayout            = "2006-01-02T15:04:05"
+)
+
+// Document кассовый чек в структуре ФФД. Имена полей как в выгрузках ОФД,
+// в комментариях номера тегов. Суммы в копейках.
+type Document struct {
+	XMLName              xml.Name `json:"-" xml:"receipt"`
+	FiscalDocumentNumber int64    `json:"fiscalDocumentNumber" xml:"fiscalDocumentNumber"` // 1040
+	DateTime             string   `json:"dateTime" xml:"dateTime"`                         // 1012
+	OperationType        int      `json:"operationType" xml:"operationType"`               // 1054
+	User                 string   `json:"user,omitempty" xml:"user,omitempty"`             // 1048
+	UserInn              string   `json:"userInn,omitempty" xml:"userInn,omitempty"`       // 1018
+	RetailPlaceAddress   string   `json:"retailPlaceAddress,omitempty" xml:"retailPlaceAddress,omitempty"`
+	KktRegID             string   `json:"kktRegId" xml:"kktRegId"`                               // 1037
+	ShiftNumber          int64    `json:"shiftNumber" xml:"shiftNumber"`                         // 1038
+	RequestNumber        int      `json:"requestNumber,omitempty" xml:"requestNumber,omitempty"` // 1042
+	Operator             string   `json:"operator" xml:"operator"`                               // 1021
+	Items                []Item   `json:"items" xml:"items>item"`                                // 1059
+	TotalSum             int64    `json:"totalSum" xml:"totalSum"`                               // 1020
+	CashTotalSum         int64    `json:"cashTotalSum" xml:"cashTotalSum"`                       // 1031
+	EcashTotalSum        int64    `json:"ecashTotalSum" xml:"ecashTotalSum"`                     // 1081
+	PrepaidSum           int64    `json:"prepaidSum" xml:"prepaidSum"`                           // 1215: подарочные сертификаты
+	ProvisionSum         int64    `json:"provisionSum" xml:"provisionSum"`                       // 1217: баллы лояльности
+	Nds20                int64    `json:"nds20,omitempty" xml:"nds20,omitempty"`
+	Nds10                int64    `json:"nds10,omitempty" xml:"nds10,omitempty"`
+	Nds7                 int64    `json:"nds7,omitempty" xml:"nds7,omitempty"`
+	Nds5                 int64    `json:"nds5,omitempty" xml:"nds5,omitempty"`
+	Nds0                 int64    `json:"nds0,omitempty" xml:"nds0,omitempty"`
+	NdsNo                int64    `json:"ndsNo,omitempty" xml:"ndsNo,omitempty"`
+}
+
+// Item предмет расчета (тег 1059)
+type Item struct {
+	Name        string `json:"name" xml:"name"`               // 1030
+	Price       int64  `json:"price" xml:"price"`             // 1079: цена с учетом скидок
+	Quantity    int    `json:"quantity" xml:"quantity"`       // 1023
+	Sum         int64  `json:"sum" xml:"sum"`                 // 1043
+	Nds         int    `json:"nds" xml:"nds"`                 // 1199
+	NdsSum      int64  `json:"ndsSum" xml:"ndsSum"`           // 1200
+	PaymentType int    `json:"paymentType" xml:"paymentType"` // 1214
+	ProductType int    `json:"productType" xml:"productType"` // 1212
+}
+
+// Header касса и смена, в которых проведен документ, и кассир
+type Header struct {
+	Register    string // 1037
+	ShiftNumber int64  // 1038: порядковый номер смены на этой кассе
+	Operator    string // 1021
+}
+
+// OperatorName ФИО кассира для тега 1021
+func OperatorName(lastName, firstName, middleName string) string {
+	return strings.Join(strings.Fields(strings.Join([]string{lastName, firstName, middleName}, " ")), " ")
+}
+
+// vatCode код ставки НДС по тегу 1199, nil — без НДС
+func vatCode(rate *float64) (int, error) {
+	if rate == nil {
+		return 6, nil
+	}
+	switch *rate {
+	case 20:
+		return 1, nil
+	case 10:
+		return 2, nil
+	case 0:
+		return 5, nil
+	case 5:
+		return 7, nil
+	case 7:
+		return 8, nil
+	}
+	return 0, fmt.Errorf("VAT rate %v%% has no FFD code", *rate)
+}
+
+func newDocument(store config.StoreConfig, header Header, number int64, operationType int, date time.Time) Document {
+	return Document{
+		FiscalDocumentNumber: number,
+		DateTime:             date.Format(dateTimeLayout),
+		OperationType:        operationType,
+		User:                 store.Name,
+		UserInn:              store.INN,
+		RetailPlaceAddress:   store.Address,
+		KktRegID:             header.Register,
+		ShiftNumber:          header.ShiftNumber,
+		Operator:             header.Operator,
+		Items:                []Item{},
+	}
+}
+
+// addItem добавляет предмет расчета и его НДС в итоги документа
+func (doc *Document) addItem(name string, quantity int, amount, vatAmount types.Money, rate *float64) error {
+	code, err := vatCode(rate)
+	if err != nil {
+		return err
+	}
+	price := amount
+	if quantity > 0 {
+		price = amount.MulDiv(1, int64(quantity))
+	}
+	doc.Items = append(doc.Items, Item{
+		Name:        name,
+		Price:       int64(price),
+		Quantity:    quantity,
+		Sum:         int64(amount),
+		Nds:         code,
+		NdsSum:      int64(vatAmount),
+		PaymentType: paymentTypeFull,
+		ProductType: productTypeGoods,
+	})
+
+	vat := int64(vatAmount)
+	switch code {
+	case 1:
+		doc.Nds20 += vat
+	case 2:
+		doc.Nds10 += vat
+	case 5:
+		doc.Nds0 += int64(amount)
+	case 6:
+		doc.NdsNo += int64(amount)
+	case 7:
+		doc.Nds5 += vat
+	case 8:
+		doc.Nds7 += vat
+	}
+	return nil
+}
+
+// addPayment относит сумму к виду оплаты документа
+func (doc *Document) addPayment(method string, amount types.Money) error {
+	switch method {
+	case types.PaymentMethodCash:
+		doc.CashTotalSum += int64(amount)
+	case types.PaymentMethodCard:
+		doc.EcashTotalSum += int64(amount)
+	case types.PaymentMethodGiftCertificate:
+		doc.PrepaidSum += int64(amount)
+	case types.PaymentMethodLoyaltyPoints:
+		doc.ProvisionSum += int64(amount)
+	default:
+		return fmt.Errorf("unknown payment method %q", method)
+	}
+	return nil
+}
+
+// Build фискальный документ продажи по чеку. number — порядковый номер документа в цепочке кассы.
+// Чек описывает продажу в момент пробития: возвраты и аннулирование выгружаются отдельными документами.
+func Build(receipt types.FullReceiptInfoResponse, store config.StoreConfig, header Header, number int64) (Document, error) {
+	return buildReceipt(receipt, store, header, number, operationTypeIncome, receipt.Date)
+}
+
+// BuildVoid возврат прихода на весь чек, аннулированный после выгрузки продажи.
+// Деньги возвращаются теми же способами, которыми чек оплачен.
+func BuildVoid(receipt types.FullReceiptInfoResponse, voidedAt time.Time, store config.StoreConfig, header Header, number int64) (Document, error) {
+	return buildReceipt(receipt, store, header, number, operationTypeIncomeReturn, voidedAt)
+}
+
+func buildReceipt(receipt types.FullReceiptInfoResponse, store config.StoreConfig, header Header, number int64, operationType int, date time.Time) (Document, error) {
+	doc := newDocument(store, header, number, operationType, date)
+	doc.RequestNumber = receipt.Number
+	doc.TotalSum = int64(receipt.Total)
+
+	for _, product := range receipt.Products {
+		if err := doc.addItem(product.Name, product.Quantity, product.Amount, product.VatAmount, product.VatRate); err != nil {
+			return Document{}, fmt.Errorf("Build: receipt %d: %v", receipt.ID, err)
+		}
+	}
+	for _, payment := range receipt.Payments {
+		if err := doc.addPayment(payment.Method, payment.Amount); err != nil {
+			return Document{}, fmt.Errorf("Build: receipt %d: %v", receipt.ID, err)
+		}
+	}
+	return doc, nil
+}
+
+// BuildReturn возврат прихода по документу возврата ret к чеку receipt. Суммы в возврате
+// отрицательные, в документ они попадают положительными, как того требует возврат прихода.
+func BuildReturn(receipt types.FullReceiptInfoResponse, ret types.ReceiptReturnResponse, store config.StoreConfig, header Header, number int64) (Document, error) {
+	doc := newDocument(store, header, number, operationTypeIncomeReturn, ret.Date)
+	doc.TotalSum = -int64(ret.Total)
+
+	rates := make(map[int64]*float64, len(receipt.Products))
+	for _, product := range receipt.Products {
+		rates[product.ID] = product.VatRate
+	}
+	for _, line := range ret.Products {
+		if err := doc.addItem(line.Name, int(line.Quantity), -line.Amount, -line.VatAmount, rates[line.ReceiptProductID]); err != nil {
+			return Document{}, fmt.Errorf("BuildReturn: return %d: %v", ret.ID, err)
+		}
+	}
+	if err := doc.addPayment(ret.PaymentMethod, -ret.Total); err != nil {
+		return Document{}, fmt.Errorf("BuildReturn: return %d: %v", ret.ID, err)
+	}
+	return doc, nil
+}
+
+// Encode документ в формате json или xml. Результат подписывается цепочкой хешей
+// и хранится как есть, поэтому повторное кодирование не нужно.
+func Encode(doc Document, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.Marshal(doc)
+	case FormatXML:
+		data, err := xml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), data...), nil
+	}
+	return nil, fmt.Errorf("unknown fiscal document format %q", format)
+}
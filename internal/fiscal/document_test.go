@@ -0,0 +1,152 @@
+package fiscal
+
+import (
+	"db5/config"
+	"db5/internal/types"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReceipt() types.FullReceiptInfoResponse {
+	vat20 := 20.0
+	return types.FullReceiptInfoResponse{
+		ID:     10,
+		Number: 3,
+		Date:   time.Date(2026, 3, 4, 12, 30, 0, 0, time.UTC),
+		Total:  36000,
+		Products: []types.ReceiptProductResponse{
+			{ID: 101, Name: "Сыр", Quantity: 2, Amount: 24000, VatRate: &vat20, VatAmount: 4000},
+			{ID: 102, Name: "Хлеб", Quantity: 3, Amount: 12000},
+		},
+		Payments: []types.PaymentResponse{
+			{Method: types.PaymentMethodCard, Amount: 20000},
+			{Method: types.PaymentMethodCash, Amount: 16000},
+		},
+	}
+}
+
+func TestBuildDocuments(t *testing.T) {
+	store := config.StoreConfig{Name: "Магазин", INN: "7700000000"}
+	header := Header{Register: "K2", ShiftNumber: 5, Operator: "Иванов Иван"}
+	receipt := testReceipt()
+	ret := types.ReceiptReturnResponse{
+		ID:            7,
+		PaymentMethod: types.PaymentMethodCash,
+		Date:          time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC),
+		Total:         -12000,
+		Products: []types.ReceiptReturnLineResponse{
+			{ReceiptProductID: 101, Name: "Сыр", Quantity: 1, Amount: -12000, VatAmount: -2000},
+		},
+	}
+	voidedAt := time.Date(2026, 3, 4, 13, 0, 0, 0, time.UTC)
+
+	build := func() (Document, error) { return Build(receipt, store, header, 1) }
+	buildVoid := func() (Document, error) { return BuildVoid(receipt, voidedAt, store, header, 2) }
+	buildReturn := func() (Document, error) { return BuildReturn(receipt, ret, store, header, 3) }
+
+	tests := []struct {
+		name          string
+		build         func() (Document, error)
+		operationType int
+		dateTime      string
+		total         int64
+		cash, ecash   int64
+		nds20, ndsNo  int64
+		items         int
+	}{
+		{name: "sale", build: build, operationType: 1, dateTime: "2026-03-04T12:30:00", total: 36000, cash: 16000, ecash: 20000, nds20: 4000, ndsNo: 12000, items: 2},
+		{name: "void", build: buildVoid, operationType: 2, dateTime: "2026-03-04T13:00:00", total: 36000, cash: 16000, ecash: 20000, nds20: 4000, ndsNo: 12000, items: 2},
+		{name: "return", build: buildReturn, operationType: 2, dateTime: "2026-03-05T09:00:00", total: 12000, cash: 12000, nds20: 2000, items: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := tt.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.OperationType != tt.operationType {
+				t.Errorf("operationType = %d, want %d", doc.OperationType, tt.operationType)
+			}
+			if doc.DateTime != tt.dateTime {
+				t.Errorf("dateTime = %s, want %s", doc.DateTime, tt.dateTime)
+			}
+			if doc.KktRegID != "K2" || doc.ShiftNumber != 5 || doc.Operator != "Иванов Иван" {
+				t.Errorf("header = %s/%d/%s, want K2/5/Иванов Иван", doc.KktRegID, doc.ShiftNumber, doc.Operator)
+			}
+			if doc.TotalSum != tt.total || doc.CashTotalSum != tt.cash || doc.EcashTotalSum != tt.ecash {
+				t.Errorf("sums = %d cash %d ecash %d, want %d cash %d ecash %d",
+					doc.TotalSum, doc.CashTotalSum, doc.EcashTotalSum, tt.total, tt.cash, tt.ecash)
+			}
+			if doc.Nds20 != tt.nds20 || doc.NdsNo != tt.ndsNo {
+				t.Errorf("nds20 = %d ndsNo = %d, want %d and %d", doc.Nds20, doc.NdsNo, tt.nds20, tt.ndsNo)
+			}
+			if len(doc.Items) != tt.items {
+				t.Fatalf("items = %d, want %d", len(doc.Items), tt.items)
+			}
+			for _, item := range doc.Items {
+				if item.Sum <= 0 || item.Price <= 0 {
+					t.Errorf("item %s has sum %d price %d, want positive", item.Name, item.Sum, item.Price)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildUnknownVatRate(t *testing.T) {
+	receipt := testReceipt()
+	rate := 18.0
+	receipt.Products[0].VatRate = &rate
+	if _, err := Build(receipt, config.StoreConfig{}, Header{}, 1); err == nil {
+		t.Error("Build() with VAT 18% succeeded, want error")
+	}
+}
+
+func TestOperatorName(t *testing.T) {
+	tests := []struct {
+		last, first, middle string
+		want                string
+	}{
+		{last: "Иванов", first: "Иван", middle: "Иванович", want: "Иванов Иван Иванович"},
+		{last: "Иванов", first: "Иван", middle: "", want: "Иванов Иван"},
+		{last: " Петрова ", first: "Анна", middle: " ", want: "Петрова Анна"},
+		{want: ""},
+	}
+	for _, tt := range tests {
+		if got := OperatorName(tt.last, tt.first, tt.middle); got != tt.want {
+			t.Errorf("OperatorName(%q, %q, %q) = %q, want %q", tt.last, tt.first, tt.middle, got, tt.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	doc, err := Build(testReceipt(), config.StoreConfig{}, Header{Register: "K2"}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Encode(doc, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Document
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.FiscalDocumentNumber != 7 || decoded.TotalSum != 36000 || len(decoded.Items) != 2 {
+		t.Errorf("decoded = %+v, want number 7, total 36000 and 2 items", decoded)
+	}
+
+	data, err = Encode(doc, FormatXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "<?xml") || !strings.Contains(string(data), "<fiscalDocumentNumber>7</fiscalDocumentNumber>") {
+		t.Errorf("xml = %s, want header and fiscalDocumentNumber 7", data)
+	}
+
+	if _, err := Encode(doc, "csv"); err == nil {
+		t.Error("Encode() with csv succeeded, want error")
+	}
+}
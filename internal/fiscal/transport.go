@@ -0,0 +1,63 @@
+package fiscal
+
+import (
+	"context"
+	"db5/internal/types"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Transport отправка фискальных документов оператору. Документы передаются по порядку,
+// при ошибке отправка повторяется, поэтому повторная передача того же документа должна быть безопасной.
+type Transport interface {
+	Send(ctx context.Context, doc types.FiscalDocumentResponse) error
+}
+
+// FileDropTransport складывает документы файлами в каталог, например для проверки выгрузки
+// или для внешней программы, которая сама передает их оператору
+type FileDropTransport struct {
+	Dir string
+}
+
+func NewFileDropTransport(dir string) (*FileDropTransport, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("NewFileDropTransport: %v", err)
+	}
+	return &FileDropTransport{Dir: dir}, nil
+}
+
+// Send пишет документ во временный файл и переименовывает его, чтобы читатель каталога
+// не увидел недописанный файл. Повторная отправка перезаписывает тот же файл.
+func (t *FileDropTransport) Send(ctx context.Context, doc types.FiscalDocumentResponse) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	register := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, doc.Register)
+	name := filepath.Join(t.Dir, fmt.Sprintf("%s-%010d.%s", register, doc.Number, doc.Format))
+
+	tmp, err := os.CreateTemp(t.Dir, ".fiscal-*")
+	if err != nil {
+		return fmt.Errorf("Send: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(doc.Payload); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Send: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Send: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("Send: %v", err)
+	}
+	return nil
+}
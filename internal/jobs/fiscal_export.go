@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"db5/internal/fiscal"
+	"db5/internal/types"
+	"log/slog"
+	"time"
+)
+
+// fiscalBatchSize сколько документов формируется и отправляется за один проход
+const fiscalBatchSize = 100
+
+// FiscalQueue очередь фискальных документов
+type FiscalQueue interface {
+	EnqueueFiscalDocuments(limit int) (int, error)
+	GetFiscalQueue(limit int) ([]types.FiscalDocumentResponse, error)
+	MarkFiscalDocumentSent(documentID int64) error
+	MarkFiscalDocumentFailed(documentID int64, sendErr string) error
+}
+
+// RunFiscalExport с периодом interval формирует документы по новым чекам и отправляет очередь.
+// Без transport документы только копятся в очереди. Работает до отмены контекста.
+func RunFiscalExport(ctx context.Context, queue FiscalQueue, transport fiscal.Transport, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		added, err := queue.EnqueueFiscalDocuments(fiscalBatchSize)
+		if err != nil {
+			slog.Error("fiscal documents enqueue failed", "error", err)
+		}
+		if added > 0 {
+			slog.Info("fiscal documents enqueued", "count", added)
+		}
+
+		if transport != nil {
+			sendFiscalDocuments(ctx, queue, transport)
+		}
+	}
+}
+
+// sendFiscalDocuments отправляет документы по порядку. На первой ошибке проход
+// останавливается, чтобы оператор не получил документы кассы с пропуском.
+func sendFiscalDocuments(ctx context.Context, queue FiscalQueue, transport fiscal.Transport) {
+	docs, err := queue.GetFiscalQueue(fiscalBatchSize)
+	if err != nil {
+		slog.Error("fiscal queue read failed", "error", err)
+		return
+	}
+
+	for _, doc := range docs {
+		if err := transport.Send(ctx, doc); err != nil {
+			slog.Error("fiscal document send failed", "register", doc.Register, "number", doc.Number, "error", err)
+			if err := queue.MarkFiscalDocumentFailed(doc.ID, err.Error()); err != nil {
+				slog.Error("fiscal document status update failed", "id", doc.ID, "error", err)
+			}
+			return
+		}
+		if err := queue.MarkFiscalDocumentSent(doc.ID); err != nil {
+			slog.Error("fiscal document status update failed", "id", doc.ID, "error", err)
+			return
+		}
+	}
+}
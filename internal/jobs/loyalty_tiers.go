@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// TierRecalculator пересчитывает уровни карт лояльности
+type TierRecalculator interface {
+	RecalculateLoyaltyTiers() (int, error)
+}
+
+// RunLoyaltyTierRecalculation раз в сутки в указанный час пересчитывает уровни карт.
+// Работает до отмены контекста.
+func RunLoyaltyTierRecalculation(ctx context.Context, store TierRecalculator, hour int) {
+	for {
+		timer := time.NewTimer(time.Until(nextRun(time.Now(), hour)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		changed, err := store.RecalculateLoyaltyTiers()
+		if err != nil {
+			slog.Error("loyalty tier recalculation failed", "error", err)
+			continue
+		}
+		slog.Info("loyalty tiers recalculated", "changed", changed)
+	}
+}
+
+// nextRun ближайший момент после now, когда часы показывают hour:00
+func nextRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	tests := []struct {
+		now  string
+		want string
+	}{
+		{now: "2026-03-14 01:30", want: "2026-03-14 03:00"},
+		{now: "2026-03-14 03:00", want: "2026-03-15 03:00"},
+		{now: "2026-03-14 23:59", want: "2026-03-15 03:00"},
+		{now: "2026-12-31 12:00", want: "2027-01-01 03:00"},
+	}
+	for _, tt := range tests {
+		now, err := time.Parse("2006-01-02 15:04", tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nextRun(now, 3).Format("2006-01-02 15:04"); got != tt.want {
+			t.Errorf("nextRun(%s, 3) = %s, want %s", tt.now, got, tt.want)
+		}
+	}
+}
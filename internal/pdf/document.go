@@ -0,0 +1,265 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+// fontUse шрифт в документе: имя ресурса и глифы, которые попали в текст
+type fontUse struct {
+	face     *fontFace
+	resource string
+	widths   map[sfnt.GlyphIndex]int
+	runes    map[sfnt.GlyphIndex]rune
+}
+
+// document PDF со встроенными шрифтами Type0 (Identity-H): текст пишется номерами глифов,
+// поэтому кириллица и любые другие символы шрифта выводятся без кодовых страниц
+type document struct {
+	regular *fontUse
+	bold    *fontUse
+	pages   []*bytes.Buffer
+	buf     sfnt.Buffer
+}
+
+func newDocument(f fonts) *document {
+	d := &document{
+		regular: &fontUse{face: f.regular, resource: "F1", widths: map[sfnt.GlyphIndex]int{}, runes: map[sfnt.GlyphIndex]rune{}},
+	}
+	d.bold = d.regular
+	if f.bold != f.regular {
+		d.bold = &fontUse{face: f.bold, resource: "F2", widths: map[sfnt.GlyphIndex]int{}, runes: map[sfnt.GlyphIndex]rune{}}
+	}
+	return d
+}
+
+func (d *document) font(bold bool) *fontUse {
+	if bold {
+		return d.bold
+	}
+	return d.regular
+}
+
+func (d *document) fontUses() []*fontUse {
+	if d.bold == d.regular {
+		return []*fontUse{d.regular}
+	}
+	return []*fontUse{d.regular, d.bold}
+}
+
+// glyphs номера глифов строки и ее ширина в тысячных долях кегля.
+// Символы, которых нет в шрифте, заменяются на "?".
+func (d *document) glyphs(use *fontUse, s string) ([]sfnt.GlyphIndex, int, error) {
+	var glyphs []sfnt.GlyphIndex
+	width := 0
+	for _, r := range s {
+		glyph, err := use.face.font.GlyphIndex(&d.buf, r)
+		if err != nil {
+			return nil, 0, err
+		}
+		if glyph == 0 && r != '?' {
+			r = '?'
+			if glyph, err = use.face.font.GlyphIndex(&d.buf, r); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		advance, ok := use.widths[glyph]
+		if !ok {
+			value, err := use.face.font.GlyphAdvance(&d.buf, glyph, use.face.unitsPerEm, font.HintingNone)
+			if err != nil {
+				return nil, 0, err
+			}
+			advance = use.face.scale(value)
+			use.widths[glyph] = advance
+			use.runes[glyph] = r
+		}
+		glyphs = append(glyphs, glyph)
+		width += advance
+	}
+	return glyphs, width, nil
+}
+
+// textWidth ширина строки в пунктах
+func (d *document) textWidth(s string, size float64, bold bool) float64 {
+	_, width, err := d.glyphs(d.font(bold), s)
+	if err != nil {
+		return 0
+	}
+	return float64(width) * size / 1000
+}
+
+func (d *document) addPage() *bytes.Buffer {
+	page := &bytes.Buffer{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// text выводит строку, x и y — начало базовой линии в пунктах от левого нижнего угла
+func (d *document) text(page *bytes.Buffer, x, y, size float64, bold bool, s string) error {
+	use := d.font(bold)
+	glyphs, _, err := d.glyphs(use, s)
+	if err != nil {
+		return err
+	}
+
+	var hex strings.Builder
+	for _, glyph := range glyphs {
+		fmt.Fprintf(&hex, "%04X", uint16(glyph))
+	}
+	fmt.Fprintf(page, "BT /%s %.2f Tf %.2f %.2f Td <%s> Tj ET\n", use.resource, size, x, y, hex.String())
+	return nil
+}
+
+func (d *document) line(page *bytes.Buffer, x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(page, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+// objectWriter пишет нумерованные объекты и запоминает их смещения для таблицы xref
+type objectWriter struct {
+	out     bytes.Buffer
+	offsets []int
+}
+
+// reserve номер объекта, который будет записан позже
+func (w *objectWriter) reserve() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+func (w *objectWriter) object(id int, body string) {
+	w.offsets[id-1] = w.out.Len()
+	fmt.Fprintf(&w.out, "%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// stream сжатый поток, extra — дополнительные ключи словаря
+func (w *objectWriter) stream(id int, data []byte, extra string) error {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	w.offsets[id-1] = w.out.Len()
+	fmt.Fprintf(&w.out, "%d 0 obj\n<< /Length %d /Filter /FlateDecode%s >>\nstream\n", id, compressed.Len(), extra)
+	w.out.Write(compressed.Bytes())
+	w.out.WriteString("\nendstream\nendobj\n")
+	return nil
+}
+
+// bytes собирает файл PDF 1.4 со всеми страницами
+func (d *document) bytes() ([]byte, error) {
+	w := &objectWriter{}
+	w.out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	catalog := w.reserve()
+	pages := w.reserve()
+
+	var fontResources strings.Builder
+	for _, use := range d.fontUses() {
+		if len(use.widths) == 0 {
+			continue
+		}
+		id, err := w.writeFont(use)
+		if err != nil {
+			return nil, fmt.Errorf("bytes: %v", err)
+		}
+		fmt.Fprintf(&fontResources, " /%s %d 0 R", use.resource, id)
+	}
+
+	var kids []string
+	for _, content := range d.pages {
+		page := w.reserve()
+		contentID := w.reserve()
+		if err := w.stream(contentID, content.Bytes(), ""); err != nil {
+			return nil, fmt.Errorf("bytes: %v", err)
+		}
+		w.object(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font <<%s >> >> /Contents %d 0 R >>",
+			pages, pageWidth, pageHeight, fontResources.String(), contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+
+	w.object(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	w.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+
+	xref := w.out.Len()
+	fmt.Fprintf(&w.out, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, offset := range w.offsets {
+		fmt.Fprintf(&w.out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&w.out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, catalog, xref)
+	return w.out.Bytes(), nil
+}
+
+// writeFont составной шрифт: Type0 -> CIDFontType2 -> FontDescriptor -> FontFile2, плюс ToUnicode для поиска и копирования текста
+func (w *objectWriter) writeFont(use *fontUse) (int, error) {
+	type0 := w.reserve()
+	cidFont := w.reserve()
+	descriptor := w.reserve()
+	fontFile := w.reserve()
+	toUnicode := w.reserve()
+
+	face := use.face
+	if err := w.stream(fontFile, face.data, fmt.Sprintf(" /Length1 %d", len(face.data))); err != nil {
+		return 0, err
+	}
+
+	w.object(descriptor, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		face.name, face.bbox[0], face.bbox[1], face.bbox[2], face.bbox[3], face.ascent, face.descent, face.capHeight, fontFile))
+
+	glyphs := make([]sfnt.GlyphIndex, 0, len(use.widths))
+	for glyph := range use.widths {
+		glyphs = append(glyphs, glyph)
+	}
+	slices.Sort(glyphs)
+
+	var widths strings.Builder
+	for _, glyph := range glyphs {
+		fmt.Fprintf(&widths, "%d [%d] ", glyph, use.widths[glyph])
+	}
+	w.object(cidFont, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>",
+		face.name, descriptor, widths.String()))
+
+	if err := w.stream(toUnicode, toUnicodeCMap(glyphs, use.runes), ""); err != nil {
+		return 0, err
+	}
+
+	w.object(type0, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		face.name, cidFont, toUnicode))
+	return type0, nil
+}
+
+func toUnicodeCMap(glyphs []sfnt.GlyphIndex, runes map[sfnt.GlyphIndex]rune) []byte {
+	var cmap bytes.Buffer
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	// В одном блоке bfchar допускается не больше 100 записей
+	for start := 0; start < len(glyphs); start += 100 {
+		chunk := glyphs[start:min(start+100, len(glyphs))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+		for _, glyph := range chunk {
+			fmt.Fprintf(&cmap, "<%04X> <", uint16(glyph))
+			for _, unit := range utf16.Encode([]rune{runes[glyph]}) {
+				fmt.Fprintf(&cmap, "%04X", unit)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return cmap.Bytes()
+}
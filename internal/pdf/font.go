@@ -0,0 +1,115 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// fontFace шрифт TrueType, который целиком встраивается в документ.
+// Метрики хранятся в тысячных долях кегля, как принято в PDF.
+type fontFace struct {
+	name       string
+	data       []byte
+	font       *sfnt.Font
+	unitsPerEm fixed.Int26_6
+	ascent     int
+	descent    int
+	capHeight  int
+	bbox       [4]int
+}
+
+// loadFontFace шрифт из файла path, без пути — встроенный шрифт Go с кириллицей
+func loadFontFace(path string, fallback []byte) (*fontFace, error) {
+	data := fallback
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("loadFontFace: %v", err)
+		}
+	}
+	return parseFontFace(data)
+}
+
+func parseFontFace(data []byte) (*fontFace, error) {
+	// В PDF встраивается как FontFile2, поэтому нужны контуры TrueType, а не CFF
+	if bytes.HasPrefix(data, []byte("OTTO")) {
+		return nil, errors.New("parseFontFace: only TrueType outlines are supported")
+	}
+
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parseFontFace: %v", err)
+	}
+
+	var buf sfnt.Buffer
+	face := &fontFace{data: data, font: parsed, unitsPerEm: fixed.I(int(parsed.UnitsPerEm()))}
+
+	name, err := parsed.Name(&buf, sfnt.NameIDPostScript)
+	if err != nil || name == "" {
+		name = "EmbeddedFont"
+	}
+	face.name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune("()<>[]{}/%#", r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	metrics, err := parsed.Metrics(&buf, face.unitsPerEm, font.HintingNone)
+	if err != nil {
+		return nil, fmt.Errorf("parseFontFace: %v", err)
+	}
+	face.ascent = face.scale(metrics.Ascent)
+	face.descent = -face.scale(metrics.Descent)
+	face.capHeight = face.scale(metrics.CapHeight)
+	if face.capHeight == 0 {
+		face.capHeight = face.ascent
+	}
+
+	bounds, err := parsed.Bounds(&buf, face.unitsPerEm, font.HintingNone)
+	if err != nil {
+		return nil, fmt.Errorf("parseFontFace: %v", err)
+	}
+	// В sfnt ось Y направлена вниз, в PDF — вверх
+	face.bbox = [4]int{face.scale(bounds.Min.X), -face.scale(bounds.Max.Y), face.scale(bounds.Max.X), -face.scale(bounds.Min.Y)}
+	return face, nil
+}
+
+// scale значение в единицах шрифта в тысячные доли кегля
+func (f *fontFace) scale(value fixed.Int26_6) int {
+	return int(int64(value) * 1000 / int64(f.unitsPerEm))
+}
+
+// fonts обычное и полужирное начертание документа
+type fonts struct {
+	regular *fontFace
+	bold    *fontFace
+}
+
+// loadFonts без путей берутся встроенные Go Regular и Go Bold.
+// Если задан только обычный шрифт, он же используется вместо полужирного.
+func loadFonts(regularPath, boldPath string) (fonts, error) {
+	regular, err := loadFontFace(regularPath, goregular.TTF)
+	if err != nil {
+		return fonts{}, err
+	}
+
+	bold := regular
+	if boldPath != "" || regularPath == "" {
+		bold, err = loadFontFace(boldPath, gobold.TTF)
+		if err != nil {
+			return fonts{}, err
+		}
+	}
+	return fonts{regular: regular, bold: bold}, nil
+}
@@ -0,0 +1,186 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Страница A4 в пунктах
+const (
+	pageWidth    = 595.28
+	pageHeight   = 841.89
+	margin       = 40.0
+	contentWidth = pageWidth - 2*margin
+	lineSpacing  = 1.3
+	cellPadding  = 3.0
+)
+
+const (
+	alignLeft = iota
+	alignRight
+)
+
+type column struct {
+	title string
+	width float64
+	align int
+}
+
+// layout выводит текст сверху вниз и сам переходит на новую страницу.
+// Ошибки вывода запоминаются и возвращаются из finish.
+type layout struct {
+	doc  *document
+	page *bytes.Buffer
+	y    float64
+	err  error
+}
+
+func newLayout(doc *document) *layout {
+	l := &layout{doc: doc}
+	l.newPage()
+	return l
+}
+
+func (l *layout) newPage() {
+	l.page = l.doc.addPage()
+	l.y = pageHeight - margin
+}
+
+// ensure начинает новую страницу, если высота height не помещается на текущей
+func (l *layout) ensure(height float64) bool {
+	if l.y-height < margin {
+		l.newPage()
+		return true
+	}
+	return false
+}
+
+func (l *layout) space(height float64) {
+	l.y -= height
+}
+
+func (l *layout) text(x, y, size float64, bold bool, s string) {
+	if l.err != nil {
+		return
+	}
+	l.err = l.doc.text(l.page, x, y, size, bold, s)
+}
+
+// paragraph абзац на всю ширину с переносом по словам
+func (l *layout) paragraph(s string, size float64, bold bool) {
+	for _, line := range l.wrap(s, contentWidth, size, bold) {
+		l.ensure(size * lineSpacing)
+		l.text(margin, l.y-size, size, bold, line)
+		l.y -= size * lineSpacing
+	}
+}
+
+// pair подпись и значение, прижатые к правому краю, для итогов под таблицей
+func (l *layout) pair(label, value string, size float64, bold bool) {
+	l.ensure(size * lineSpacing)
+	right := pageWidth - margin
+	valueX := right - l.doc.textWidth(value, size, bold)
+	labelX := right - 100 - l.doc.textWidth(label, size, bold)
+	l.text(labelX, l.y-size, size, bold, label)
+	l.text(valueX, l.y-size, size, bold, value)
+	l.y -= size * lineSpacing
+}
+
+func (l *layout) rule() {
+	l.ensure(6)
+	l.y -= 3
+	l.doc.line(l.page, margin, l.y, pageWidth-margin, l.y, 0.5)
+	l.y -= 3
+}
+
+// table таблица с переносом текста в ячейках. Шапка повторяется на каждой новой странице.
+func (l *layout) table(columns []column, rows [][]string, size float64) {
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.title
+	}
+
+	l.ensure(2 * (size*lineSpacing + 2*cellPadding))
+	l.tableRow(columns, header, size, true)
+	for _, row := range rows {
+		if l.ensure(l.rowHeight(columns, row, size, false)) {
+			l.tableRow(columns, header, size, true)
+		}
+		l.tableRow(columns, row, size, false)
+	}
+}
+
+func (l *layout) rowHeight(columns []column, row []string, size float64, bold bool) float64 {
+	lines := 1
+	for i, col := range columns {
+		lines = max(lines, len(l.wrap(row[i], col.width-2*cellPadding, size, bold)))
+	}
+	return float64(lines)*size*lineSpacing + 2*cellPadding
+}
+
+func (l *layout) tableRow(columns []column, row []string, size float64, bold bool) {
+	height := l.rowHeight(columns, row, size, bold)
+	if bold {
+		l.doc.line(l.page, margin, l.y, pageWidth-margin, l.y, 0.8)
+	}
+
+	x := margin
+	for i, col := range columns {
+		y := l.y - cellPadding
+		for _, line := range l.wrap(row[i], col.width-2*cellPadding, size, bold) {
+			lineX := x + cellPadding
+			if col.align == alignRight {
+				lineX = x + col.width - cellPadding - l.doc.textWidth(line, size, bold)
+			}
+			l.text(lineX, y-size, size, bold, line)
+			y -= size * lineSpacing
+		}
+		x += col.width
+	}
+
+	l.y -= height
+	width := 0.3
+	if bold {
+		width = 0.8
+	}
+	l.doc.line(l.page, margin, l.y, pageWidth-margin, l.y, width)
+}
+
+// wrap разбивает текст на строки не шире width, слишком длинные слова режутся по символам
+func (l *layout) wrap(s string, width, size float64, bold bool) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if l.doc.textWidth(candidate, size, bold) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+
+		line = ""
+		for _, r := range word {
+			if line != "" && l.doc.textWidth(line+string(r), size, bold) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (l *layout) finish() ([]byte, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.doc.bytes()
+}
@@ -0,0 +1,60 @@
+package pdf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLayoutWrap(t *testing.T) {
+	f, err := loadFonts("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLayout(newDocument(f))
+	const size = 10.0
+	width := func(s string) float64 { return l.doc.textWidth(s, size, false) }
+
+	tests := []struct {
+		name  string
+		s     string
+		width float64
+		want  []string
+	}{
+		{name: "empty", s: "", width: 100, want: []string{""}},
+		{name: "fits", s: "Сыр российский", width: width("Сыр российский"), want: []string{"Сыр российский"}},
+		{name: "spaces collapse", s: "  Сыр   российский ", width: width("Сыр российский"), want: []string{"Сыр российский"}},
+		{name: "breaks between words", s: "Сыр российский весовой", width: width("Сыр российский"), want: []string{"Сыр российский", "весовой"}},
+		{name: "one word per line", s: "Сыр российский весовой", width: width("российский"), want: []string{"Сыр", "российский", "весовой"}},
+		{name: "long word is cut by runes", s: "Абрикос", width: width("Абри"), want: []string{"Абри", "кос"}},
+		{name: "narrower than a rune", s: "Ab", width: 1, want: []string{"A", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := l.wrap(tt.s, tt.width, size, false)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrap(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutWrapKeepsLinesWithinWidth(t *testing.T) {
+	f, err := loadFonts("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLayout(newDocument(f))
+	text := "Поставка молочной продукции по договору № 17/2026 от 4 марта, включая сыры твердых сортов"
+	for _, width := range []float64{40, 80, 150, 300} {
+		lines := l.wrap(text, width, 9, true)
+		for _, line := range lines {
+			if w := l.doc.textWidth(line, 9, true); w > width {
+				t.Errorf("width %v: line %q is %v wide", width, line, w)
+			}
+		}
+		if got := strings.Join(strings.Fields(strings.Join(lines, "")), ""); got != strings.Join(strings.Fields(text), "") {
+			t.Errorf("width %v: text changed to %q", width, strings.Join(lines, "|"))
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package pdf
+
+import (
+	"db5/config"
+	"db5/internal/types"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Generator строит PDF чеков и заказов поставщику с реквизитами компании из настроек
+type Generator struct {
+	fonts        fonts
+	company      config.StoreConfig
+	baseCurrency string
+}
+
+func NewGenerator(company config.StoreConfig, pdfConfig config.PDFConfig, baseCurrency string) (*Generator, error) {
+	f, err := loadFonts(pdfConfig.FontPath, pdfConfig.BoldFontPath)
+	if err != nil {
+		return nil, fmt.Errorf("NewGenerator: %v", err)
+	}
+	return &Generator{fonts: f, company: company, baseCurrency: baseCurrency}, nil
+}
+
+// companyHeader название и реквизиты компании, пустые реквизиты пропускаются
+func (g *Generator) companyHeader(l *layout) {
+	c := g.company
+	if c.Name != "" {
+		l.paragraph(c.Name, 13, true)
+	}
+
+	var ids []string
+	for _, field := range []struct{ label, value string }{{"ИНН", c.INN}, {"КПП", c.KPP}, {"ОГРН", c.OGRN}} {
+		if field.value != "" {
+			ids = append(ids, field.label+" "+field.value)
+		}
+	}
+	if len(ids) > 0 {
+		l.paragraph(strings.Join(ids, ", "), 9, false)
+	}
+	if c.Address != "" {
+		l.paragraph("Адрес: "+c.Address, 9, false)
+	}
+	if c.Phone != "" {
+		l.paragraph("Телефон: "+c.Phone, 9, false)
+	}
+	if c.BankAccount != "" {
+		bank := "Р/с " + c.BankAccount
+		if c.BankName != "" {
+			bank += " в " + c.BankName
+		}
+		if c.BankBIK != "" {
+			bank += ", БИК " + c.BankBIK
+		}
+		if c.CorrAccount != "" {
+			bank += ", к/с " + c.CorrAccount
+		}
+		l.paragraph(bank, 9, false)
+	}
+	l.rule()
+	l.space(6)
+}
+
+func tellerName(receipt types.FullReceiptInfoResponse) string {
+	return strings.Join(strings.Fields(strings.Join([]string{receipt.TellerLastName, receipt.TellerFirstName, receipt.TellerMiddleName}, " ")), " ")
+}
+
+// Receipt чек на листе A4: строки, НДС, оплаты и возвраты
+func (g *Generator) Receipt(receipt types.FullReceiptInfoResponse) ([]byte, error) {
+	l := newLayout(newDocument(g.fonts))
+	g.companyHeader(l)
+
+	title := fmt.Sprintf("Кассовый чек № %s", receipt.PrintedNumber)
+	if receipt.PrintedNumber == "" {
+		title = fmt.Sprintf("Кассовый чек № %d", receipt.ID)
+	}
+	l.paragraph(title, 14, true)
+	l.paragraph("Дата: "+receipt.Date.Format("02.01.2006 15:04"), 10, false)
+	l.paragraph("Кассир: "+tellerName(receipt), 10, false)
+	if receipt.Register != "" {
+		l.paragraph(fmt.Sprintf("Касса: %s, смена %d", receipt.Register, receipt.ShiftID), 10, false)
+	}
+	if receipt.LoyaltyCardNumber != 0 {
+		l.paragraph(fmt.Sprintf("Карта покупателя: %d", receipt.LoyaltyCardNumber), 10, false)
+	}
+	if receipt.Status == types.ReceiptStatusVoided {
+		l.paragraph("Чек аннулирован: "+receipt.VoidReason, 10, true)
+	}
+	l.space(8)
+
+	columns := []column{
+		{title: "№", width: 25, align: alignRight},
+		{title: "Наименование", width: 200},
+		{title: "Кол-во", width: 45, align: alignRight},
+		{title: "Цена", width: 60, align: alignRight},
+		{title: "Скидка", width: 55, align: alignRight},
+		{title: "НДС", width: 45, align: alignRight},
+		{title: "Сумма", width: contentWidth - 430, align: alignRight},
+	}
+	rows := make([][]string, 0, len(receipt.Products))
+	for i, product := range receipt.Products {
+		vat := "без НДС"
+		if product.VatRate != nil {
+			vat = strconv.FormatFloat(*product.VatRate, 'f', -1, 64) + "%"
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1),
+			product.Name,
+			strconv.Itoa(product.Quantity),
+			product.Price.String(),
+			product.Discount.String(),
+			vat,
+			product.Amount.String(),
+		})
+	}
+	l.table(columns, rows, 9)
+	l.space(6)
+
+	l.pair("Итого:", receipt.Total.String(), 11, true)
+	for _, tax := range receipt.Taxes {
+		l.pair(fmt.Sprintf("в т.ч. НДС %s%%:", strconv.FormatFloat(tax.Rate, 'f', -1, 64)), tax.Tax.String(), 9, false)
+	}
+	for _, payment := range receipt.Payments {
+		l.pair(types.PaymentMethodName(payment.Method)+":", payment.Amount.String(), 9, false)
+		if payment.Change != 0 {
+			l.pair("Сдача:", payment.Change.String(), 9, false)
+		}
+	}
+	if len(receipt.Returns) > 0 {
+		l.space(4)
+		for _, receiptReturn := range receipt.Returns {
+			l.pair(fmt.Sprintf("Возврат от %s:", receiptReturn.Date.Format("02.01.2006")), receiptReturn.Total.String(), 9, false)
+		}
+		l.pair("Итого с возвратами:", receipt.NetTotal.String(), 11, true)
+	}
+
+	data, err := l.finish()
+	if err != nil {
+		return nil, fmt.Errorf("Receipt: %v", err)
+	}
+	return data, nil
+}
+
+// SupplierOrder заказ поставщику. Для заказа в иностранной валюте добавляются курс и суммы в базовой валюте.
+func (g *Generator) SupplierOrder(order types.FullSupplierOrderInfoResponse) ([]byte, error) {
+	l := newLayout(newDocument(g.fonts))
+	g.companyHeader(l)
+
+	l.paragraph(fmt.Sprintf("Заказ поставщику № %d от %s", order.ID, order.OrderDate.Format("02.01.2006")), 14, true)
+	l.paragraph("Поставщик: "+order.SupplierName, 10, false)
+	l.paragraph("Статус: "+order.Status, 10, false)
+	if !order.DateOfReceipt.IsZero() {
+		l.paragraph("Принят: "+order.DateOfReceipt.Format("02.01.2006"), 10, false)
+	}
+
+	foreign := order.Currency != "" && order.Currency != g.baseCurrency
+	if foreign {
+		l.paragraph(fmt.Sprintf("Валюта: %s, курс %s %s", order.Currency, strconv.FormatFloat(order.ExchangeRate, 'f', -1, 64), g.baseCurrency), 10, false)
+	}
+	l.space(8)
+
+	columns := []column{
+		{title: "№", width: 25, align: alignRight},
+		{title: "Товар", width: 215},
+		{title: "Кол-во", width: 50, align: alignRight},
+		{title: "Принято", width: 55, align: alignRight},
+		{title: "Цена", width: 70, align: alignRight},
+		{title: "Сумма", width: contentWidth - 415, align: alignRight},
+	}
+	if foreign {
+		columns[1].width -= 70
+		columns = append(columns, column{title: "Сумма, " + g.baseCurrency, width: 70, align: alignRight})
+	}
+
+	var total types.Money
+	rows := make([][]string, 0, len(order.SupplierOrderItems))
+	for i, item := range order.SupplierOrderItems {
+		row := []string{
+			strconv.Itoa(i + 1),
+			item.ProductName,
+			strconv.Itoa(item.Quantity),
+			strconv.Itoa(item.ReceivedQuantity),
+			item.Price.String(),
+			item.Amount.String(),
+		}
+		if foreign {
+			row = append(row, item.BaseAmount.String())
+		}
+		rows = append(rows, row)
+		total += item.Amount
+	}
+	l.table(columns, rows, 9)
+	l.space(6)
+
+	currency := order.Currency
+	if currency == "" {
+		currency = g.baseCurrency
+	}
+	l.pair(fmt.Sprintf("Итого, %s:", currency), total.String(), 11, true)
+	if foreign {
+		l.pair(fmt.Sprintf("Итого, %s:", g.baseCurrency), order.BaseTotal.String(), 11, true)
+	}
+
+	data, err := l.finish()
+	if err != nil {
+		return nil, fmt.Errorf("SupplierOrder: %v", err)
+	}
+	return data, nil
+}
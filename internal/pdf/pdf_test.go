@@ -0,0 +1,86 @@
+package pdf
+
+import (
+	"bytes"
+	"db5/config"
+	"db5/internal/types"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var pageCount = regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`)
+
+// checkPDF проверяет структуру файла и возвращает число страниц
+func checkPDF(t *testing.T, data []byte) int {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF file: %q...", data[:min(len(data), 16)])
+	}
+	if !bytes.Contains(data, []byte("/FontFile2")) || !bytes.Contains(data, []byte("/ToUnicode")) {
+		t.Errorf("fonts are not embedded")
+	}
+	match := pageCount.FindSubmatch(data)
+	if match == nil {
+		t.Fatal("no page tree")
+	}
+	pages, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pages
+}
+
+func TestGeneratorReceipt(t *testing.T) {
+	g, err := NewGenerator(config.StoreConfig{Name: "Продукты", INN: "7700000000"}, config.PDFConfig{}, "RUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := g.Receipt(types.FullReceiptInfoResponse{
+		ID:            5,
+		Status:        types.ReceiptStatusActive,
+		PrintedNumber: "1-20260314-0005",
+		Date:          time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC),
+		Total:         26970,
+		Products:      []types.ReceiptProductResponse{{Name: "Молоко", Quantity: 3, Price: 8990, Amount: 26970}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages := checkPDF(t, data); pages != 1 {
+		t.Errorf("receipt has %d pages, want 1", pages)
+	}
+}
+
+func TestGeneratorSupplierOrderPages(t *testing.T) {
+	g, err := NewGenerator(config.StoreConfig{Name: "Продукты"}, config.PDFConfig{}, "RUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := types.FullSupplierOrderInfoResponse{
+		ID:           7,
+		OrderDate:    time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC),
+		SupplierName: "Молочная ферма",
+		Status:       types.SupplierOrderStatusConfirmed,
+		Currency:     "USD",
+		ExchangeRate: 92.5,
+	}
+	for i := range 120 {
+		order.SupplierOrderItems = append(order.SupplierOrderItems, types.SupplierOrderItemResponse{
+			ProductName: fmt.Sprintf("Сыр российский весовой, партия %d", i+1),
+			Quantity:    10,
+			Price:       1099,
+			Amount:      10990,
+			BaseAmount:  1016575,
+		})
+	}
+	data, err := g.SupplierOrder(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages := checkPDF(t, data); pages < 2 {
+		t.Errorf("long order has %d pages, want it split across pages", pages)
+	}
+}
@@ -0,0 +1,43 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Команды ESC/POS, общие для Epson-совместимых принтеров
+var (
+	escposInit        = []byte{0x1b, 0x40}
+	escposCodePage866 = []byte{0x1b, 0x74, 17}
+	escposFeed        = []byte{0x1b, 0x64, 4}
+	escposPartialCut  = []byte{0x1d, 0x56, 0x42, 0}
+)
+
+// ESCPOS текстовый чек командами ESC/POS в кодировке CP866: инициализация,
+// выбор кодовой страницы, текст, прогон ленты и отрезка.
+// Символы, которых нет в CP866, заменяются на "?".
+func (r *Renderer) ESCPOS(receipt Receipt, paperWidth int) ([]byte, error) {
+	text, err := r.Text(receipt, paperWidth)
+	if err != nil {
+		return nil, fmt.Errorf("ESCPOS: %v", err)
+	}
+
+	encoded, err := encoding.ReplaceUnsupported(charmap.CodePage866.NewEncoder()).Bytes(text)
+	if err != nil {
+		return nil, fmt.Errorf("ESCPOS: %v", err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(escposInit)
+	buf.Write(escposCodePage866)
+	buf.Write(bytes.ReplaceAll(encoded, []byte("\r\n"), []byte("\n")))
+	if !bytes.HasSuffix(encoded, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	buf.Write(escposFeed)
+	buf.Write(escposPartialCut)
+	return buf.Bytes(), nil
+}
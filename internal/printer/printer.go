@@ -0,0 +1,210 @@
+package printer
+
+import (
+	"bytes"
+	"db5/config"
+	"db5/internal/types"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"unicode/utf8"
+)
+
+const (
+	FormatText   = "text"
+	FormatHTML   = "html"
+	FormatESCPOS = "escpos"
+)
+
+const (
+	textTemplateName = "receipt.txt.tmpl"
+	htmlTemplateName = "receipt.html.tmpl"
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// Receipt данные для печати чека
+type Receipt struct {
+	Store   config.StoreConfig
+	Receipt types.FullReceiptInfoResponse
+	Loyalty *Loyalty
+	Footer  string
+	// Width символов в строке, задается рендерером по ширине ленты
+	Width int
+}
+
+// Loyalty карта покупателя и остаток баллов после покупки
+type Loyalty struct {
+	Number  int64
+	Balance int64
+}
+
+// Renderer печатает чеки по шаблонам. Шаблоны из TemplateDir заменяют встроенные.
+type Renderer struct {
+	store  config.StoreConfig
+	config config.PrinterConfig
+	text   *texttemplate.Template
+	html   *htmltemplate.Template
+}
+
+func NewRenderer(store config.StoreConfig, printerConfig config.PrinterConfig) (*Renderer, error) {
+	textSource, err := loadTemplate(printerConfig.TemplateDir, textTemplateName)
+	if err != nil {
+		return nil, fmt.Errorf("NewRenderer: %v", err)
+	}
+	text, err := texttemplate.New(textTemplateName).Funcs(textFuncs(charsPerLine(printerConfig.PaperWidth))).Parse(textSource)
+	if err != nil {
+		return nil, fmt.Errorf("NewRenderer: %v", err)
+	}
+
+	htmlSource, err := loadTemplate(printerConfig.TemplateDir, htmlTemplateName)
+	if err != nil {
+		return nil, fmt.Errorf("NewRenderer: %v", err)
+	}
+	html, err := htmltemplate.New(htmlTemplateName).Funcs(htmltemplate.FuncMap(commonFuncs())).Parse(htmlSource)
+	if err != nil {
+		return nil, fmt.Errorf("NewRenderer: %v", err)
+	}
+
+	return &Renderer{store: store, config: printerConfig, text: text, html: html}, nil
+}
+
+// loadTemplate шаблон из каталога пользователя, если он там есть, иначе встроенный
+func loadTemplate(dir, name string) (string, error) {
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	data, err := defaultTemplates.ReadFile("templates/" + name)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// PaperWidth ширина ленты по умолчанию
+func (r *Renderer) PaperWidth() int {
+	return r.config.PaperWidth
+}
+
+// NewReceipt данные чека с реквизитами магазина и подвалом из настроек
+func (r *Renderer) NewReceipt(receipt types.FullReceiptInfoResponse, loyalty *Loyalty) Receipt {
+	return Receipt{Store: r.store, Receipt: receipt, Loyalty: loyalty, Footer: r.config.Footer}
+}
+
+// Text чек моноширинным текстом для ленты paperWidth мм
+func (r *Renderer) Text(receipt Receipt, paperWidth int) ([]byte, error) {
+	width := charsPerLine(paperWidth)
+	if width == 0 {
+		return nil, fmt.Errorf("unsupported paper width %d", paperWidth)
+	}
+	receipt.Width = width
+
+	text, err := r.text.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("Text: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := text.Funcs(textFuncs(width)).Execute(&buf, receipt); err != nil {
+		return nil, fmt.Errorf("Text: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// HTML чек для печати из браузера
+func (r *Renderer) HTML(receipt Receipt) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.html.Execute(&buf, receipt); err != nil {
+		return nil, fmt.Errorf("HTML: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// charsPerLine символов шрифта A в строке: 384 точки на ленте 58 мм, 576 на 80 мм
+func charsPerLine(paperWidth int) int {
+	switch paperWidth {
+	case 58:
+		return 32
+	case 80:
+		return 48
+	}
+	return 0
+}
+
+func commonFuncs() map[string]any {
+	return map[string]any{
+		"money":   func(m types.Money) string { return m.String() },
+		"rate":    func(rate float64) string { return strconv.FormatFloat(rate, 'f', -1, 64) },
+		"payment": types.PaymentMethodName,
+		"teller": func(receipt types.FullReceiptInfoResponse) string {
+			return strings.Join(strings.Fields(strings.Join([]string{receipt.TellerLastName, receipt.TellerFirstName, receipt.TellerMiddleName}, " ")), " ")
+		},
+	}
+}
+
+// textFuncs функции текстового шаблона для строки шириной width символов
+func textFuncs(width int) texttemplate.FuncMap {
+	funcs := texttemplate.FuncMap(commonFuncs())
+	funcs["wrap"] = func(s string) string { return strings.Join(wrap(s, width), "\n") }
+	funcs["center"] = func(s string) string { return center(s, width) }
+	funcs["row"] = func(left, right string) string { return row(left, right, width) }
+	funcs["rule"] = func() string { return strings.Repeat("-", width) }
+	return funcs
+}
+
+// wrap разбивает текст на строки не длиннее width, слишком длинные слова режутся
+func wrap(s string, width int) []string {
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(s) {
+		runes := []rune(word)
+		if len(line) > 0 && len(line)+1+len(runes) > width {
+			lines = append(lines, string(line))
+			line = nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, runes...)
+		for len(line) > width {
+			lines = append(lines, string(line[:width]))
+			line = line[width:]
+		}
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func center(s string, width int) string {
+	lines := wrap(s, width)
+	for i, line := range lines {
+		lines[i] = strings.Repeat(" ", (width-utf8.RuneCountInString(line))/2) + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// row левый текст и значение, прижатое вправо. Если не помещаются в строку, значение переносится.
+func row(left, right string, width int) string {
+	leftLen, rightLen := utf8.RuneCountInString(left), utf8.RuneCountInString(right)
+	if leftLen+1+rightLen <= width {
+		return left + strings.Repeat(" ", width-leftLen-rightLen) + right
+	}
+	padding := max(width-rightLen, 0)
+	return strings.Join(wrap(left, width), "\n") + "\n" + strings.Repeat(" ", padding) + right
+}
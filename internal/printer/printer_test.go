@@ -0,0 +1,147 @@
+package printer
+
+import (
+	"bytes"
+	"db5/config"
+	"db5/internal/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		width int
+		want  []string
+	}{
+		{name: "fits", s: "Молоко 3,2%", width: 32, want: []string{"Молоко 3,2%"}},
+		{name: "empty", s: "", width: 10, want: []string{""}},
+		{name: "spaces collapse", s: "  хлеб   белый ", width: 32, want: []string{"хлеб белый"}},
+		{name: "breaks between words", s: "Сыр российский весовой", width: 10, want: []string{"Сыр", "российский", "весовой"}},
+		{name: "word exactly width", s: "abcde fgh", width: 5, want: []string{"abcde", "fgh"}},
+		{name: "long word is cut", s: "Абрикосовый", width: 4, want: []string{"Абри", "косо", "вый"}},
+		{name: "cut continues the line", s: "ab cdefgh", width: 4, want: []string{"ab", "cdef", "gh"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrap(tt.s, tt.width); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrap(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRow(t *testing.T) {
+	tests := []struct {
+		left, right string
+		width       int
+		want        string
+	}{
+		{left: "ИТОГ", right: "150.00", width: 16, want: "ИТОГ      150.00"},
+		{left: "Наличные", right: "1000.00", width: 16, want: "Наличные 1000.00"},
+		{left: "Очень длинное название", right: "10.00", width: 16, want: "Очень длинное\nназвание\n           10.00"},
+	}
+	for _, tt := range tests {
+		if got := row(tt.left, tt.right, tt.width); got != tt.want {
+			t.Errorf("row(%q, %q, %d) = %q, want %q", tt.left, tt.right, tt.width, got, tt.want)
+		}
+	}
+}
+
+func testReceipt() types.FullReceiptInfoResponse {
+	return types.FullReceiptInfoResponse{
+		ID:             5,
+		Status:         types.ReceiptStatusActive,
+		TellerLastName: "Иванова",
+		PrintedNumber:  "1-20260314-0005",
+		Date:           time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC),
+		Total:          26970,
+		Products:       []types.ReceiptProductResponse{{Name: "Молоко", Quantity: 3, Price: 8990, Amount: 26970}},
+		Payments:       []types.PaymentResponse{{Method: types.PaymentMethodCash, Amount: 26970, Tendered: 30000, Change: 3030}},
+	}
+}
+
+func TestRendererText(t *testing.T) {
+	r, err := NewRenderer(config.StoreConfig{Name: "Продукты"}, config.PrinterConfig{PaperWidth: 58, Footer: "Спасибо!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := r.Text(r.NewReceipt(testReceipt(), &Loyalty{Number: 2000000000015, Balance: 120}), 58)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"            Продукты",
+		"Кассовый чек     1-20260314-0005",
+		"  3 x 89.90               269.70",
+		"ИТОГО                     269.70",
+		"  Сдача                    30.30",
+		"Баллов на карте              120",
+		"            Спасибо!",
+	} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("text receipt has no line %q:\n%s", want, text)
+		}
+	}
+	for _, line := range strings.Split(string(text), "\n") {
+		if n := len([]rune(line)); n > 32 {
+			t.Errorf("line %q is %d characters, want at most 32", line, n)
+		}
+	}
+
+	if _, err := r.Text(r.NewReceipt(testReceipt(), nil), 70); err == nil {
+		t.Error("Text() on 70 mm paper, want error")
+	}
+}
+
+func TestRendererESCPOS(t *testing.T) {
+	r, err := NewRenderer(config.StoreConfig{}, config.PrinterConfig{PaperWidth: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := r.ESCPOS(r.NewReceipt(testReceipt(), nil), 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, append(escposInit, escposCodePage866...)) {
+		t.Errorf("ESC/POS starts with % x, want init and code page", data[:5])
+	}
+	if !bytes.HasSuffix(data, append(escposFeed, escposPartialCut...)) {
+		t.Errorf("ESC/POS does not end with feed and cut")
+	}
+	// "ИТОГО" в CP866
+	if !bytes.Contains(data, []byte{0x88, 0x92, 0x8e, 0x83, 0x8e}) {
+		t.Errorf("ESC/POS text is not in CP866")
+	}
+}
+
+func TestRendererTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, textTemplateName), []byte("{{.Store.Name}}|{{.Width}}|{{money .Receipt.Total}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRenderer(config.StoreConfig{Name: "Продукты"}, config.PrinterConfig{TemplateDir: dir, PaperWidth: 58})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := r.Text(r.NewReceipt(testReceipt(), nil), 58)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "Продукты|32|269.70" {
+		t.Errorf("custom template = %q", text)
+	}
+
+	html, err := r.HTML(r.NewReceipt(testReceipt(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(html, []byte("Молоко")) {
+		t.Errorf("built-in HTML template is not used when the directory has no HTML template")
+	}
+}
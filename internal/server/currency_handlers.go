@@ -0,0 +1,73 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/types"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+func CreateExchangeRateHandler(store db.Store) *ExchangeRateHandler {
+	return &ExchangeRateHandler{
+		store: store,
+	}
+}
+
+type ExchangeRateHandler struct {
+	store db.Store
+}
+
+func (e *ExchangeRateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		e.GetExchangeRates(w, r)
+	case "PUT":
+		e.PutExchangeRate(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetExchangeRates параметр currency ограничивает историю одной валютой
+func (e *ExchangeRateHandler) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := e.store.GetExchangeRates(r.URL.Query().Get("currency"))
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(rates)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (e *ExchangeRateHandler) PutExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var rateInfo types.ExchangeRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&rateInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	rate, err := e.store.SetExchangeRate(rateInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(rate)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
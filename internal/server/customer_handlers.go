@@ -0,0 +1,313 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/types"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreateCustomerHandler(store db.Store) *CustomerHandler {
+	return &CustomerHandler{
+		store: store,
+	}
+}
+
+type CustomerHandler struct {
+	store db.Store
+}
+
+func (c *CustomerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		c.GetCustomers(w, r)
+	case "POST":
+		c.PostCustomer(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetCustomers поиск покупателей по ?phone=
+func (c *CustomerHandler) GetCustomers(w http.ResponseWriter, r *http.Request) {
+	customers, err := c.store.FindCustomersByPhone(r.URL.Query().Get("phone"))
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(customers)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *CustomerHandler) PostCustomer(w http.ResponseWriter, r *http.Request) {
+	var customerInfo types.CustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&customerInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	customer, err := c.store.CreateCustomer(customerInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(customer)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateCustomerItemHandler(store db.Store) *CustomerItemHandler {
+	return &CustomerItemHandler{
+		store: store,
+	}
+}
+
+type CustomerItemHandler struct {
+	store db.Store
+}
+
+func (c *CustomerItemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		c.GetCustomer(w, r)
+	case "PUT":
+		c.PutCustomer(w, r)
+	case "DELETE":
+		c.DeleteCustomer(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (c *CustomerItemHandler) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	customerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid customer id")
+		return
+	}
+
+	customer, err := c.store.GetCustomer(customerID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(customer)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *CustomerItemHandler) PutCustomer(w http.ResponseWriter, r *http.Request) {
+	customerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid customer id")
+		return
+	}
+
+	var customerInfo types.CustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&customerInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	customer, err := c.store.UpdateCustomer(customerID, customerInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(customer)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *CustomerItemHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
+	customerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid customer id")
+		return
+	}
+
+	if err := c.store.DeleteCustomer(customerID); err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func CreateCustomerCardHandler(store db.Store) *CustomerCardHandler {
+	return &CustomerCardHandler{
+		store: store,
+	}
+}
+
+type CustomerCardHandler struct {
+	store db.Store
+}
+
+func (c *CustomerCardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST", "DELETE":
+		c.ChangeCustomerCard(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// ChangeCustomerCard POST привязывает карту к покупателю, DELETE отвязывает
+func (c *CustomerCardHandler) ChangeCustomerCard(w http.ResponseWriter, r *http.Request) {
+	customerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid customer id")
+		return
+	}
+	number, err := strconv.ParseInt(r.PathValue("number"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid card number")
+		return
+	}
+
+	var customer types.CustomerResponse
+	if r.Method == "DELETE" {
+		customer, err = c.store.DetachLoyaltyCard(customerID, number)
+	} else {
+		customer, err = c.store.AttachLoyaltyCard(customerID, number)
+	}
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(customer)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateCustomerMergeHandler(store db.Store) *CustomerMergeHandler {
+	return &CustomerMergeHandler{
+		store: store,
+	}
+}
+
+type CustomerMergeHandler struct {
+	store db.Store
+}
+
+func (c *CustomerMergeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		c.PostCustomerMerge(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (c *CustomerMergeHandler) PostCustomerMerge(w http.ResponseWriter, r *http.Request) {
+	customerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid customer id")
+		return
+	}
+
+	var mergeInfo types.CustomerMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&mergeInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	customer, err := c.store.MergeCustomers(customerID, mergeInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(customer)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateCustomerReceiptsHandler(store db.Store) *CustomerReceiptsHandler {
+	return &CustomerReceiptsHandler{
+		store: store,
+	}
+}
+
+type CustomerReceiptsHandler struct {
+	store db.Store
+}
+
+func (c *CustomerReceiptsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		c.GetCustomerReceipts(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (c *CustomerReceiptsHandler) GetCustomerReceipts(w http.ResponseWriter, r *http.Request) {
+	customerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid customer id")
+		return
+	}
+
+	filter := types.ReceiptFilter{Status: r.URL.Query().Get("status")}
+	receipts, err := c.store.GetCustomerReceipts(customerID, filter)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(receipts)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
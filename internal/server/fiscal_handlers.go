@@ -0,0 +1,128 @@
+package server
+
+import (
+	"db5/internal/db"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreateFiscalDocumentHandler(store db.Store) *FiscalDocumentHandler {
+	return &FiscalDocumentHandler{
+		store: store,
+	}
+}
+
+type FiscalDocumentHandler struct {
+	store db.Store
+}
+
+func (f *FiscalDocumentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		f.GetFiscalDocuments(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetFiscalDocuments status: queued, sent или failed, без параметра — все документы
+func (f *FiscalDocumentHandler) GetFiscalDocuments(w http.ResponseWriter, r *http.Request) {
+	docs, err := f.store.GetFiscalDocuments(r.URL.Query().Get("status"))
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(docs)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateReceiptFiscalHandler(store db.Store) *ReceiptFiscalHandler {
+	return &ReceiptFiscalHandler{
+		store: store,
+	}
+}
+
+type ReceiptFiscalHandler struct {
+	store db.Store
+}
+
+func (rf *ReceiptFiscalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		rf.GetReceiptFiscalDocuments(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (rf *ReceiptFiscalHandler) GetReceiptFiscalDocuments(w http.ResponseWriter, r *http.Request) {
+	receiptID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid receipt id")
+		return
+	}
+
+	docs, err := rf.store.GetReceiptFiscalDocuments(receiptID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(docs)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateFiscalVerifyHandler(store db.Store) *FiscalVerifyHandler {
+	return &FiscalVerifyHandler{
+		store: store,
+	}
+}
+
+type FiscalVerifyHandler struct {
+	store db.Store
+}
+
+func (f *FiscalVerifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		f.VerifyFiscalChain(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// VerifyFiscalChain register — касса, по умолчанию касса из настроек
+func (f *FiscalVerifyHandler) VerifyFiscalChain(w http.ResponseWriter, r *http.Request) {
+	result, err := f.store.VerifyFiscalChain(r.URL.Query().Get("register"))
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
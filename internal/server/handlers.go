@@ -4,9 +4,13 @@ import (
 	"db5/internal/db"
 	"db5/internal/types"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 func CreateProductInfoHandler(store db.Store) *ProductInfoHandler {
@@ -99,7 +103,7 @@ func (e *EmployeeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		e.GetEmployee(w, r)
 	case "POST":
-		e.PostEmployee(w, r)
+		idempotent(e.store, "POST /employee", e.PostEmployee)(w, r)
 	case "DELETE":
 		e.DeleteEmployee(w, r)
 	default:
@@ -213,17 +217,18 @@ func (rh *ReceiptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		rh.GetReceipt(w, r)
 	case "POST":
-		rh.PostReceipt(w, r)
+		idempotent(rh.store, "POST /receipt", rh.PostReceipt)(w, r)
 	default:
 		NotFoundHandler(w, r)
 	}
 }
 
 func (rh *ReceiptHandler) GetReceipt(w http.ResponseWriter, r *http.Request) {
-	receipt, err := rh.store.GetFullReceiptInfo()
+	filter := types.ReceiptFilter{Status: r.URL.Query().Get("status"), Number: r.URL.Query().Get("number")}
+
+	receipt, err := rh.store.GetFullReceiptInfo(filter)
 	if err != nil {
-		InternalServerErrorHandler(w, r)
-		slog.Error(err.Error())
+		StoreErrorHandler(w, r, err)
 		return
 	}
 
@@ -242,18 +247,25 @@ func (rh *ReceiptHandler) PostReceipt(w http.ResponseWriter, r *http.Request) {
 	var receipt types.ReceiptInfoRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
-		InternalServerErrorHandler(w, r)
-		slog.Error(err.Error())
+		BadRequestHandler(w, r, err.Error())
 		return
 	}
 
-	if err := rh.store.CreateNewReceipt(receipt); err != nil {
+	result, err := rh.store.CreateNewReceipt(receipt)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
 		InternalServerErrorHandler(w, r)
 		slog.Error(err.Error())
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
 }
 
 func CreateDepartmentInfoHandler(store db.Store) *DepartmentInfoHandler {
@@ -393,17 +405,21 @@ func (o *OrderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		o.GetOrderInfo(w, r)
 	case "POST":
-		o.PostOrderInfo(w, r)
+		idempotent(o.store, "POST /order", o.PostOrderInfo)(w, r)
 	default:
 		NotFoundHandler(w, r)
 	}
 }
 
 func (o *OrderHandler) GetOrderInfo(w http.ResponseWriter, r *http.Request) {
-	order, err := o.store.GetFullSupplierOrderInfo()
+	var statuses []string
+	if status := r.URL.Query().Get("status"); status != "" {
+		statuses = strings.Split(status, ",")
+	}
+
+	order, err := o.store.GetFullSupplierOrderInfo(statuses)
 	if err != nil {
-		InternalServerErrorHandler(w, r)
-		slog.Error(err.Error())
+		StoreErrorHandler(w, r, err)
 		return
 	}
 
@@ -428,6 +444,245 @@ func (o *OrderHandler) PostOrderInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err := o.store.CreateNewSupplierOrder(orderInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func CreateOrderReceiveHandler(store db.Store) *OrderReceiveHandler {
+	return &OrderReceiveHandler{
+		store: store,
+	}
+}
+
+type OrderReceiveHandler struct {
+	store db.Store
+}
+
+func (o *OrderReceiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		o.PostOrderReceive(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (o *OrderReceiveHandler) PostOrderReceive(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid order id")
+		return
+	}
+
+	var receiveInfo types.SupplierOrderReceiveRequest
+	// пустое тело означает приемку всего заказа
+	if err := json.NewDecoder(r.Body).Decode(&receiveInfo); err != nil && !errors.Is(err, io.EOF) {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	order, err := o.store.ReceiveSupplierOrder(orderID, receiveInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(order)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateOrderStatusHandler(store db.Store) *OrderStatusHandler {
+	return &OrderStatusHandler{
+		store: store,
+	}
+}
+
+type OrderStatusHandler struct {
+	store db.Store
+}
+
+func (o *OrderStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		o.PostOrderStatus(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (o *OrderStatusHandler) PostOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid order id")
+		return
+	}
+
+	var statusInfo types.SupplierOrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&statusInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	order, err := o.store.ChangeSupplierOrderStatus(orderID, statusInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(order)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateReceiptReturnHandler(store db.Store) *ReceiptReturnHandler {
+	return &ReceiptReturnHandler{
+		store: store,
+	}
+}
+
+type ReceiptReturnHandler struct {
+	store db.Store
+}
+
+func (rr *ReceiptReturnHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		rr.PostReceiptReturn(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (rr *ReceiptReturnHandler) PostReceiptReturn(w http.ResponseWriter, r *http.Request) {
+	receiptID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid receipt id")
+		return
+	}
+
+	var returnInfo types.ReceiptReturnRequest
+	if err := json.NewDecoder(r.Body).Decode(&returnInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	receiptReturn, err := rr.store.CreateReceiptReturn(receiptID, returnInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(receiptReturn)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateReceiptVoidHandler(store db.Store) *ReceiptVoidHandler {
+	return &ReceiptVoidHandler{
+		store: store,
+	}
+}
+
+type ReceiptVoidHandler struct {
+	store db.Store
+}
+
+func (rv *ReceiptVoidHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		rv.PostReceiptVoid(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (rv *ReceiptVoidHandler) PostReceiptVoid(w http.ResponseWriter, r *http.Request) {
+	receiptID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid receipt id")
+		return
+	}
+
+	var voidInfo types.ReceiptVoidRequest
+	if err := json.NewDecoder(r.Body).Decode(&voidInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	receipt, err := rv.store.VoidReceipt(receiptID, voidInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(receipt)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateReceiptPreviewHandler(store db.Store) *ReceiptPreviewHandler {
+	return &ReceiptPreviewHandler{
+		store: store,
+	}
+}
+
+type ReceiptPreviewHandler struct {
+	store db.Store
+}
+
+func (rh *ReceiptPreviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		rh.PostReceiptPreview(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// PostReceiptPreview возвращает будущий чек без проведения: итоги, скидки, оплаты и баллы
+func (rh *ReceiptPreviewHandler) PostReceiptPreview(w http.ResponseWriter, r *http.Request) {
+	var receipt types.ReceiptInfoRequest
+	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	preview, err := rh.store.PreviewReceipt(receipt)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(preview)
 	if err != nil {
 		InternalServerErrorHandler(w, r)
 		slog.Error(err.Error())
@@ -435,4 +690,94 @@ func (o *OrderHandler) PostOrderInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// maxReceiptBatchSize сколько чеков касса может выгрузить одним запросом
+const maxReceiptBatchSize = 500
+
+func CreateReceiptBatchHandler(store db.Store) *ReceiptBatchHandler {
+	return &ReceiptBatchHandler{
+		store: store,
+	}
+}
+
+type ReceiptBatchHandler struct {
+	store db.Store
+}
+
+func (rb *ReceiptBatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		rb.PostReceiptBatch(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// PostReceiptBatch проводит чеки, накопленные кассой без связи, и возвращает результат по каждому.
+// Ошибка одного чека не останавливает остальные. Пакет можно отправлять повторно целиком.
+func (rb *ReceiptBatchHandler) PostReceiptBatch(w http.ResponseWriter, r *http.Request) {
+	var batch types.ReceiptBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+	if len(batch.Receipts) == 0 {
+		BadRequestHandler(w, r, "batch has no receipts")
+		return
+	}
+	if len(batch.Receipts) > maxReceiptBatchSize {
+		BadRequestHandler(w, r, fmt.Sprintf("batch has more than %d receipts", maxReceiptBatchSize))
+		return
+	}
+
+	response := types.ReceiptBatchResponse{Results: make([]types.ReceiptBatchItemResponse, 0, len(batch.Receipts))}
+	for _, receipt := range batch.Receipts {
+		result := types.ReceiptBatchItemResponse{ClientUUID: receipt.ClientUUID, Status: types.BatchItemStatusSuccess}
+		created, duplicate, err := rb.store.CreateOfflineReceipt(receipt)
+		if err != nil {
+			result.Status, result.Error, result.Details = batchItemError(err)
+		} else {
+			result.Duplicate = duplicate
+			result.Receipt = &created
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// batchItemError разбирает ошибку чека из пакета так же, как StoreErrorHandler:
+// расхождения с состоянием базы — conflict, остальное — error. Внутренние ошибки только в лог.
+func batchItemError(err error) (string, string, any) {
+	var validationErr *db.ValidationError
+	var priceErr *db.PriceMismatchError
+	var stockErr *db.InsufficientStockError
+	var notFoundErr *db.NotFoundError
+	var conflictErr *db.ConflictError
+
+	switch {
+	case errors.As(err, &validationErr):
+		return types.BatchItemStatusError, validationErr.Error(), nil
+	case errors.As(err, &priceErr):
+		return types.BatchItemStatusConflict, priceErr.Error(), priceErr.Items
+	case errors.As(err, &stockErr):
+		return types.BatchItemStatusConflict, stockErr.Error(), stockErr.Items
+	case errors.As(err, &notFoundErr):
+		return types.BatchItemStatusError, notFoundErr.Error(), nil
+	case errors.As(err, &conflictErr):
+		return types.BatchItemStatusConflict, conflictErr.Error(), nil
+	default:
+		slog.Error(err.Error())
+		return types.BatchItemStatusError, "internal error", nil
+	}
 }
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"db5/internal/db"
+	"db5/internal/types"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+)
+
+// idempotencyRecorder пропускает ответ клиенту и запоминает его для сохранения с ключом
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(data)
+	return rec.ResponseWriter.Write(data)
+}
+
+// idempotent выполняет next один раз на заголовок Idempotency-Key в пределах scope.
+// Повтор с тем же ключом и телом получает сохраненный ответ с заголовком Idempotent-Replayed.
+// Сохраняются и ответы 5xx, ключ не освобождается: повторить операцию можно только с новым ключом.
+// Ошибки ключа, все 409:
+//   - тот же ключ с другим телом;
+//   - первый запрос еще выполняется — повторить позже с тем же ключом;
+//   - первый запрос не сохранил ответ за минуту (процесс упал) — результат неизвестен,
+//     клиент проверяет, проведена ли операция, и при необходимости повторяет с новым ключом.
+//
+// Без заголовка запрос выполняется как обычно.
+func idempotent(store db.Store, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			BadRequestHandler(w, r, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			BadRequestHandler(w, r, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		stored, err := store.BeginIdempotentRequest(scope, key, hex.EncodeToString(hash[:]))
+		if err != nil {
+			StoreErrorHandler(w, r, err)
+			return
+		}
+		if stored != nil {
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			w.Header().Set(idempotencyReplayedHeader, "true")
+			w.WriteHeader(stored.StatusCode)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// 5xx тоже сохраняется: обработчик мог закоммитить изменения до ошибки,
+		// и повтор с тем же ключом провел бы операцию второй раз
+		response := types.StoredResponse{StatusCode: rec.status, ContentType: rec.Header().Get("Content-Type"), Body: rec.body.Bytes()}
+		if err := store.CompleteIdempotentRequest(scope, key, response); err != nil {
+			// Ключ остается без ответа: неизвестно, выполнена ли операция, после срока аренды повтор получит 409
+			slog.Error(err.Error())
+		}
+	}
+}
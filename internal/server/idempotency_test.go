@@ -0,0 +1,117 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// idempotencyStore хранилище ключей в памяти, остальные методы Store не используются
+type idempotencyStore struct {
+	db.Store
+	hashes    map[string]string
+	responses map[string]types.StoredResponse
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{hashes: map[string]string{}, responses: map[string]types.StoredResponse{}}
+}
+
+func (s *idempotencyStore) BeginIdempotentRequest(scope, key, requestHash string) (*types.StoredResponse, error) {
+	id := scope + "/" + key
+	hash, ok := s.hashes[id]
+	if !ok {
+		s.hashes[id] = requestHash
+		return nil, nil
+	}
+	if hash != requestHash {
+		return nil, &db.ConflictError{Message: "different request body"}
+	}
+	response, ok := s.responses[id]
+	if !ok {
+		return nil, &db.ConflictError{Message: "in progress"}
+	}
+	return &response, nil
+}
+
+func (s *idempotencyStore) CompleteIdempotentRequest(scope, key string, response types.StoredResponse) error {
+	s.responses[scope+"/"+key] = response
+	return nil
+}
+
+func TestIdempotent(t *testing.T) {
+	store := newIdempotencyStore()
+	calls := 0
+	status := http.StatusCreated
+	handler := idempotent(store, "receipt", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	})
+	send := func(key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/receipt", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(idempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := send("k1", `{"n":1}`)
+	if w.Code != http.StatusCreated || w.Body.String() != `{"n":1}` || calls != 1 {
+		t.Fatalf("first request = %d %s after %d calls, want 201 with the body after 1 call", w.Code, w.Body, calls)
+	}
+
+	w = send("k1", `{"n":1}`)
+	if w.Code != http.StatusCreated || w.Body.String() != `{"n":1}` || calls != 1 {
+		t.Errorf("replay = %d %s after %d calls, want stored 201 without a call", w.Code, w.Body, calls)
+	}
+	if w.Header().Get(idempotencyReplayedHeader) != "true" || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("replay headers = %v, want replayed json", w.Header())
+	}
+
+	if w = send("k1", `{"n":2}`); w.Code != http.StatusConflict || calls != 1 {
+		t.Errorf("different body = %d after %d calls, want 409 without a call", w.Code, calls)
+	}
+
+	send("", `{"n":1}`)
+	send("", `{"n":1}`)
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3: requests without a key are always executed", calls)
+	}
+
+	if w = send(strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("long key = %d, want 400", w.Code)
+	}
+}
+
+func TestIdempotentStoresServerError(t *testing.T) {
+	store := newIdempotencyStore()
+	calls := 0
+	handler := idempotent(store, "receipt", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	send := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/receipt", strings.NewReader(`{}`))
+		r.Header.Set(idempotencyKeyHeader, "k1")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	// Обработчик мог закоммитить изменения до ошибки, поэтому повтор не выполняет его снова
+	if code := send(); code != http.StatusInternalServerError {
+		t.Fatalf("first request = %d, want 500", code)
+	}
+	if code := send(); code != http.StatusInternalServerError || calls != 1 {
+		t.Errorf("retry after 500 = %d after %d calls, want stored 500 after 1 call", code, calls)
+	}
+}
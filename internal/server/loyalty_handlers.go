@@ -0,0 +1,178 @@
+package server
+
+import (
+	"db5/internal/db"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreateLoyaltyCardIssueHandler(store db.Store) *LoyaltyCardIssueHandler {
+	return &LoyaltyCardIssueHandler{
+		store: store,
+	}
+}
+
+type LoyaltyCardIssueHandler struct {
+	store db.Store
+}
+
+func (l *LoyaltyCardIssueHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		l.PostLoyaltyCard(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (l *LoyaltyCardIssueHandler) PostLoyaltyCard(w http.ResponseWriter, r *http.Request) {
+	card, err := l.store.IssueLoyaltyCard()
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(card)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateLoyaltyCardHandler(store db.Store) *LoyaltyCardHandler {
+	return &LoyaltyCardHandler{
+		store: store,
+	}
+}
+
+type LoyaltyCardHandler struct {
+	store db.Store
+}
+
+func (l *LoyaltyCardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		l.GetLoyaltyCard(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (l *LoyaltyCardHandler) GetLoyaltyCard(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.ParseInt(r.PathValue("number"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid card number")
+		return
+	}
+
+	card, err := l.store.GetLoyaltyCard(number)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(card)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// CreateLoyaltyCardBlockHandler blocked определяет, блокирует обработчик карту или разблокирует
+func CreateLoyaltyCardBlockHandler(store db.Store, blocked bool) *LoyaltyCardBlockHandler {
+	return &LoyaltyCardBlockHandler{
+		store:   store,
+		blocked: blocked,
+	}
+}
+
+type LoyaltyCardBlockHandler struct {
+	store   db.Store
+	blocked bool
+}
+
+func (l *LoyaltyCardBlockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		l.PostLoyaltyCardBlock(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (l *LoyaltyCardBlockHandler) PostLoyaltyCardBlock(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.ParseInt(r.PathValue("number"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid card number")
+		return
+	}
+
+	card, err := l.store.SetLoyaltyCardBlocked(number, l.blocked)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(card)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateLoyaltyBalanceHandler(store db.Store) *LoyaltyBalanceHandler {
+	return &LoyaltyBalanceHandler{
+		store: store,
+	}
+}
+
+type LoyaltyBalanceHandler struct {
+	store db.Store
+}
+
+func (l *LoyaltyBalanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		l.GetLoyaltyBalance(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (l *LoyaltyBalanceHandler) GetLoyaltyBalance(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.ParseInt(r.PathValue("number"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid card number")
+		return
+	}
+
+	balance, err := l.store.GetLoyaltyBalance(number)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(balance)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
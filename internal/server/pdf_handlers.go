@@ -0,0 +1,116 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/pdf"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// pdfDocumentID номер документа из пути вида "{id}.pdf"
+func pdfDocumentID(r *http.Request) (int64, bool) {
+	id, ok := strings.CutSuffix(r.PathValue("file"), ".pdf")
+	if !ok {
+		return 0, false
+	}
+	documentID, err := strconv.ParseInt(id, 10, 64)
+	return documentID, err == nil
+}
+
+func writePDF(w http.ResponseWriter, name string, data []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func CreateReceiptPDFHandler(store db.Store, generator *pdf.Generator) *ReceiptPDFHandler {
+	return &ReceiptPDFHandler{
+		store:     store,
+		generator: generator,
+	}
+}
+
+type ReceiptPDFHandler struct {
+	store     db.Store
+	generator *pdf.Generator
+}
+
+func (rp *ReceiptPDFHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		rp.GetReceiptPDF(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (rp *ReceiptPDFHandler) GetReceiptPDF(w http.ResponseWriter, r *http.Request) {
+	receiptID, ok := pdfDocumentID(r)
+	if !ok {
+		NotFoundHandler(w, r)
+		return
+	}
+
+	receipt, err := rp.store.GetReceipt(receiptID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	data, err := rp.generator.Receipt(receipt)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	writePDF(w, fmt.Sprintf("receipt-%d.pdf", receiptID), data)
+}
+
+func CreateOrderPDFHandler(store db.Store, generator *pdf.Generator) *OrderPDFHandler {
+	return &OrderPDFHandler{
+		store:     store,
+		generator: generator,
+	}
+}
+
+type OrderPDFHandler struct {
+	store     db.Store
+	generator *pdf.Generator
+}
+
+func (op *OrderPDFHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		op.GetOrderPDF(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (op *OrderPDFHandler) GetOrderPDF(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := pdfDocumentID(r)
+	if !ok {
+		NotFoundHandler(w, r)
+		return
+	}
+
+	order, err := op.store.GetSupplierOrder(orderID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	data, err := op.generator.SupplierOrder(order)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	writePDF(w, fmt.Sprintf("order-%d.pdf", orderID), data)
+}
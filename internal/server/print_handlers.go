@@ -0,0 +1,97 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/printer"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreateReceiptPrintHandler(store db.Store, renderer *printer.Renderer) *ReceiptPrintHandler {
+	return &ReceiptPrintHandler{
+		store:    store,
+		renderer: renderer,
+	}
+}
+
+type ReceiptPrintHandler struct {
+	store    db.Store
+	renderer *printer.Renderer
+}
+
+func (rp *ReceiptPrintHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		rp.GetReceiptPrint(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetReceiptPrint format: text (по умолчанию), html или escpos; paper: 58 или 80 мм, по умолчанию из настроек
+func (rp *ReceiptPrintHandler) GetReceiptPrint(w http.ResponseWriter, r *http.Request) {
+	receiptID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid receipt id")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = printer.FormatText
+	}
+	if format != printer.FormatText && format != printer.FormatHTML && format != printer.FormatESCPOS {
+		BadRequestHandler(w, r, "format must be text, html or escpos")
+		return
+	}
+
+	paperWidth := rp.renderer.PaperWidth()
+	if strPaper := r.URL.Query().Get("paper"); strPaper != "" {
+		paperWidth, err = strconv.Atoi(strPaper)
+		if err != nil || paperWidth != 58 && paperWidth != 80 {
+			BadRequestHandler(w, r, "paper must be 58 or 80")
+			return
+		}
+	}
+
+	receipt, err := rp.store.GetReceipt(receiptID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	var loyalty *printer.Loyalty
+	if receipt.LoyaltyCardNumber != 0 {
+		balance, err := rp.store.GetLoyaltyBalance(receipt.LoyaltyCardNumber)
+		if err != nil {
+			StoreErrorHandler(w, r, err)
+			return
+		}
+		loyalty = &printer.Loyalty{Number: balance.Number, Balance: balance.Balance}
+	}
+
+	data := rp.renderer.NewReceipt(receipt, loyalty)
+	var output []byte
+	var contentType string
+	switch format {
+	case printer.FormatHTML:
+		output, err = rp.renderer.HTML(data)
+		contentType = "text/html; charset=utf-8"
+	case printer.FormatESCPOS:
+		output, err = rp.renderer.ESCPOS(data, paperWidth)
+		contentType = "application/octet-stream"
+	default:
+		output, err = rp.renderer.Text(data, paperWidth)
+		contentType = "text/plain; charset=utf-8"
+	}
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(output)
+}
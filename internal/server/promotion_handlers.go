@@ -0,0 +1,128 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/types"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreatePromotionHandler(store db.Store) *PromotionHandler {
+	return &PromotionHandler{
+		store: store,
+	}
+}
+
+type PromotionHandler struct {
+	store db.Store
+}
+
+func (p *PromotionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		p.GetPromotions(w, r)
+	case "POST":
+		p.PostPromotion(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetPromotions ?active=true оставляет только действующие акции
+func (p *PromotionHandler) GetPromotions(w http.ResponseWriter, r *http.Request) {
+	var activeOnly bool
+	if value := r.URL.Query().Get("active"); value != "" {
+		var err error
+		activeOnly, err = strconv.ParseBool(value)
+		if err != nil {
+			BadRequestHandler(w, r, "invalid active flag")
+			return
+		}
+	}
+
+	promotions, err := p.store.GetPromotions(activeOnly)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(promotions)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (p *PromotionHandler) PostPromotion(w http.ResponseWriter, r *http.Request) {
+	var promotionInfo types.PromotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&promotionInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	promotion, err := p.store.CreatePromotion(promotionInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(promotion)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreatePromotionItemHandler(store db.Store) *PromotionItemHandler {
+	return &PromotionItemHandler{
+		store: store,
+	}
+}
+
+type PromotionItemHandler struct {
+	store db.Store
+}
+
+func (p *PromotionItemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "DELETE":
+		p.DeletePromotion(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// DeletePromotion отключает акцию, история продаж по ней сохраняется
+func (p *PromotionItemHandler) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid promotion id")
+		return
+	}
+
+	promotion, err := p.store.DeactivatePromotion(promotionID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(promotion)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
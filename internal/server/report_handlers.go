@@ -0,0 +1,112 @@
+package server
+
+import (
+	"db5/internal/db"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+func CreateDailyReportHandler(store db.Store) *DailyReportHandler {
+	return &DailyReportHandler{
+		store: store,
+	}
+}
+
+type DailyReportHandler struct {
+	store db.Store
+}
+
+func (d *DailyReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		d.GetDailyReport(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetDailyReport без параметра date отчет строится за сегодня
+func (d *DailyReportHandler) GetDailyReport(w http.ResponseWriter, r *http.Request) {
+	date := time.Now()
+	if strDate := r.URL.Query().Get("date"); strDate != "" {
+		var err error
+		date, err = time.ParseInLocation(time.DateOnly, strDate, time.Local)
+		if err != nil {
+			BadRequestHandler(w, r, "date must be in YYYY-MM-DD format")
+			return
+		}
+	}
+
+	report, err := d.store.GetDailyReport(date)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateMarginReportHandler(store db.Store) *MarginReportHandler {
+	return &MarginReportHandler{
+		store: store,
+	}
+}
+
+type MarginReportHandler struct {
+	store db.Store
+}
+
+func (m *MarginReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		m.GetMarginReport(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetMarginReport from и to включительно, по умолчанию отчет строится за сегодня
+func (m *MarginReportHandler) GetMarginReport(w http.ResponseWriter, r *http.Request) {
+	from, to := time.Now(), time.Now()
+	for _, param := range []struct {
+		name string
+		date *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		strDate := r.URL.Query().Get(param.name)
+		if strDate == "" {
+			continue
+		}
+		date, err := time.ParseInLocation(time.DateOnly, strDate, time.Local)
+		if err != nil {
+			BadRequestHandler(w, r, param.name+" must be in YYYY-MM-DD format")
+			return
+		}
+		*param.date = date
+	}
+
+	report, err := m.store.GetMarginReport(from, to)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
@@ -2,6 +2,12 @@ package server
 
 import (
 	"db5/internal/db"
+	"db5/internal/pdf"
+	"db5/internal/printer"
+	"db5/internal/types"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -18,34 +24,115 @@ func CreateNewServer(handler http.Handler) *http.Server {
 	}
 }
 
-func CreateNewServerMux(store db.Store) *http.Handler {
+func CreateNewServerMux(store db.Store, receiptRenderer *printer.Renderer, pdfGenerator *pdf.Generator) *http.Handler {
 	mux := http.NewServeMux()
 
 	employeeHandler := CreateEmployeeHandler(store)
 	employeeTeller := CreateEmployeeTellerHandler(store)
 	receiptHandler := CreateReceiptHandler(store)
+	receiptReturnHandler := CreateReceiptReturnHandler(store)
+	receiptVoidHandler := CreateReceiptVoidHandler(store)
+	receiptPreviewHandler := CreateReceiptPreviewHandler(store)
+	receiptBatchHandler := CreateReceiptBatchHandler(store)
+	receiptPrintHandler := CreateReceiptPrintHandler(store, receiptRenderer)
+	receiptPDFHandler := CreateReceiptPDFHandler(store, pdfGenerator)
 	departmentInfoHandler := CreateDepartmentInfoHandler(store)
 	productHandler := CreateProductHandler(store)
 	productInfoHandler := CreateProductInfoHandler(store)
 	supplierInfoHandler := CreateSupplierInfoHandler(store)
 	supplierProductHandler := CreateSupplierProductHandler(store)
 	orderHandler := CreateOrderHandler(store)
+	orderReceiveHandler := CreateOrderReceiveHandler(store)
+	orderStatusHandler := CreateOrderStatusHandler(store)
+	orderPDFHandler := CreateOrderPDFHandler(store, pdfGenerator)
+	dailyReportHandler := CreateDailyReportHandler(store)
+	shiftOpenHandler := CreateShiftOpenHandler(store)
+	shiftCloseHandler := CreateShiftCloseHandler(store)
+	shiftReportHandler := CreateShiftReportHandler(store)
+	loyaltyCardIssueHandler := CreateLoyaltyCardIssueHandler(store)
+	loyaltyCardHandler := CreateLoyaltyCardHandler(store)
+	loyaltyCardBlockHandler := CreateLoyaltyCardBlockHandler(store, true)
+	loyaltyCardUnblockHandler := CreateLoyaltyCardBlockHandler(store, false)
+	loyaltyBalanceHandler := CreateLoyaltyBalanceHandler(store)
+	customerHandler := CreateCustomerHandler(store)
+	customerItemHandler := CreateCustomerItemHandler(store)
+	customerCardHandler := CreateCustomerCardHandler(store)
+	customerMergeHandler := CreateCustomerMergeHandler(store)
+	customerReceiptsHandler := CreateCustomerReceiptsHandler(store)
+	promotionHandler := CreatePromotionHandler(store)
+	promotionItemHandler := CreatePromotionItemHandler(store)
+	taxRatesHandler := CreateTaxRatesHandler(store)
+	categoryTaxRateHandler := CreateCategoryTaxRateHandler(store)
+	productTaxRateHandler := CreateProductTaxRateHandler(store)
+	exchangeRateHandler := CreateExchangeRateHandler(store)
+	marginReportHandler := CreateMarginReportHandler(store)
+	receiptFiscalHandler := CreateReceiptFiscalHandler(store)
+	fiscalDocumentHandler := CreateFiscalDocumentHandler(store)
+	fiscalVerifyHandler := CreateFiscalVerifyHandler(store)
+	productMovementsHandler := CreateProductMovementsHandler(store)
+	stockCheckHandler := CreateStockCheckHandler(store)
+	stocktakeHandler := CreateStocktakeHandler(store)
+	stocktakeItemHandler := CreateStocktakeItemHandler(store)
+	stocktakeCountHandler := CreateStocktakeCountHandler(store)
+	stocktakeApproveHandler := CreateStocktakeCloseHandler(store, true)
+	stocktakeCancelHandler := CreateStocktakeCloseHandler(store, false)
 
 	mux.Handle("/employee", employeeHandler)
 	mux.Handle("/employee/teller/info", employeeTeller)
 	mux.Handle("/receipt", receiptHandler)
+	mux.Handle("/receipt/{id}/return", receiptReturnHandler)
+	mux.Handle("/receipt/{id}/void", receiptVoidHandler)
+	mux.Handle("/receipt/preview", receiptPreviewHandler)
+	mux.Handle("/receipt/batch", receiptBatchHandler)
+	mux.Handle("/receipt/{id}/print", receiptPrintHandler)
+	mux.Handle("/receipt/{file}", receiptPDFHandler)
 	mux.Handle("/department/info", departmentInfoHandler)
 	mux.Handle("/product", productHandler)
 	mux.Handle("/product/info", productInfoHandler)
 	mux.Handle("/supplier/info", supplierInfoHandler)
 	mux.Handle("/supplier/product/{id}", supplierProductHandler)
 	mux.Handle("/order", orderHandler)
+	mux.Handle("/order/{id}/receive", orderReceiveHandler)
+	mux.Handle("/order/{id}/status", orderStatusHandler)
+	mux.Handle("/order/{file}", orderPDFHandler)
+	mux.Handle("/report/daily", dailyReportHandler)
+	mux.Handle("/shift/open", shiftOpenHandler)
+	mux.Handle("/shift/{id}/close", shiftCloseHandler)
+	mux.Handle("/shift/{id}/report", shiftReportHandler)
+	mux.Handle("/loyalty", loyaltyCardIssueHandler)
+	mux.Handle("/loyalty/{number}", loyaltyCardHandler)
+	mux.Handle("/loyalty/{number}/block", loyaltyCardBlockHandler)
+	mux.Handle("/loyalty/{number}/unblock", loyaltyCardUnblockHandler)
+	mux.Handle("/loyalty/{number}/balance", loyaltyBalanceHandler)
+	mux.Handle("/customer", customerHandler)
+	mux.Handle("/customer/{id}", customerItemHandler)
+	mux.Handle("/customer/{id}/card/{number}", customerCardHandler)
+	mux.Handle("/customer/{id}/merge", customerMergeHandler)
+	mux.Handle("/customer/{id}/receipts", customerReceiptsHandler)
+	mux.Handle("/promotion", promotionHandler)
+	mux.Handle("/promotion/{id}", promotionItemHandler)
+	mux.Handle("/tax", taxRatesHandler)
+	mux.Handle("/tax/category/{category}", categoryTaxRateHandler)
+	mux.Handle("/tax/product/{id}", productTaxRateHandler)
+	mux.Handle("/currency/rate", exchangeRateHandler)
+	mux.Handle("/report/margin", marginReportHandler)
+	mux.Handle("/receipt/{id}/fiscal", receiptFiscalHandler)
+	mux.Handle("/fiscal/document", fiscalDocumentHandler)
+	mux.Handle("/fiscal/verify", fiscalVerifyHandler)
+	mux.Handle("/product/{id}/movements", productMovementsHandler)
+	mux.Handle("/stock/check", stockCheckHandler)
+	mux.Handle("/stocktake", stocktakeHandler)
+	mux.Handle("/stocktake/{id}", stocktakeItemHandler)
+	mux.Handle("/stocktake/{id}/count", stocktakeCountHandler)
+	mux.Handle("/stocktake/{id}/approve", stocktakeApproveHandler)
+	mux.Handle("/stocktake/{id}/cancel", stocktakeCancelHandler)
 
 	handler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", idempotencyKeyHeader},
+		ExposedHeaders:   []string{idempotencyReplayedHeader},
 	}).Handler(mux)
 
 	return &handler
@@ -60,3 +147,45 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 	w.Write([]byte("404 Not Found"))
 }
+
+func BadRequestHandler(w http.ResponseWriter, r *http.Request, message string) {
+	ErrorResponseHandler(w, r, http.StatusBadRequest, types.ErrorResponse{Error: message})
+}
+
+func ErrorResponseHandler(w http.ResponseWriter, r *http.Request, status int, response types.ErrorResponse) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
+
+// StoreErrorHandler отдает клиенту ошибки бизнес-логики из db, остальное считается внутренней ошибкой
+func StoreErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *db.ValidationError
+	var priceErr *db.PriceMismatchError
+	var stockErr *db.InsufficientStockError
+	var notFoundErr *db.NotFoundError
+	var conflictErr *db.ConflictError
+
+	switch {
+	case errors.As(err, &validationErr):
+		BadRequestHandler(w, r, validationErr.Error())
+	case errors.As(err, &priceErr):
+		ErrorResponseHandler(w, r, http.StatusConflict, types.ErrorResponse{Error: priceErr.Error(), Details: priceErr.Items})
+	case errors.As(err, &stockErr):
+		ErrorResponseHandler(w, r, http.StatusConflict, types.ErrorResponse{Error: stockErr.Error(), Details: stockErr.Items})
+	case errors.As(err, &notFoundErr):
+		ErrorResponseHandler(w, r, http.StatusNotFound, types.ErrorResponse{Error: notFoundErr.Error()})
+	case errors.As(err, &conflictErr):
+		ErrorResponseHandler(w, r, http.StatusConflict, types.ErrorResponse{Error: conflictErr.Error()})
+	default:
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+	}
+}
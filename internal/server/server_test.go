@@ -0,0 +1,34 @@
+package server
+
+import (
+	"db5/internal/db"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStoreErrorHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "validation", err: fmt.Errorf("CreateNewReceipt: %w", &db.ValidationError{Message: "bad"}), want: http.StatusBadRequest},
+		{name: "price mismatch", err: fmt.Errorf("CreateNewReceipt: %w", &db.PriceMismatchError{}), want: http.StatusConflict},
+		{name: "insufficient stock", err: fmt.Errorf("CreateNewReceipt: %w", &db.InsufficientStockError{}), want: http.StatusConflict},
+		{name: "not found", err: fmt.Errorf("ReceiveSupplierOrder: %w", &db.NotFoundError{}), want: http.StatusNotFound},
+		{name: "conflict", err: fmt.Errorf("ReceiveSupplierOrder: %w", &db.ConflictError{}), want: http.StatusConflict},
+		{name: "other", err: errors.New("connection refused"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			StoreErrorHandler(w, httptest.NewRequest(http.MethodPost, "/receipt", nil), tt.err)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
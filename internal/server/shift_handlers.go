@@ -0,0 +1,145 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/types"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreateShiftOpenHandler(store db.Store) *ShiftOpenHandler {
+	return &ShiftOpenHandler{
+		store: store,
+	}
+}
+
+type ShiftOpenHandler struct {
+	store db.Store
+}
+
+func (s *ShiftOpenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		s.PostShiftOpen(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (s *ShiftOpenHandler) PostShiftOpen(w http.ResponseWriter, r *http.Request) {
+	var shiftInfo types.ShiftOpenRequest
+	if err := json.NewDecoder(r.Body).Decode(&shiftInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	shift, err := s.store.OpenShift(shiftInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(shift)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateShiftCloseHandler(store db.Store) *ShiftCloseHandler {
+	return &ShiftCloseHandler{
+		store: store,
+	}
+}
+
+type ShiftCloseHandler struct {
+	store db.Store
+}
+
+func (s *ShiftCloseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		s.PostShiftClose(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (s *ShiftCloseHandler) PostShiftClose(w http.ResponseWriter, r *http.Request) {
+	shiftID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid shift id")
+		return
+	}
+
+	var closeInfo types.ShiftCloseRequest
+	if err := json.NewDecoder(r.Body).Decode(&closeInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	report, err := s.store.CloseShift(shiftID, closeInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateShiftReportHandler(store db.Store) *ShiftReportHandler {
+	return &ShiftReportHandler{
+		store: store,
+	}
+}
+
+type ShiftReportHandler struct {
+	store db.Store
+}
+
+func (s *ShiftReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.GetShiftReport(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (s *ShiftReportHandler) GetShiftReport(w http.ResponseWriter, r *http.Request) {
+	shiftID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid shift id")
+		return
+	}
+
+	report, err := s.store.GetShiftReport(shiftID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/types"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreateProductMovementsHandler(store db.Store) *ProductMovementsHandler {
+	return &ProductMovementsHandler{
+		store: store,
+	}
+}
+
+type ProductMovementsHandler struct {
+	store db.Store
+}
+
+func (pm *ProductMovementsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		pm.GetProductMovements(w, r)
+	case "POST":
+		pm.PostStockMovement(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (pm *ProductMovementsHandler) GetProductMovements(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid product id")
+		return
+	}
+
+	movements, err := pm.store.GetProductMovements(productID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(movements)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// PostStockMovement списание, корректировка или перемещение товара
+func (pm *ProductMovementsHandler) PostStockMovement(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid product id")
+		return
+	}
+
+	var movementInfo types.StockMovementRequest
+	if err := json.NewDecoder(r.Body).Decode(&movementInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	movement, err := pm.store.CreateStockMovement(productID, movementInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(movement)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateStockCheckHandler(store db.Store) *StockCheckHandler {
+	return &StockCheckHandler{
+		store: store,
+	}
+}
+
+type StockCheckHandler struct {
+	store db.Store
+}
+
+func (s *StockCheckHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.GetStockCheck(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetStockCheck сверяет остатки товаров с суммой движений по журналу
+func (s *StockCheckHandler) GetStockCheck(w http.ResponseWriter, r *http.Request) {
+	check, err := s.store.CheckStockLedger()
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(check)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
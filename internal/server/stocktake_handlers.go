@@ -0,0 +1,226 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/types"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreateStocktakeHandler(store db.Store) *StocktakeHandler {
+	return &StocktakeHandler{
+		store: store,
+	}
+}
+
+type StocktakeHandler struct {
+	store db.Store
+}
+
+func (s *StocktakeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.GetStocktakes(w, r)
+	case "POST":
+		s.PostStocktake(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetStocktakes status: open, approved или cancelled, без параметра — все инвентаризации
+func (s *StocktakeHandler) GetStocktakes(w http.ResponseWriter, r *http.Request) {
+	stocktakes, err := s.store.GetStocktakes(r.URL.Query().Get("status"))
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(stocktakes)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// PostStocktake открывает инвентаризацию отдела
+func (s *StocktakeHandler) PostStocktake(w http.ResponseWriter, r *http.Request) {
+	var openInfo types.StocktakeOpenRequest
+	if err := json.NewDecoder(r.Body).Decode(&openInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	stocktake, err := s.store.OpenStocktake(openInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(stocktake)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateStocktakeItemHandler(store db.Store) *StocktakeItemHandler {
+	return &StocktakeItemHandler{
+		store: store,
+	}
+}
+
+type StocktakeItemHandler struct {
+	store db.Store
+}
+
+func (s *StocktakeItemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.GetStocktake(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+// GetStocktake инвентаризация с расхождениями по каждому товару
+func (s *StocktakeItemHandler) GetStocktake(w http.ResponseWriter, r *http.Request) {
+	stocktakeID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid stocktake id")
+		return
+	}
+
+	stocktake, err := s.store.GetStocktake(stocktakeID)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(stocktake)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateStocktakeCountHandler(store db.Store) *StocktakeCountHandler {
+	return &StocktakeCountHandler{
+		store: store,
+	}
+}
+
+type StocktakeCountHandler struct {
+	store db.Store
+}
+
+func (s *StocktakeCountHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		// Сканер повторяет выгрузку при обрыве связи, с ключом она не посчитается дважды
+		idempotent(s.store, "POST /stocktake/count", s.PostStocktakeCount)(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (s *StocktakeCountHandler) PostStocktakeCount(w http.ResponseWriter, r *http.Request) {
+	stocktakeID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid stocktake id")
+		return
+	}
+
+	var countInfo types.StocktakeCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&countInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	stocktake, err := s.store.CountStocktake(stocktakeID, countInfo)
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(stocktake)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// CreateStocktakeCloseHandler approve определяет, утверждает обработчик инвентаризацию или отменяет
+func CreateStocktakeCloseHandler(store db.Store, approve bool) *StocktakeCloseHandler {
+	return &StocktakeCloseHandler{
+		store:   store,
+		approve: approve,
+	}
+}
+
+type StocktakeCloseHandler struct {
+	store   db.Store
+	approve bool
+}
+
+func (s *StocktakeCloseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		s.PostStocktakeClose(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (s *StocktakeCloseHandler) PostStocktakeClose(w http.ResponseWriter, r *http.Request) {
+	stocktakeID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid stocktake id")
+		return
+	}
+
+	var closeInfo types.StocktakeCloseRequest
+	if err := json.NewDecoder(r.Body).Decode(&closeInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	var stocktake types.StocktakeResponse
+	if s.approve {
+		stocktake, err = s.store.ApproveStocktake(stocktakeID, closeInfo)
+	} else {
+		stocktake, err = s.store.CancelStocktake(stocktakeID, closeInfo)
+	}
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(stocktake)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"db5/internal/db"
+	"db5/internal/types"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func CreateTaxRatesHandler(store db.Store) *TaxRatesHandler {
+	return &TaxRatesHandler{
+		store: store,
+	}
+}
+
+type TaxRatesHandler struct {
+	store db.Store
+}
+
+func (t *TaxRatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		t.GetTaxRates(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (t *TaxRatesHandler) GetTaxRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := t.store.GetTaxRates()
+	if err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	jsonData, err := json.Marshal(rates)
+	if err != nil {
+		InternalServerErrorHandler(w, r)
+		slog.Error(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func CreateCategoryTaxRateHandler(store db.Store) *CategoryTaxRateHandler {
+	return &CategoryTaxRateHandler{
+		store: store,
+	}
+}
+
+type CategoryTaxRateHandler struct {
+	store db.Store
+}
+
+func (t *CategoryTaxRateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		t.PutCategoryTaxRate(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (t *CategoryTaxRateHandler) PutCategoryTaxRate(w http.ResponseWriter, r *http.Request) {
+	var rateInfo types.TaxRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&rateInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	if err := t.store.SetCategoryTaxRate(r.PathValue("category"), rateInfo); err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func CreateProductTaxRateHandler(store db.Store) *ProductTaxRateHandler {
+	return &ProductTaxRateHandler{
+		store: store,
+	}
+}
+
+type ProductTaxRateHandler struct {
+	store db.Store
+}
+
+func (t *ProductTaxRateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		t.PutProductTaxRate(w, r)
+	default:
+		NotFoundHandler(w, r)
+	}
+}
+
+func (t *ProductTaxRateHandler) PutProductTaxRate(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		BadRequestHandler(w, r, "invalid product id")
+		return
+	}
+
+	var rateInfo types.TaxRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&rateInfo); err != nil {
+		BadRequestHandler(w, r, err.Error())
+		return
+	}
+
+	if err := t.store.SetProductTaxRate(productID, rateInfo); err != nil {
+		StoreErrorHandler(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -6,7 +6,7 @@ type Employee struct {
 	LastName   string
 	MiddleName string
 	Position   string
-	Salary     float64
+	Salary     Money
 }
 
 func (e *Employee) TellerInfoResponse() TellerInfoResponse {
@@ -35,7 +35,7 @@ func (d *Department) ToDepartmentInfoResponse() DepartmentInfoResponse {
 type Product struct {
 	ID       int64
 	Name     string
-	Price    float64
+	Price    Money
 	Category string
 	Quantity int
 }
@@ -47,6 +47,101 @@ func (p *Product) ToProductInfoBySupplierResponse() ProductInfoBySupplierRespons
 	}
 }
 
+// StoredResponse ответ на запрос с ключом идемпотентности, который отдается повторно
+type StoredResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+const (
+	SupplierOrderStatusDraft             = "draft"
+	SupplierOrderStatusSubmitted         = "submitted"
+	SupplierOrderStatusConfirmed         = "confirmed"
+	SupplierOrderStatusPartiallyReceived = "partially_received"
+	SupplierOrderStatusReceived          = "received"
+	SupplierOrderStatusCancelled         = "cancelled"
+)
+
+const (
+	ReceiptStatusActive = "active"
+	ReceiptStatusVoided = "voided"
+)
+
+const (
+	StockMovementOpening         = "opening"
+	StockMovementSale            = "sale"
+	StockMovementVoid            = "void"
+	StockMovementReturn          = "return"
+	StockMovementSupplierReceipt = "supplier_receipt"
+	StockMovementWriteOff        = "write_off"
+	StockMovementAdjustment      = "adjustment"
+	StockMovementTransfer        = "transfer"
+)
+
+// Документы, на которые ссылается движение товара
+const (
+	StockDocumentReceipt       = "receipt"
+	StockDocumentReceiptReturn = "receipt_return"
+	StockDocumentSupplierOrder = "supplier_order"
+	StockDocumentStocktake     = "stocktake"
+	StockDocumentTransfer      = "stock_transfer"
+)
+
+const (
+	StocktakeStatusOpen      = "open"
+	StocktakeStatusApproved  = "approved"
+	StocktakeStatusCancelled = "cancelled"
+)
+
+const (
+	BatchItemStatusSuccess  = "success"
+	BatchItemStatusConflict = "conflict"
+	BatchItemStatusError    = "error"
+)
+
+const (
+	FiscalStatusQueued = "queued"
+	FiscalStatusSent   = "sent"
+	FiscalStatusFailed = "failed"
+)
+
+// Операции, по которым формируются фискальные документы
+const (
+	FiscalDocumentReceipt = "receipt"
+	FiscalDocumentReturn  = "receipt_return"
+	FiscalDocumentVoid    = "receipt_void"
+)
+
+const (
+	PaymentMethodCash            = "cash"
+	PaymentMethodCard            = "card"
+	PaymentMethodLoyaltyPoints   = "loyalty_points"
+	PaymentMethodGiftCertificate = "gift_certificate"
+)
+
+// PaymentMethodName название способа оплаты для печатных документов
+func PaymentMethodName(method string) string {
+	switch method {
+	case PaymentMethodCash:
+		return "Наличными"
+	case PaymentMethodCard:
+		return "Картой"
+	case PaymentMethodLoyaltyPoints:
+		return "Баллами"
+	case PaymentMethodGiftCertificate:
+		return "Сертификатом"
+	}
+	return method
+}
+
+const (
+	PromotionKindPercent  = "percent"
+	PromotionKindFixed    = "fixed"
+	PromotionKindBuyNGetM = "buy_n_get_m"
+	PromotionKindBundle   = "bundle"
+)
+
 //type SupplierInfo struct {
 //	ID   int64
 //	Name string
@@ -0,0 +1,188 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money денежная сумма в копейках. Все расчеты ведутся в целых копейках,
+// округление до копейки — половина от нуля.
+// В JSON пишется строкой "123.45", читается из строки или из числа.
+type Money int64
+
+// ParseMoney разбирает десятичную запись суммы без потери точности.
+// Знаки после второго округляются до копейки.
+func ParseMoney(s string) (Money, error) {
+	text := strings.TrimSpace(s)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(text, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	rubles, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || rubles > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("invalid money value %q", s)
+	}
+
+	var kopecks int64
+	for i := 0; i < 2; i++ {
+		kopecks *= 10
+		if i < len(fraction) {
+			kopecks += int64(fraction[i] - '0')
+		}
+	}
+	if len(fraction) > 2 && fraction[2] >= '5' {
+		kopecks++
+	}
+
+	result := Money(rubles*100 + kopecks)
+	if negative {
+		result = -result
+	}
+	return result, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MoneyFromFloat переводит рубли в копейки с округлением. Нужна только на границе
+// с числами, которые приходят не как деньги (проценты, ставки).
+func MoneyFromFloat(rubles float64) Money {
+	return Money(math.Round(rubles * 100))
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+func (m Money) String() string {
+	sign := ""
+	value := int64(m)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+}
+
+// Mul стоимость quantity единиц по цене m
+func (m Money) Mul(quantity int64) Money {
+	return m * Money(quantity)
+}
+
+// MulDiv m * num / den с округлением до копейки, для пропорционального деления сумм
+func (m Money) MulDiv(num, den int64) Money {
+	if den == 0 {
+		return 0
+	}
+	product := int64(m) * num
+	quotient, remainder := product/den, product%den
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if 2*remainder >= abs(den) {
+		if (product < 0) != (den < 0) {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return Money(quotient)
+}
+
+// Percent percent процентов от суммы с округлением до копейки
+func (m Money) Percent(percent float64) Money {
+	return Money(math.Round(float64(m) * percent / 100))
+}
+
+// Convert сумма в другой валюте по курсу rate с округлением до копейки
+func (m Money) Convert(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+// IsCurrencyCode трехбуквенный код валюты ISO 4217 в верхнем регистре
+func IsCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	value, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
+
+// Scan читает numeric из базы
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		value, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = value
+	case string:
+		value, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = value
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = MoneyFromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+// Value пишет сумму в базу десятичной строкой, чтобы numeric получил точное значение
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
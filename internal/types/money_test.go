@@ -0,0 +1,113 @@
+package types
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "123.45", want: 12345},
+		{in: " 7 ", want: 700},
+		{in: "1.", want: 100},
+		{in: ".5", want: 50},
+		{in: "+2.1", want: 210},
+		{in: "-3.07", want: -307},
+		{in: "0.994", want: 99},
+		{in: "0.995", want: 100},
+		{in: "-1.005", want: -101},
+		{in: "", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: "1,50", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "92233720368547758.07", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyMulDiv(t *testing.T) {
+	tests := []struct {
+		m        Money
+		num, den int64
+		want     Money
+	}{
+		{m: 100, num: 1, den: 3, want: 33},
+		{m: 200, num: 1, den: 3, want: 67},
+		{m: -200, num: 1, den: 3, want: -67},
+		{m: 200, num: 1, den: -3, want: -67},
+		{m: 5, num: 1, den: 2, want: 3},
+		{m: -5, num: 1, den: 2, want: -3},
+		{m: 1000, num: 3, den: 4, want: 750},
+		{m: 999, num: 0, den: 7, want: 0},
+		{m: 999, num: 1, den: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.MulDiv(tt.num, tt.den); got != tt.want {
+			t.Errorf("Money(%d).MulDiv(%d, %d) = %d, want %d", tt.m, tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		m       Money
+		percent float64
+		want    Money
+	}{
+		{m: 1000, percent: 15, want: 150},
+		{m: 333, percent: 50, want: 167},
+		{m: -333, percent: 50, want: -167},
+		{m: 12345, percent: 0, want: 0},
+		{m: 12345, percent: 100, want: 12345},
+		{m: 999, percent: 2.5, want: 25},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Percent(tt.percent); got != tt.want {
+			t.Errorf("Money(%d).Percent(%v) = %d, want %d", tt.m, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	tests := []struct {
+		m    Money
+		rate float64
+		want Money
+	}{
+		{m: 1099, rate: 92.5, want: 101658},
+		{m: 10000, rate: 1, want: 10000},
+		{m: 333, rate: 0.5, want: 167},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Convert(tt.rate); got != tt.want {
+			t.Errorf("Money(%d).Convert(%v) = %d, want %d", tt.m, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestIsCurrencyCode(t *testing.T) {
+	for code, want := range map[string]bool{"RUB": true, "USD": true, "usd": false, "RU": false, "RUBL": false, "R1B": false} {
+		if got := IsCurrencyCode(code); got != want {
+			t.Errorf("IsCurrencyCode(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
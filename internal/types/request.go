@@ -1,38 +1,202 @@
 package types
 
+import "time"
+
 type ReceiptInfoRequest struct {
 	LoyaltyCardNumber int64                       `json:"loyalty_card_number"`
 	TellerID          int64                       `json:"teller_id"`
 	Products          []ReceiptProductInfoRequest `json:"products"`
+	Payments          []PaymentRequest            `json:"payments"`
+	Coupons           []string                    `json:"coupons"`
+}
+
+// OfflineReceiptRequest чек, пробитый кассой без связи. ClientUUID выдает касса,
+// по нему повторная выгрузка распознается как уже проведенный чек.
+type OfflineReceiptRequest struct {
+	ClientUUID string    `json:"client_uuid"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReceiptInfoRequest
+}
+
+// ReceiptBatchRequest чеки применяются по порядку, каждый в своей транзакции
+type ReceiptBatchRequest struct {
+	Receipts []OfflineReceiptRequest `json:"receipts"`
+}
+
+// PaymentRequest для наличных Amount — сумма, полученная от покупателя, сдача считается на сервере
+type PaymentRequest struct {
+	Method    string `json:"method"`
+	Amount    Money  `json:"amount"`
+	Reference string `json:"reference"`
 }
 
+// ReceiptProductInfoRequest Price и Amount — то, что показала касса. Не переданные поля не сверяются,
+// переданный ноль сверяется как обычная сумма.
+// В чеке кассы без связи оба поля обязательны и принимаются как есть, без сверки.
 type ReceiptProductInfoRequest struct {
-	ProductID int64   `json:"product_id"`
-	Quantity  int64   `json:"quantity"`
-	Price     float64 `json:"price"`
-	Amount    float64 `json:"amount"`
+	ProductID int64  `json:"product_id"`
+	Quantity  int64  `json:"quantity"`
+	Price     *Money `json:"price"`
+	Amount    *Money `json:"amount"`
 }
 
 type EmployeeInfoCreateRequest struct {
-	FirstName    string  `json:"first_name"`
-	LastName     string  `json:"last_name"`
-	MiddleName   string  `json:"middle_name"`
-	Position     string  `json:"position"`
-	Salary       float64 `json:"salary"`
-	DepartmentID int64   `json:"department_id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	MiddleName   string `json:"middle_name"`
+	Position     string `json:"position"`
+	Salary       Money  `json:"salary"`
+	DepartmentID int64  `json:"department_id"`
 }
 
 type EmployeeInfoDeleteRequest struct {
 	ID int64 `json:"employee_id"`
 }
 
+// SupplierOrderInfoRequest цены строк указываются в валюте заказа, пустая Currency означает базовую валюту
 type SupplierOrderInfoRequest struct {
 	SupplierID         int64                          `json:"supplier_id"`
+	Currency           string                         `json:"currency"`
 	SupplierOrderItems []SupplierOrderItemInfoRequest `json:"supplier_order_items"`
 }
 
 type SupplierOrderItemInfoRequest struct {
-	Price     float64 `json:"price"`
-	ProductID int64   `json:"product_id"`
-	Quantity  int64   `json:"quantity"`
+	Price     Money `json:"price"`
+	ProductID int64 `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+// SupplierOrderReceiveRequest EmployeeID — кто принял товар, попадает в журнал движения товара
+type SupplierOrderReceiveRequest struct {
+	EmployeeID int64                             `json:"employee_id"`
+	Items      []SupplierOrderReceiveItemRequest `json:"items"`
+}
+
+type SupplierOrderReceiveItemRequest struct {
+	ItemID   int64 `json:"item_id"`
+	Quantity int64 `json:"quantity"`
+}
+
+// StockMovementRequest движение товара без документа: списание, корректировка или перемещение.
+// Quantity — изменение остатка, для списания и перемещения отрицательное.
+// TargetProductID — товар, на который перемещается остаток, только для перемещения.
+type StockMovementRequest struct {
+	Kind            string `json:"kind"`
+	Quantity        int64  `json:"quantity"`
+	TargetProductID int64  `json:"target_product_id"`
+	EmployeeID      int64  `json:"employee_id"`
+	Comment         string `json:"comment"`
+}
+
+type StocktakeOpenRequest struct {
+	DepartmentID int64  `json:"department_id"`
+	EmployeeID   int64  `json:"employee_id"`
+	Comment      string `json:"comment"`
+}
+
+// StocktakeCountRequest одна выгрузка со сканера. Количества прибавляются к уже подсчитанным,
+// отрицательное количество исправляет ошибочный подсчет.
+type StocktakeCountRequest struct {
+	EmployeeID int64                       `json:"employee_id"`
+	Items      []StocktakeCountItemRequest `json:"items"`
+}
+
+type StocktakeCountItemRequest struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+// StocktakeCloseRequest утверждение или отмена инвентаризации
+type StocktakeCloseRequest struct {
+	EmployeeID int64 `json:"employee_id"`
+}
+
+type SupplierOrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// ReceiptReturnRequest PaymentMethod — способ оплаты чека, которым возвращаются деньги.
+// Пустой допустим для чека, оплаченного одним способом.
+type ReceiptReturnRequest struct {
+	TellerID      int64                         `json:"teller_id"`
+	PaymentMethod string                        `json:"payment_method"`
+	Products      []ReceiptReturnProductRequest `json:"products"`
+}
+
+type ReceiptReturnProductRequest struct {
+	ReceiptProductID int64 `json:"receipt_product_id"`
+	Quantity         int64 `json:"quantity"`
+}
+
+type ReceiptVoidRequest struct {
+	Reason       string `json:"reason"`
+	SupervisorID int64  `json:"supervisor_id"`
+}
+
+// ReceiptFilter пустой Status означает только действующие чеки, "all" — все. Number — печатный номер чека.
+type ReceiptFilter struct {
+	Status string
+	Number string
+}
+
+// ShiftOpenRequest пустой Register означает кассу по умолчанию из настроек
+type ShiftOpenRequest struct {
+	TellerID    int64  `json:"teller_id"`
+	Register    string `json:"register"`
+	OpeningCash Money  `json:"opening_cash"`
+}
+
+type ShiftCloseRequest struct {
+	CountedCash Money `json:"counted_cash"`
+}
+
+// CustomerRequest BirthDate в формате YYYY-MM-DD, пустая строка — не указана
+type CustomerRequest struct {
+	Name         string `json:"name"`
+	Phone        string `json:"phone"`
+	Email        string `json:"email"`
+	BirthDate    string `json:"birth_date"`
+	SmsConsent   bool   `json:"sms_consent"`
+	EmailConsent bool   `json:"email_consent"`
+}
+
+// CustomerMergeRequest SourceID покупатель-дубликат, который переносится в целевого и удаляется
+type CustomerMergeRequest struct {
+	SourceID int64 `json:"source_id"`
+}
+
+// PromotionRequest Percent — процент скидки для percent, Amount — скидка на единицу для fixed или цена комплекта для bundle.
+// TimeFrom и TimeTo в формате HH:MM задают счастливые часы, окно может переходить через полночь.
+type PromotionRequest struct {
+	Name         string                       `json:"name"`
+	Kind         string                       `json:"kind"`
+	ProductID    int64                        `json:"product_id"`
+	Category     string                       `json:"category"`
+	Percent      float64                      `json:"percent"`
+	Amount       Money                        `json:"amount"`
+	BuyQuantity  int64                        `json:"buy_quantity"`
+	FreeQuantity int64                        `json:"free_quantity"`
+	BundleItems  []PromotionBundleItemRequest `json:"bundle_items"`
+	CouponCode   string                       `json:"coupon_code"`
+	StartsAt     *time.Time                   `json:"starts_at"`
+	EndsAt       *time.Time                   `json:"ends_at"`
+	TimeFrom     string                       `json:"time_from"`
+	TimeTo       string                       `json:"time_to"`
+}
+
+type PromotionBundleItemRequest struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+// TaxRateRequest пустой Rate снимает собственную ставку, после чего действует ставка категории или ставка по умолчанию
+type TaxRateRequest struct {
+	Rate *float64 `json:"rate"`
+}
+
+// ExchangeRateRequest курс: сколько единиц базовой валюты стоит одна единица Currency на дату Date
+type ExchangeRateRequest struct {
+	Currency string  `json:"currency"`
+	Date     string  `json:"date"`
+	Rate     float64 `json:"rate"`
 }
@@ -3,10 +3,10 @@ package types
 import "time"
 
 type ProductInfoResponse struct {
-	ID       int64   `json:"id"`
-	Name     string  `json:"name"`
-	Quantity int     `json:"quantity"`
-	Price    float64 `json:"price"`
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Price    Money  `json:"price"`
 }
 
 type TellerInfoResponse struct {
@@ -42,44 +42,454 @@ type ProductInfoBySupplierResponse struct {
 }
 
 type FullProductInfoResponse struct {
-	Name           string  `json:"name"`
-	Price          float64 `json:"price"`
-	Quantity       int     `json:"quantity"`
-	Category       string  `json:"category"`
-	DepartmentName string  `json:"department_name"`
+	Name           string `json:"name"`
+	Price          Money  `json:"price"`
+	Quantity       int    `json:"quantity"`
+	Category       string `json:"category"`
+	DepartmentName string `json:"department_name"`
 }
 
 type FullReceiptInfoResponse struct {
 	ID                int64
+	Status            string                   `json:"status"`
+	VoidReason        string                   `json:"void_reason,omitempty"`
 	TellerFirstName   string                   `json:"teller_first_name"`
 	TellerLastName    string                   `json:"teller_last_name"`
 	TellerMiddleName  string                   `json:"teller_middle_name"`
 	Number            int                      `json:"number"`
+	PrintedNumber     string                   `json:"printed_number"`
 	Date              time.Time                `json:"date"`
-	Total             float64                  `json:"total"`
-	LoyaltyCardNumber int                      `json:"loyalty_card_number"`
+	Total             Money                    `json:"total"`
+	RefundedTotal     Money                    `json:"refunded_total"`
+	NetTotal          Money                    `json:"net_total"`
+	LoyaltyCardNumber int64                    `json:"loyalty_card_number"`
+	ShiftID           int64                    `json:"shift_id"`
+	Register          string                   `json:"register"`
 	Products          []ReceiptProductResponse `json:"products"`
+	Taxes             []TaxTotalResponse       `json:"taxes"`
+	Payments          []PaymentResponse        `json:"payments"`
+	Returns           []ReceiptReturnResponse  `json:"returns"`
 }
 
 type ReceiptProductResponse struct {
-	Name     string  `json:"name"`
-	Quantity int     `json:"quantity"`
-	Price    float64 `json:"price"`
-	Amount   float64 `json:"amount"`
+	ID                int64    `json:"id"`
+	Name              string   `json:"name"`
+	Quantity          int      `json:"quantity"`
+	ReturnedQuantity  int      `json:"returned_quantity"`
+	Price             Money    `json:"price"`
+	Discount          Money    `json:"discount"`
+	PromotionID       *int64   `json:"promotion_id,omitempty"`
+	PromotionDiscount Money    `json:"promotion_discount"`
+	Amount            Money    `json:"amount"`
+	VatRate           *float64 `json:"vat_rate"`
+	VatAmount         Money    `json:"vat_amount"`
 }
 
 type FullSupplierOrderInfoResponse struct {
 	ID                 int64                       `json:"id"`
+	Status             string                      `json:"status"`
 	OrderDate          time.Time                   `json:"order_date"`
 	DateOfReceipt      time.Time                   `json:"date_of_receipt"`
-	Total              float64                     `json:"total"`
+	Currency           string                      `json:"currency"`
+	ExchangeRate       float64                     `json:"exchange_rate"`
+	Total              Money                       `json:"total"`
+	BaseTotal          Money                       `json:"base_total"`
 	SupplierName       string                      `json:"supplier_name"`
 	SupplierOrderItems []SupplierOrderItemResponse `json:"supplier_order_items"`
 }
 
+// SupplierOrderItemResponse Price и Amount в валюте заказа, BasePrice и BaseAmount в базовой валюте
 type SupplierOrderItemResponse struct {
-	ProductName string  `json:"product_name"`
-	Quantity    int     `json:"quantity"`
-	Price       float64 `json:"price"`
-	Amount      float64 `json:"amount"`
+	ID               int64  `json:"id"`
+	ProductName      string `json:"product_name"`
+	Quantity         int    `json:"quantity"`
+	ReceivedQuantity int    `json:"received_quantity"`
+	Price            Money  `json:"price"`
+	Amount           Money  `json:"amount"`
+	BasePrice        Money  `json:"base_price"`
+	BaseAmount       Money  `json:"base_amount"`
+}
+
+type ReceiptResponse struct {
+	ID            int64                 `json:"id"`
+	ShiftID       int64                 `json:"shift_id"`
+	Number        int                   `json:"number"`
+	PrintedNumber string                `json:"printed_number"`
+	Date          time.Time             `json:"date"`
+	Total         Money                 `json:"total"`
+	Discount      Money                 `json:"discount"`
+	Change        Money                 `json:"change"`
+	PointsAccrued int64                 `json:"points_accrued"`
+	AfterClose    bool                  `json:"after_close,omitempty"`
+	Products      []ReceiptLineResponse `json:"products"`
+	Taxes         []TaxTotalResponse    `json:"taxes"`
+	Payments      []PaymentResponse     `json:"payments"`
+}
+
+// ReceiptBatchItemResponse Status: success, conflict (чек противоречит состоянию: цены, остатки, смена)
+// или error. Duplicate — чек уже был проведен раньше, тогда в Receipt только реквизиты без строк.
+type ReceiptBatchItemResponse struct {
+	ClientUUID string           `json:"client_uuid"`
+	Status     string           `json:"status"`
+	Duplicate  bool             `json:"duplicate,omitempty"`
+	Receipt    *ReceiptResponse `json:"receipt,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Details    any              `json:"details,omitempty"`
+}
+
+type ReceiptBatchResponse struct {
+	Results []ReceiptBatchItemResponse `json:"results"`
+}
+
+type PaymentResponse struct {
+	Method    string `json:"method"`
+	Amount    Money  `json:"amount"`
+	Tendered  Money  `json:"tendered"`
+	Change    Money  `json:"change"`
+	Reference string `json:"reference,omitempty"`
+}
+
+type PaymentTotalResponse struct {
+	Method  string `json:"method"`
+	Sales   Money  `json:"sales"`
+	Refunds Money  `json:"refunds"`
+}
+
+type ReceiptLineResponse struct {
+	ProductID         int64   `json:"product_id"`
+	Name              string  `json:"name"`
+	Quantity          int64   `json:"quantity"`
+	Price             Money   `json:"price"`
+	Discount          Money   `json:"discount"`
+	PromotionID       *int64  `json:"promotion_id,omitempty"`
+	PromotionName     string  `json:"promotion_name,omitempty"`
+	PromotionDiscount Money   `json:"promotion_discount"`
+	Amount            Money   `json:"amount"`
+	VatRate           float64 `json:"vat_rate"`
+	VatAmount         Money   `json:"vat_amount"`
+	ExpectedPrice     *Money  `json:"expected_price,omitempty"`
+	ExpectedAmount    *Money  `json:"expected_amount,omitempty"`
+}
+
+// PriceMismatchResponse ReceivedPrice и ReceivedAmount пустые, если касса их не передала
+type PriceMismatchResponse struct {
+	ProductID      int64  `json:"product_id"`
+	ExpectedPrice  Money  `json:"expected_price"`
+	ReceivedPrice  *Money `json:"received_price"`
+	ExpectedAmount Money  `json:"expected_amount"`
+	ReceivedAmount *Money `json:"received_amount"`
+}
+
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Details any    `json:"details,omitempty"`
+}
+
+type InsufficientStockResponse struct {
+	ProductID int64 `json:"product_id"`
+	Requested int64 `json:"requested"`
+	Available int64 `json:"available"`
+}
+
+// ReceiptReturnResponse суммы возврата отрицательные, чтобы их можно было складывать с продажами
+type ReceiptReturnResponse struct {
+	ID            int64                       `json:"id"`
+	ReceiptID     int64                       `json:"receipt_id"`
+	TellerID      int64                       `json:"teller_id"`
+	PaymentMethod string                      `json:"payment_method"`
+	PointsChange  int64                       `json:"points_change"`
+	Date          time.Time                   `json:"date"`
+	Total         Money                       `json:"total"`
+	Products      []ReceiptReturnLineResponse `json:"products"`
+}
+
+type ReceiptReturnLineResponse struct {
+	ReceiptProductID int64  `json:"receipt_product_id"`
+	ProductID        int64  `json:"product_id"`
+	Name             string `json:"name"`
+	Quantity         int64  `json:"quantity"`
+	Price            Money  `json:"price"`
+	Amount           Money  `json:"amount"`
+	VatAmount        Money  `json:"vat_amount"`
+}
+
+type DailyReportResponse struct {
+	Date         string                   `json:"date"`
+	ReceiptCount int                      `json:"receipt_count"`
+	GrossSales   Money                    `json:"gross_sales"`
+	VoidCount    int                      `json:"void_count"`
+	VoidedTotal  Money                    `json:"voided_total"`
+	ReturnCount  int                      `json:"return_count"`
+	Refunds      Money                    `json:"refunds"`
+	NetRevenue   Money                    `json:"net_revenue"`
+	Discounts    Money                    `json:"discounts"`
+	Promotions   []PromotionTotalResponse `json:"promotions"`
+	Taxes        []TaxReportResponse      `json:"taxes"`
+}
+
+// PromotionTotalResponse скидки по акции в действующих чеках за период
+type PromotionTotalResponse struct {
+	PromotionID int64  `json:"promotion_id"`
+	Name        string `json:"name"`
+	LineCount   int    `json:"line_count"`
+	Discount    Money  `json:"discount"`
+}
+
+type ShiftResponse struct {
+	ID          int64      `json:"id"`
+	TellerID    int64      `json:"teller_id"`
+	Register    string     `json:"register"`
+	OpenedAt    time.Time  `json:"opened_at"`
+	ClosedAt    *time.Time `json:"closed_at"`
+	OpeningCash Money      `json:"opening_cash"`
+	ClosingCash *Money     `json:"closing_cash"`
+}
+
+// ShiftReportResponse X-отчет для открытой смены, Z-отчет для закрытой.
+// AfterClose — чеки кассы без связи, выгруженные после закрытия смены, в остальные итоги не входят.
+type ShiftReportResponse struct {
+	Type            string                 `json:"type"`
+	Shift           ShiftResponse          `json:"shift"`
+	GeneratedAt     time.Time              `json:"generated_at"`
+	ReceiptCount    int                    `json:"receipt_count"`
+	GrossSales      Money                  `json:"gross_sales"`
+	ReturnCount     int                    `json:"return_count"`
+	Refunds         Money                  `json:"refunds"`
+	VoidCount       int                    `json:"void_count"`
+	VoidedTotal     Money                  `json:"voided_total"`
+	NetRevenue      Money                  `json:"net_revenue"`
+	Payments        []PaymentTotalResponse `json:"payments"`
+	ExpectedCash    Money                  `json:"expected_cash"`
+	CountedCash     *Money                 `json:"counted_cash"`
+	CashDiscrepancy *Money                 `json:"cash_discrepancy"`
+	AfterCloseCount int                    `json:"after_close_count"`
+	AfterCloseTotal Money                  `json:"after_close_total"`
+}
+
+type LoyaltyCardResponse struct {
+	ID              int64     `json:"id"`
+	Number          int64     `json:"number"`
+	Blocked         bool      `json:"blocked"`
+	IssuedAt        time.Time `json:"issued_at"`
+	Tier            string    `json:"tier"`
+	DiscountPercent float64   `json:"discount_percent"`
+	CustomerID      *int64    `json:"customer_id,omitempty"`
+}
+
+type LoyaltyBalanceResponse struct {
+	Number  int64                        `json:"number"`
+	Balance int64                        `json:"balance"`
+	History []LoyaltyPointsEntryResponse `json:"history"`
+}
+
+type LoyaltyPointsEntryResponse struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	Points    int64     `json:"points"`
+	ReceiptID *int64    `json:"receipt_id"`
+	ReturnID  *int64    `json:"return_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CustomerResponse struct {
+	ID           int64                 `json:"id"`
+	Name         string                `json:"name"`
+	Phone        string                `json:"phone,omitempty"`
+	Email        string                `json:"email,omitempty"`
+	BirthDate    string                `json:"birth_date,omitempty"`
+	SmsConsent   bool                  `json:"sms_consent"`
+	EmailConsent bool                  `json:"email_consent"`
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+	Cards        []LoyaltyCardResponse `json:"cards"`
+}
+
+type PromotionResponse struct {
+	ID           int64                         `json:"id"`
+	Name         string                        `json:"name"`
+	Kind         string                        `json:"kind"`
+	ProductID    int64                         `json:"product_id,omitempty"`
+	Category     string                        `json:"category,omitempty"`
+	Percent      float64                       `json:"percent,omitempty"`
+	Amount       Money                         `json:"amount,omitempty"`
+	BuyQuantity  int64                         `json:"buy_quantity,omitempty"`
+	FreeQuantity int64                         `json:"free_quantity,omitempty"`
+	BundleItems  []PromotionBundleItemResponse `json:"bundle_items,omitempty"`
+	CouponCode   string                        `json:"coupon_code,omitempty"`
+	StartsAt     *time.Time                    `json:"starts_at"`
+	EndsAt       *time.Time                    `json:"ends_at"`
+	TimeFrom     string                        `json:"time_from,omitempty"`
+	TimeTo       string                        `json:"time_to,omitempty"`
+	Active       bool                          `json:"active"`
+	CreatedAt    time.Time                     `json:"created_at"`
+}
+
+type PromotionBundleItemResponse struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+// TaxTotalResponse Amount — сумма строк по ставке с НДС, Tax — НДС в ней
+type TaxTotalResponse struct {
+	Rate   float64 `json:"rate"`
+	Amount Money   `json:"amount"`
+	Tax    Money   `json:"tax"`
+}
+
+// TaxReportResponse продажи и возвраты по ставке НДС за период, возвраты отрицательные
+type TaxReportResponse struct {
+	Rate       float64 `json:"rate"`
+	Sales      Money   `json:"sales"`
+	SalesTax   Money   `json:"sales_tax"`
+	Refunds    Money   `json:"refunds"`
+	RefundsTax Money   `json:"refunds_tax"`
+	NetTax     Money   `json:"net_tax"`
+}
+
+type TaxRatesResponse struct {
+	DefaultRate float64                   `json:"default_rate"`
+	Categories  []CategoryTaxRateResponse `json:"categories"`
+	Products    []ProductTaxRateResponse  `json:"products"`
+}
+
+type CategoryTaxRateResponse struct {
+	Category string  `json:"category"`
+	Rate     float64 `json:"rate"`
+}
+
+type ProductTaxRateResponse struct {
+	ProductID int64   `json:"product_id"`
+	Name      string  `json:"name"`
+	Rate      float64 `json:"rate"`
+}
+
+type ExchangeRateResponse struct {
+	Currency string  `json:"currency"`
+	Date     string  `json:"date"`
+	Rate     float64 `json:"rate"`
+}
+
+// MarginReportResponse выручка и себестоимость проданного за период в базовой валюте, возвраты вычтены.
+// Cost и Margin итога складываются только по товарам с известной себестоимостью.
+type MarginReportResponse struct {
+	From     string                  `json:"from"`
+	To       string                  `json:"to"`
+	Currency string                  `json:"currency"`
+	Revenue  Money                   `json:"revenue"`
+	Cost     Money                   `json:"cost"`
+	Margin   Money                   `json:"margin"`
+	Products []ProductMarginResponse `json:"products"`
+}
+
+// ProductMarginResponse UnitCost пустой, если товар ни разу не закупался, тогда Cost и Margin не считаются
+type ProductMarginResponse struct {
+	ProductID int64  `json:"product_id"`
+	Name      string `json:"name"`
+	Quantity  int64  `json:"quantity"`
+	Revenue   Money  `json:"revenue"`
+	UnitCost  *Money `json:"unit_cost"`
+	Cost      Money  `json:"cost"`
+	Margin    Money  `json:"margin"`
+}
+
+// FiscalDocumentResponse фискальный документ операции по чеку: продажи, возврата или аннулирования.
+// Payload хранится в том виде, в котором подписан.
+type FiscalDocumentResponse struct {
+	ID           int64      `json:"id"`
+	ReceiptID    int64      `json:"receipt_id"`
+	DocumentType string     `json:"document_type"`
+	DocumentID   int64      `json:"document_id"`
+	Register     string     `json:"register"`
+	Number       int64      `json:"number"`
+	Format       string     `json:"format"`
+	Payload      string     `json:"payload"`
+	PrevHash     string     `json:"prev_hash"`
+	Hash         string     `json:"hash"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `json:"last_error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	SentAt       *time.Time `json:"sent_at,omitempty"`
+}
+
+// FiscalChainResponse результат проверки цепочки документов кассы.
+// BrokenAt — номер первого документа, на котором цепочка нарушена.
+type FiscalChainResponse struct {
+	Register  string `json:"register"`
+	Documents int    `json:"documents"`
+	Valid     bool   `json:"valid"`
+	BrokenAt  *int64 `json:"broken_at,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// StockMovementResponse Balance — остаток товара после движения.
+// Incoming — встречное движение товара-получателя, только в ответе на перемещение.
+type StockMovementResponse struct {
+	ID           int64                  `json:"id"`
+	Kind         string                 `json:"kind"`
+	Quantity     int64                  `json:"quantity"`
+	Balance      int64                  `json:"balance"`
+	DocumentType string                 `json:"document_type,omitempty"`
+	DocumentID   int64                  `json:"document_id,omitempty"`
+	EmployeeID   int64                  `json:"employee_id,omitempty"`
+	Comment      string                 `json:"comment,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	Incoming     *StockMovementResponse `json:"incoming,omitempty"`
+}
+
+type ProductMovementsResponse struct {
+	ProductID int64                   `json:"product_id"`
+	Name      string                  `json:"name"`
+	Stock     int64                   `json:"stock"`
+	Movements []StockMovementResponse `json:"movements"`
+}
+
+// StockCheckResponse сверка остатков с журналом движения товара
+type StockCheckResponse struct {
+	Products   int                     `json:"products"`
+	Consistent bool                    `json:"consistent"`
+	Mismatches []StockMismatchResponse `json:"mismatches"`
+}
+
+// StockMismatchResponse Difference = Stock - Ledger
+type StockMismatchResponse struct {
+	ProductID  int64  `json:"product_id"`
+	Name       string `json:"name"`
+	Stock      int64  `json:"stock"`
+	Ledger     int64  `json:"ledger"`
+	Difference int64  `json:"difference"`
+}
+
+// StocktakeResponse Variance — подсчитано минус ожидалось по подсчитанным товарам,
+// VarianceValue — то же в себестоимости, только по товарам с известной себестоимостью.
+// Items пустой в списке инвентаризаций.
+type StocktakeResponse struct {
+	ID             int64                   `json:"id"`
+	DepartmentID   int64                   `json:"department_id"`
+	DepartmentName string                  `json:"department_name"`
+	Status         string                  `json:"status"`
+	Comment        string                  `json:"comment,omitempty"`
+	OpenedBy       int64                   `json:"opened_by"`
+	OpenedAt       time.Time               `json:"opened_at"`
+	ClosedBy       *int64                  `json:"closed_by,omitempty"`
+	ClosedAt       *time.Time              `json:"closed_at,omitempty"`
+	Products       int                     `json:"products"`
+	Counted        int                     `json:"counted"`
+	Variance       int64                   `json:"variance"`
+	VarianceValue  Money                   `json:"variance_value"`
+	Items          []StocktakeItemResponse `json:"items,omitempty"`
+}
+
+// StocktakeItemResponse Counted и Variance пустые, пока товар не подсчитан.
+// Moved — движение товара после открытия, Variance = Counted - (Expected + Moved).
+// UnitCost пустой, если товар ни разу не закупался.
+type StocktakeItemResponse struct {
+	ProductID     int64  `json:"product_id"`
+	Name          string `json:"name"`
+	Expected      int64  `json:"expected"`
+	Moved         int64  `json:"moved"`
+	Counted       *int64 `json:"counted"`
+	Variance      *int64 `json:"variance"`
+	UnitCost      *Money `json:"unit_cost"`
+	VarianceValue *Money `json:"variance_value"`
 }
@@ -0,0 +1,11 @@
+-- Приемка заказов поставщику: построчный учет принятого количества
+alter table Supplier_Order_Items add column if not exists id bigserial;
+alter table Supplier_Order_Items add column if not exists received_quantity integer not null default 0;
+
+create unique index if not exists supplier_order_items_id_idx on Supplier_Order_Items (id);
+
+-- уже принятые заказы считаем принятыми полностью
+update Supplier_Order_Items as soi
+set received_quantity = soi.quantity
+from Supplier_Order as so
+where so.id = soi.order_id and so.date_of_receipt is not null;
@@ -0,0 +1,13 @@
+-- Жизненный цикл заказа поставщику
+alter table Supplier_Order add column if not exists status varchar(32) not null default 'draft';
+
+-- заказы, созданные до появления статусов, считаем подтвержденными
+update Supplier_Order as so
+set status = case
+	when so.date_of_receipt is not null then 'received'
+	when exists (select 1 from Supplier_Order_Items as soi where soi.order_id = so.id and soi.received_quantity > 0) then 'partially_received'
+	else 'confirmed'
+end;
+
+alter table Supplier_Order add constraint supplier_order_status_check
+	check (status in ('draft', 'submitted', 'confirmed', 'partially_received', 'received', 'cancelled'));
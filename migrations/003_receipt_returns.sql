@@ -0,0 +1,24 @@
+-- Возвраты по чекам
+alter table Receipt_Product add column if not exists id bigserial;
+
+create unique index if not exists receipt_product_id_idx on Receipt_Product (id);
+
+create table if not exists Receipt_Return (
+	id           bigserial primary key,
+	receipt_id   bigint         not null references Receipt (id),
+	employee_id  bigint         not null references Employee (id),
+	date_time    timestamp      not null default now(),
+	total_amount numeric(12, 2) not null
+);
+
+create index if not exists receipt_return_receipt_id_idx on Receipt_Return (receipt_id);
+
+create table if not exists Receipt_Return_Product (
+	id                 bigserial primary key,
+	return_id          bigint         not null references Receipt_Return (id),
+	receipt_product_id bigint         not null references Receipt_Product (id),
+	quantity           integer        not null check (quantity > 0),
+	amount             numeric(12, 2) not null
+);
+
+create index if not exists receipt_return_product_line_idx on Receipt_Return_Product (receipt_product_id);
@@ -0,0 +1,7 @@
+-- Аннулирование чеков
+alter table Receipt add column if not exists status varchar(16) not null default 'active';
+alter table Receipt add column if not exists void_reason text;
+alter table Receipt add column if not exists voided_by bigint references Employee (id);
+alter table Receipt add column if not exists voided_at timestamp;
+
+alter table Receipt add constraint receipt_status_check check (status in ('active', 'voided'));
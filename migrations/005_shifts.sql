@@ -0,0 +1,18 @@
+-- Кассовые смены
+create table if not exists Shift (
+	id           bigserial primary key,
+	employee_id  bigint         not null references Employee (id),
+	opened_at    timestamp      not null default now(),
+	closed_at    timestamp,
+	opening_cash numeric(12, 2) not null default 0,
+	closing_cash numeric(12, 2)
+);
+
+-- у кассира может быть только одна открытая смена
+create unique index if not exists shift_open_employee_idx on Shift (employee_id) where closed_at is null;
+
+alter table Receipt add column if not exists shift_id bigint references Shift (id);
+alter table Receipt_Return add column if not exists shift_id bigint references Shift (id);
+
+create index if not exists receipt_shift_id_idx on Receipt (shift_id);
+create index if not exists receipt_return_shift_id_idx on Receipt_Return (shift_id);
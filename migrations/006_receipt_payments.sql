@@ -0,0 +1,21 @@
+-- Оплаты по чекам
+create table if not exists Receipt_Payment (
+	id            bigserial primary key,
+	receipt_id    bigint         not null references Receipt (id),
+	method        varchar(32)    not null check (method in ('cash', 'card', 'loyalty_points', 'gift_certificate')),
+	amount        numeric(12, 2) not null check (amount > 0),
+	tendered      numeric(12, 2) not null,
+	change_amount numeric(12, 2) not null default 0,
+	reference     varchar(64)
+);
+
+create index if not exists receipt_payment_receipt_id_idx on Receipt_Payment (receipt_id);
+
+-- до появления оплат все чеки оплачивались наличными без сдачи
+insert into Receipt_Payment (receipt_id, method, amount, tendered)
+select r.id, 'cash', r.total_amount, r.total_amount
+from Receipt as r
+where r.total_amount > 0
+  and not exists (select 1 from Receipt_Payment as rp where rp.receipt_id = r.id);
+
+alter table Receipt_Return add column if not exists payment_method varchar(32) not null default 'cash';
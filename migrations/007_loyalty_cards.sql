@@ -0,0 +1,5 @@
+-- Выпуск и блокировка карт лояльности
+alter table Loyalty_Card add column if not exists blocked boolean not null default false;
+alter table Loyalty_Card add column if not exists issued_at timestamp not null default now();
+
+create unique index if not exists loyalty_card_number_idx on Loyalty_Card (number);
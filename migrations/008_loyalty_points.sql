@@ -0,0 +1,13 @@
+-- Журнал баллов по картам лояльности
+create table if not exists Loyalty_Points_Ledger (
+	id         bigserial primary key,
+	card_id    bigint      not null references Loyalty_Card (id),
+	receipt_id bigint references Receipt (id),
+	return_id  bigint references Receipt_Return (id),
+	kind       varchar(16) not null check (kind in ('accrual', 'redemption', 'reversal', 'refund')),
+	points     integer     not null,
+	created_at timestamp   not null default now()
+);
+
+create index if not exists loyalty_points_ledger_card_id_idx on Loyalty_Points_Ledger (card_id);
+create index if not exists loyalty_points_ledger_receipt_id_idx on Loyalty_Points_Ledger (receipt_id);
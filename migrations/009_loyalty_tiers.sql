@@ -0,0 +1,5 @@
+-- Уровни карт лояльности и скидки в строках чека
+alter table Loyalty_Card add column if not exists tier varchar(32);
+alter table Loyalty_Card add column if not exists tier_updated_at timestamp;
+
+alter table Receipt_Product add column if not exists discount_amount numeric(12, 2) not null default 0;
@@ -0,0 +1,17 @@
+-- Покупатели и привязка к ним карт лояльности
+create table if not exists Customer (
+	id            bigserial    primary key,
+	name          varchar(255) not null,
+	phone         varchar(16),
+	email         varchar(255),
+	birth_date    date,
+	sms_consent   boolean      not null default false,
+	email_consent boolean      not null default false,
+	created_at    timestamp    not null default now(),
+	updated_at    timestamp    not null default now()
+);
+
+create index if not exists customer_phone_idx on Customer (phone);
+
+alter table Loyalty_Card add column if not exists customer_id bigint references Customer (id) on delete set null;
+create index if not exists loyalty_card_customer_idx on Loyalty_Card (customer_id);
@@ -0,0 +1,30 @@
+-- Акции и скидки: процент, фиксированная скидка, N+M, комплекты, счастливые часы и купоны
+create table if not exists Promotion (
+	id            bigserial      primary key,
+	name          varchar(255)   not null,
+	kind          varchar(32)    not null check (kind in ('percent', 'fixed', 'buy_n_get_m', 'bundle')),
+	product_id    bigint references Product (id),
+	category      varchar(255),
+	value         numeric(12, 2) not null default 0,
+	buy_quantity  int            not null default 0,
+	free_quantity int            not null default 0,
+	coupon_code   varchar(64),
+	starts_at     timestamp,
+	ends_at       timestamp,
+	time_from     time,
+	time_to       time,
+	active        boolean        not null default true,
+	created_at    timestamp      not null default now()
+);
+
+create unique index if not exists promotion_coupon_code_idx on Promotion (coupon_code) where active;
+
+create table if not exists Promotion_Bundle_Item (
+	promotion_id bigint not null references Promotion (id),
+	product_id   bigint not null references Product (id),
+	quantity     int    not null check (quantity > 0),
+	primary key (promotion_id, product_id)
+);
+
+alter table Receipt_Product add column if not exists promotion_id bigint references Promotion (id);
+alter table Receipt_Product add column if not exists promotion_discount numeric(12, 2) not null default 0;
@@ -0,0 +1,12 @@
+-- Ставки НДС по товарам и категориям, НДС в строках чеков и возвратов
+create table if not exists Category_Tax_Rate (
+	category varchar(255)  primary key,
+	rate     numeric(5, 2) not null check (rate >= 0 and rate < 100)
+);
+
+alter table Product add column if not exists vat_rate numeric(5, 2) check (vat_rate >= 0 and vat_rate < 100);
+
+alter table Receipt_Product add column if not exists vat_rate numeric(5, 2);
+alter table Receipt_Product add column if not exists vat_amount numeric(12, 2) not null default 0;
+
+alter table Receipt_Return_Product add column if not exists vat_amount numeric(12, 2) not null default 0;
@@ -0,0 +1,22 @@
+-- Валюта заказов поставщику, курсы валют по датам и закупочные цены в базовой валюте
+create table if not exists Exchange_Rate (
+	currency  char(3)        not null,
+	rate_date date           not null,
+	rate      numeric(18, 6) not null check (rate > 0),
+	primary key (currency, rate_date)
+);
+
+-- Старые заказы оформлены в рублях по курсу 1
+alter table Supplier_Order add column if not exists currency char(3);
+alter table Supplier_Order add column if not exists exchange_rate numeric(18, 6) not null default 1;
+
+update Supplier_Order set currency = 'RUB' where currency is null;
+
+alter table Supplier_Order alter column currency set default 'RUB';
+alter table Supplier_Order alter column currency set not null;
+
+alter table Supplier_Order_Items add column if not exists base_purchase_price numeric(12, 2);
+
+update Supplier_Order_Items set base_purchase_price = purchase_price where base_purchase_price is null;
+
+alter table Supplier_Order_Items alter column base_purchase_price set not null;
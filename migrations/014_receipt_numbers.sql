@@ -0,0 +1,15 @@
+-- Касса смены, печатные номера чеков и счетчики нумерации
+alter table Shift add column if not exists register varchar(32) not null default '1';
+
+alter table Receipt add column if not exists number integer;
+alter table Receipt add column if not exists printed_number varchar(64);
+
+-- шаблон номера различает смену или кассу и день, поэтому печатный номер не повторяется
+drop index if exists receipt_printed_number_idx;
+create unique index if not exists receipt_printed_number_key on Receipt (printed_number);
+
+-- scope: "day:<касса>:<дата>" или "shift:<id смены>", строка блокируется до конца транзакции чека
+create table if not exists Receipt_Counter (
+	scope       varchar(128) primary key,
+	last_number integer      not null
+);
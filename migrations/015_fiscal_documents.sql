@@ -0,0 +1,26 @@
+-- Фискальные документы чеков, подписанные цепочкой хешей по каждой кассе, и очередь их отправки
+-- last_number и last_hash — последний документ кассы, строка блокируется на время добавления документа
+create table if not exists Fiscal_Chain (
+	register    varchar(32) primary key,
+	last_number bigint      not null,
+	last_hash   char(64)    not null
+);
+
+create table if not exists Fiscal_Document (
+	id         bigserial   primary key,
+	receipt_id bigint      not null unique references Receipt (id),
+	register   varchar(32) not null,
+	number     bigint      not null,
+	format     varchar(8)  not null check (format in ('json', 'xml')),
+	payload    text        not null,
+	prev_hash  char(64)    not null,
+	hash       char(64)    not null,
+	status     varchar(16) not null default 'queued' check (status in ('queued', 'sent', 'failed')),
+	attempts   integer     not null default 0,
+	last_error text,
+	created_at timestamp   not null default now(),
+	sent_at    timestamp,
+	unique (register, number)
+);
+
+create index if not exists fiscal_document_status_idx on Fiscal_Document (status, id);
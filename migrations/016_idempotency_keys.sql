@@ -0,0 +1,12 @@
+-- Ключи идемпотентности POST-запросов: повтор с тем же ключом получает сохраненный ответ
+-- status_code пустой, пока первый запрос еще выполняется
+create table if not exists Idempotency_Key (
+	scope        varchar(64)  not null,
+	key          varchar(255) not null,
+	request_hash char(64)     not null,
+	status_code  integer,
+	content_type varchar(128) not null default '',
+	response     bytea,
+	created_at   timestamp    not null default now(),
+	primary key (scope, key)
+);
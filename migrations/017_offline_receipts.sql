@@ -0,0 +1,4 @@
+-- Идентификатор чека, пробитого кассой без связи: повторная выгрузка того же чека не создает дубль
+alter table Receipt add column if not exists client_uuid uuid;
+
+create unique index if not exists receipt_client_uuid_idx on Receipt (client_uuid) where client_uuid is not null;
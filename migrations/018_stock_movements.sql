@@ -0,0 +1,33 @@
+-- Журнал движения товара: каждая запись меняет quantity_in_stock на quantity.
+-- Сумма движений товара равна его остатку, записи только добавляются.
+create table if not exists Stock_Movement (
+	id            bigserial   primary key,
+	product_id    bigint      not null references Product (id),
+	kind          varchar(32) not null check (kind in ('opening', 'sale', 'void', 'return', 'supplier_receipt', 'write_off', 'adjustment', 'transfer')),
+	quantity      bigint      not null,
+	document_type varchar(32),
+	document_id   bigint,
+	employee_id   bigint references Employee (id),
+	comment       text        not null default '',
+	created_at    timestamp   not null default now()
+);
+
+create index if not exists stock_movement_product_idx on Stock_Movement (product_id, id);
+create index if not exists stock_movement_document_idx on Stock_Movement (document_type, document_id);
+
+create or replace function stock_movement_append_only() returns trigger as $$
+begin
+	raise exception 'Stock_Movement is append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists stock_movement_append_only on Stock_Movement;
+create trigger stock_movement_append_only before update or delete on Stock_Movement
+	for each row execute function stock_movement_append_only();
+
+-- Начальные остатки: все, что накопилось до появления журнала
+insert into Stock_Movement (product_id, kind, quantity, comment)
+select p.id, 'opening', p.quantity_in_stock, 'остаток на момент запуска журнала'
+from Product as p
+where p.quantity_in_stock <> 0
+and not exists (select 1 from Stock_Movement as sm where sm.product_id = p.id);
@@ -0,0 +1,36 @@
+-- Инвентаризация отдела: ожидаемые остатки фиксируются при открытии, подсчеты со сканеров
+-- копятся в Stocktake_Count, при утверждении расхождения проводятся корректировками остатков
+create table if not exists Stocktake (
+	id            bigserial   primary key,
+	department_id bigint      not null references Department (id),
+	status        varchar(16) not null default 'open' check (status in ('open', 'approved', 'cancelled')),
+	comment       text        not null default '',
+	opened_by     bigint      not null references Employee (id),
+	opened_at     timestamp   not null default now(),
+	closed_by     bigint references Employee (id),
+	closed_at     timestamp
+);
+
+-- в отделе может идти только одна инвентаризация
+create unique index if not exists stocktake_open_department_idx on Stocktake (department_id) where status = 'open';
+
+-- unit_cost — себестоимость на момент открытия, пустая, если товар не закупался
+create table if not exists Stocktake_Item (
+	stocktake_id      bigint not null references Stocktake (id),
+	product_id        bigint not null references Product (id),
+	expected_quantity bigint not null,
+	counted_quantity  bigint,
+	unit_cost         numeric(12, 2),
+	primary key (stocktake_id, product_id)
+);
+
+create table if not exists Stocktake_Count (
+	id           bigserial primary key,
+	stocktake_id bigint    not null references Stocktake (id),
+	product_id   bigint    not null references Product (id),
+	quantity     bigint    not null,
+	employee_id  bigint references Employee (id),
+	created_at   timestamp not null default now()
+);
+
+create index if not exists stocktake_count_stocktake_idx on Stocktake_Count (stocktake_id);
@@ -0,0 +1,14 @@
+-- Процент и денежная сумма акции хранятся в разных колонках: percent для percent,
+-- amount — скидка на единицу для fixed или цена комплекта для bundle
+alter table Promotion add column if not exists percent numeric(5, 2) check (percent > 0 and percent <= 100);
+alter table Promotion add column if not exists amount numeric(12, 2) check (amount > 0);
+
+do $$
+begin
+	if exists (select 1 from information_schema.columns where table_name = 'promotion' and column_name = 'value') then
+		update Promotion set percent = value where kind = 'percent' and value > 0;
+		update Promotion set amount = value where kind in ('fixed', 'bundle') and value > 0;
+		alter table Promotion drop column value;
+	end if;
+end;
+$$;
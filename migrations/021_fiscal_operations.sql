@@ -0,0 +1,12 @@
+-- Возвраты и аннулирования в фискальной цепочке: документ привязан к операции, а не только к чеку
+alter table Fiscal_Document add column if not exists document_type varchar(16) not null default 'receipt';
+alter table Fiscal_Document add column if not exists document_id   bigint;
+
+update Fiscal_Document set document_id = receipt_id where document_id is null;
+
+alter table Fiscal_Document alter column document_id set not null;
+alter table Fiscal_Document drop constraint if exists fiscal_document_receipt_id_key;
+alter table Fiscal_Document add constraint fiscal_document_type_check check (document_type in ('receipt', 'receipt_return', 'receipt_void'));
+
+create unique index if not exists fiscal_document_operation_idx on Fiscal_Document (document_type, document_id);
+create index if not exists fiscal_document_receipt_id_idx on Fiscal_Document (receipt_id);
@@ -0,0 +1,3 @@
+-- Расхождения чеков кассы без связи: цена и сумма строки по расчету сервера, если касса посчитала иначе
+alter table Receipt_Product add column if not exists expected_price  numeric(12, 2);
+alter table Receipt_Product add column if not exists expected_amount numeric(12, 2);
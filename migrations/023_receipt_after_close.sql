@@ -0,0 +1,2 @@
+-- Чек кассы без связи, выгруженный после закрытия своей смены: в Z-отчет не входит, показывается отдельно
+alter table Receipt add column if not exists after_close boolean not null default false;
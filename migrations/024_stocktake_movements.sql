@@ -0,0 +1,14 @@
+-- Движения товара после открытия инвентаризации входят в ожидаемый остаток.
+-- last_movement_id — последняя запись журнала на момент открытия,
+-- moved_quantity — движение товара после открытия, фиксируется при закрытии.
+alter table Stocktake add column if not exists last_movement_id bigint not null default 0;
+alter table Stocktake_Item add column if not exists moved_quantity bigint;
+
+update Stocktake as s
+set last_movement_id = coalesce((select max(sm.id) from Stock_Movement as sm where sm.created_at <= s.opened_at), 0)
+where s.last_movement_id = 0;
+
+-- закрытые раньше инвентаризации проведены по зафиксированным остаткам
+update Stocktake_Item as si set moved_quantity = 0
+from Stocktake as s
+where s.id = si.stocktake_id and s.status <> 'open' and si.moved_quantity is null;
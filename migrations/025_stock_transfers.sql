@@ -0,0 +1,11 @@
+-- Перемещение остатка с одного товара на другой: обе записи журнала ссылаются на один документ
+create table if not exists Stock_Transfer (
+	id                bigserial primary key,
+	source_product_id bigint    not null references Product (id),
+	target_product_id bigint    not null references Product (id),
+	quantity          bigint    not null check (quantity > 0),
+	employee_id       bigint    not null references Employee (id),
+	comment           text      not null default '',
+	created_at        timestamp not null default now(),
+	check (source_product_id <> target_product_id)
+);
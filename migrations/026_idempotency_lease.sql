@@ -0,0 +1,3 @@
+-- started_at — начало выполнения запроса с ключом. Ключ без ответа дольше срока аренды
+-- считается брошенным: процесс упал, и неизвестно, успел ли он провести операцию.
+alter table Idempotency_Key add column if not exists started_at timestamp not null default now();